@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"os/user"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/secret"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+const cliUsage = `usage: ned [-config F] [-env E] <command> [-json] [-v] [-dry-run] [args]
+  status [server]                 show the status board, or one server
+  players [server]                show who is online, or one server's players
+  start|stop|restart <server>     run a service script and wait for it;
+                                  stop -force skips the shutdown grace,
+                                  start -force the address conflict check
+  start|stop|restart all|<category>
+                                  manage many servers, infra first unless
+                                  -unordered
+  update <server>|all             update a server, or every idle one
+  profile apply <name>            start a profile's servers, stop the rest
+  logs <server> [lines] [since] [grep]
+                                  print a server's recent output
+  rcon <target> [--] <command>    send RCON to a server, category or group
+  match start <count>             spin up CS2 match instances
+  match stop                      tear down all match instances
+  match map <map> [server]        change the CS2 map via RCON
+  welcome -print                  print the event welcome message
+  tournament -print [matches]     print the CS2 tournament info
+
+Flags may follow the command. Use -- before RCON commands that contain
+arguments starting with "-".`
+
+// cliCommands are the /ned subcommands available from the terminal.
+var cliCommands = map[string]func(*cli, context.Context, []string) error{
+	"status":     (*cli).status,
+	"players":    (*cli).players,
+	"start":      lifecycle(service.ActionStart),
+	"stop":       lifecycle(service.ActionStop),
+	"restart":    lifecycle(service.ActionRestart),
+	"logs":       (*cli).logs,
+	"update":     (*cli).update,
+	"profile":    (*cli).profile,
+	"rcon":       (*cli).rcon,
+	"match":      (*cli).match,
+	"welcome":    (*cli).welcome,
+	"tournament": (*cli).tournament,
+}
+
+// usageError is a malformed command line; it exits with status 2.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// cli runs /ned commands against a service without a Discord session.
+type cli struct {
+	svc    *service.Service
+	cfg    *config.Config
+	caller service.Caller
+	json   bool // print JSON instead of text
+	print  bool // print messages that would otherwise be posted
+	force  bool // skip the shutdown grace and the address conflict check
+	order  bool // start infra servers first in bulk lifecycle commands
+	out    io.Writer
+}
+
+// runCLI runs a single command from args and returns the exit status.
+func runCLI(configPath, env string, dryRun bool, args []string) int {
+	run, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s\n", args[0], cliUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("ned "+args[0], flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, cliUsage) }
+	fs.StringVar(&configPath, "config", configPath, "path to config file")
+	fs.StringVar(&env, "env", env, "environment to use instead of the config's")
+	fs.BoolVar(&dryRun, "dry-run", dryRun, "log scripts and RCON commands instead of running them")
+	jsonOut := fs.Bool("json", false, "print JSON instead of text")
+	printMsg := fs.Bool("print", false, "print the message to stdout")
+	force := fs.Bool("force", false, "stop without the shutdown grace, start despite address conflicts")
+	unordered := fs.Bool("unordered", false, "manage infra servers and dependencies alongside the rest instead of first")
+	verbose := fs.Bool("v", false, "log at the configured level instead of warnings only")
+	pos, err := parseInterleaved(fs, args[1:])
+	if err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadWith(configPath, config.Options{Environment: env, Local: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	logCfg := cfg.Logging
+	switch {
+	case dryRun && !*verbose:
+		logCfg.Level = "info" // the recorders log what would have run
+	case !*verbose:
+		logCfg.Level = "warn"
+	}
+	logger, err := logging.New(logCfg, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to configure logging: %v\n", err)
+		return 1
+	}
+	slog.SetDefault(logger)
+
+	deps, err := service.DefaultDeps(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if dryRun {
+		deps.UseDryRun()
+		fmt.Fprintln(os.Stderr, "[DRY RUN] Scripts and RCON commands are logged, not run.")
+	}
+
+	c := &cli{
+		svc:    service.New(cfg, deps),
+		cfg:    cfg,
+		caller: localCaller(cfg),
+		json:   *jsonOut,
+		print:  *printMsg,
+		force:  *force,
+		order:  !*unordered,
+		out:    secret.NewRedactingWriter(os.Stdout),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logging.WithLogger(ctx, logger.With("caller", c.caller.Name, "command", args[0]))
+	return exitCode(run(c, ctx, pos))
+}
+
+// parseInterleaved parses flags anywhere among args, so "ned status -json"
+// works. Everything after "--" is positional.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for i, a := range args {
+		if a == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	return append(pos, rest...), nil
+}
+
+// localCaller is the operator at the terminal. Anyone who can run Ned on the
+// host can already read its config, so they hold every configured role.
+func localCaller(cfg *config.Config) service.Caller {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	seen := map[string]bool{}
+	for role := range cfg.Roles {
+		seen[role] = true
+	}
+	for role := range cfg.RCONPolicy.Default {
+		seen[role] = true
+	}
+	for _, roles := range cfg.RCONPolicy.Servers {
+		for role := range roles {
+			seen[role] = true
+		}
+	}
+	roles := make([]string, 0, len(seen))
+	for role := range seen {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	return service.Caller{Name: "cli:" + name, Roles: roles}
+}
+
+// exitCode reports err on stderr and maps it to an exit status.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var usage usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(os.Stderr, "%s\n%s\n", usage, cliUsage)
+		return 2
+	}
+	msg := err.Error()
+	if cause := errors.Unwrap(err); cause != nil {
+		msg += ": " + cause.Error()
+	}
+	fmt.Fprintln(os.Stderr, secret.Redact("Error: "+msg))
+	return 1
+}
+
+// emit prints v as indented JSON.
+func (c *cli) emit(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *cli) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+}
+
+func (c *cli) status(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+	case 1:
+		return c.server(ctx, args[0], c.svc.Server)
+	default:
+		return usageError("status takes at most one server")
+	}
+
+	board := c.svc.Board(ctx)
+	if c.json {
+		return c.emit(map[string]any{"servers": board})
+	}
+
+	byCategory := map[string][]service.ServerEntry{}
+	for _, e := range board {
+		byCategory[e.Category] = append(byCategory[e.Category], e)
+	}
+	tw := c.table()
+	for _, cat := range service.Categories {
+		entries := byCategory[cat.Key]
+		if len(entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\n", cat.Label)
+		for _, e := range entries {
+			switch {
+			case e.Status == nil:
+				fmt.Fprintf(tw, "  %s\tN/A\n", e.Name)
+			case !e.Status.Online:
+				fmt.Fprintf(tw, "  %s\t%s\n", e.Name, e.Status.Failure.Describe())
+			default:
+				fmt.Fprintf(tw, "  %s\tOnline\t%s\t%d/%d\n", e.Name, e.Status.Map, e.Status.Players, e.Status.MaxPlayers)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func (c *cli) players(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+	case 1:
+		return c.server(ctx, args[0], c.svc.Players)
+	default:
+		return usageError("players takes at most one server")
+	}
+
+	online := c.svc.Online(ctx)
+	if c.json {
+		return c.emit(map[string]any{"servers": online})
+	}
+	if len(online) == 0 {
+		fmt.Fprintln(c.out, "No servers are online.")
+		return nil
+	}
+	tw := c.table()
+	total := 0
+	for _, e := range online {
+		fmt.Fprintf(tw, "%s\t%d/%d\n", e.Name, e.Status.Players, e.Status.MaxPlayers)
+		total += e.Status.Players
+	}
+	fmt.Fprintf(tw, "Total\t%d\n", total)
+	return tw.Flush()
+}
+
+// server prints the live state of one server, fetched by get.
+func (c *cli) server(ctx context.Context, key string, get func(context.Context, string) (*service.ServerDetail, error)) error {
+	detail, err := get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.emit(detail)
+	}
+
+	tw := c.table()
+	fmt.Fprintf(tw, "Server\t%s\n", detail.Name)
+	if detail.Address != "" {
+		fmt.Fprintf(tw, "Address\t%s\n", detail.Address)
+	}
+	switch {
+	case !detail.Queryable:
+		fmt.Fprintf(tw, "Status\tN/A\n")
+	case !detail.Status.Online:
+		fmt.Fprintf(tw, "Status\t%s\n", detail.Status.Failure.Describe())
+	default:
+		fmt.Fprintf(tw, "Status\tOnline\n")
+		fmt.Fprintf(tw, "Map\t%s\n", detail.Status.Map)
+		fmt.Fprintf(tw, "Players\t%d/%d\n", detail.Status.Players, detail.Status.MaxPlayers)
+	}
+	if len(detail.Players) > 0 {
+		fmt.Fprintln(tw)
+		for _, p := range detail.Players {
+			fmt.Fprintf(tw, "  %s\tScore: %d\t%s\n", p.Name, p.Score, p.Duration.Truncate(time.Second))
+		}
+	}
+	return tw.Flush()
+}
+
+func (c *cli) update(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return usageError("expected a server or all")
+	}
+	progress := func(key, step string) {
+		if !c.json {
+			fmt.Fprintf(c.out, "%s: %s\n", c.cfg.DisplayName(key), step)
+		}
+	}
+
+	var results []service.UpdateResult
+	if args[0] == "all" {
+		results = c.svc.UpdateIdle(ctx, c.caller, progress)
+	} else {
+		result, err := c.svc.Update(ctx, c.caller, args[0], progress)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	if c.json {
+		if err := c.emit(map[string]any{"servers": results}); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Failed() {
+			failed++
+		}
+		if c.json {
+			continue
+		}
+		switch {
+		case r.Skipped != "":
+			fmt.Fprintf(c.out, "%s: skipped, %s\n", r.Name, r.Skipped)
+		case r.Failed():
+			fmt.Fprint(c.out, r.Output)
+			fmt.Fprintf(c.out, "%s: failed (exit %d) %s\n", r.Name, r.ExitCode, r.Err)
+		default:
+			fmt.Fprintf(c.out, "%s: updated in %s, restarted: %t\n", r.Name, r.Duration, r.Restarted)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d update(s) failed", failed, len(results))
+	}
+	return nil
+}
+
+func (c *cli) logs(ctx context.Context, args []string) error {
+	if len(args) < 1 || len(args) > 4 {
+		return usageError("logs takes a server, then optionally lines, since and grep")
+	}
+	q := service.LogQuery{}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return usageError(fmt.Sprintf("invalid line count %q", args[1]))
+		}
+		q.Lines = n
+	}
+	if len(args) > 2 {
+		d, err := time.ParseDuration(args[2])
+		if err != nil || d <= 0 {
+			return usageError(fmt.Sprintf("invalid since %q, use a duration like 15m or 2h", args[2]))
+		}
+		q.Since = d
+	}
+	if len(args) > 3 {
+		q.Grep = args[3]
+	}
+
+	text, err := c.svc.Logs(ctx, args[0], q)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.emit(map[string]any{"server": args[0], "logs": text})
+	}
+	_, err = io.WriteString(c.out, text)
+	return err
+}
+
+// lifecycle returns the command for a service script action. Unlike the
+// Discord command it waits for the script and prints its output.
+func lifecycle(action string) func(*cli, context.Context, []string) error {
+	return func(c *cli, ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return usageError("expected exactly one server")
+		}
+		key := args[0]
+		if _, ok := c.cfg.Servers[key]; !ok && (key == service.TargetAll || slices.Contains(c.svc.ServerCategories(), key)) {
+			return c.bulkLifecycle(ctx, key, action)
+		}
+		result, err := c.svc.RunLifecycle(ctx, c.caller, key, action, c.force)
+		if err != nil {
+			return err
+		}
+
+		if c.json {
+			if err := c.emit(map[string]any{
+				"server":    key,
+				"action":    action,
+				"exit_code": result.ExitCode,
+				"duration":  result.Duration.String(),
+				"stdout":    result.Stdout,
+				"stderr":    result.Stderr,
+			}); err != nil {
+				return err
+			}
+		} else {
+			io.WriteString(c.out, result.Stdout)
+			if result.Stderr != "" {
+				io.WriteString(secret.NewRedactingWriter(os.Stderr), result.Stderr)
+			}
+			fmt.Fprintf(c.out, "%s: %s exited %d after %s\n",
+				c.cfg.DisplayName(key), action, result.ExitCode, result.Duration.Round(time.Millisecond))
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("%s script exited with code %d", action, result.ExitCode)
+		}
+		return nil
+	}
+}
+
+// bulkLifecycle runs action on every server in target and prints each
+// server's outcome.
+func (c *cli) bulkLifecycle(ctx context.Context, target, action string) error {
+	results, err := c.svc.BulkLifecycle(ctx, c.caller, target, action, c.order, c.force)
+	if err != nil {
+		return err
+	}
+	return c.bulkResults(map[string]any{"target": target, "action": action}, results)
+}
+
+// bulkResults prints per-server lifecycle results and fails if any server
+// did. extra is merged into the JSON output.
+func (c *cli) bulkResults(extra map[string]any, results []service.BulkResult) error {
+	if c.json {
+		extra["servers"] = results
+		if err := c.emit(extra); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	tw := c.table()
+	for _, r := range results {
+		if r.Failed() {
+			failed++
+		}
+		if c.json {
+			continue
+		}
+		switch {
+		case r.Err != "":
+			fmt.Fprintf(tw, "%s\t%s\tfailed\t%s\n", r.Name, r.Action, r.Err)
+		case r.ExitCode != 0:
+			fmt.Fprintf(tw, "%s\t%s\tfailed\texit %d\n", r.Name, r.Action, r.ExitCode)
+		default:
+			fmt.Fprintf(tw, "%s\t%s\tok\t%s\n", r.Name, r.Action, r.Duration)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d server(s) failed", failed, len(results))
+	}
+	return nil
+}
+
+func (c *cli) profile(ctx context.Context, args []string) error {
+	if len(args) != 2 || args[0] != "apply" {
+		return usageError("expected profile apply <name>")
+	}
+	plan, err := c.svc.PlanProfile(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if !c.json {
+		for _, wave := range plan.Stop {
+			fmt.Fprintf(c.out, "stop: %s\n", strings.Join(wave, ", "))
+		}
+		for _, wave := range plan.Start {
+			fmt.Fprintf(c.out, "start: %s\n", strings.Join(wave, ", "))
+		}
+		if len(plan.Unknown) > 0 {
+			fmt.Fprintf(c.out, "state unknown: %s\n", strings.Join(plan.Unknown, ", "))
+		}
+		if plan.Empty() {
+			fmt.Fprintf(c.out, "profile %s is already applied\n", plan.Profile)
+			return nil
+		}
+	}
+	results := c.svc.ApplyProfile(ctx, c.caller, plan, c.force)
+	return c.bulkResults(map[string]any{"profile": plan.Profile, "plan": plan}, results)
+}
+
+func (c *cli) rcon(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return usageError("expected a target and a command")
+	}
+	results, err := c.svc.SendRCON(ctx, c.caller, args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	return c.rconResults(map[string]any{"target": args[0]}, results)
+}
+
+// rconResults prints per-server RCON results and fails if any server did.
+// extra is merged into the JSON output.
+func (c *cli) rconResults(extra map[string]any, results []service.RCONResult) error {
+	failed := 0
+	type result struct {
+		Server   string `json:"server"`
+		Response string `json:"response,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}
+	out := make([]result, 0, len(results))
+	for _, r := range results {
+		res := result{Server: r.Server, Response: secret.Redact(r.Response)}
+		if r.Err != nil {
+			res.Error = secret.Redact(r.Err.Error())
+			failed++
+		}
+		out = append(out, res)
+	}
+
+	if c.json {
+		extra["results"] = out
+		if err := c.emit(extra); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range out {
+			if len(out) > 1 {
+				fmt.Fprintf(c.out, "== %s ==\n", c.cfg.DisplayName(r.Server))
+			}
+			if r.Error != "" {
+				fmt.Fprintf(c.out, "Error: %s\n", r.Error)
+				continue
+			}
+			fmt.Fprintln(c.out, strings.TrimRight(r.Response, "\n"))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("RCON failed on %d of %d servers", failed, len(results))
+	}
+	return nil
+}
+
+func (c *cli) match(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError("expected match start, stop or map")
+	}
+	switch sub, args := args[0], args[1:]; sub {
+	case "start":
+		if len(args) != 1 {
+			return usageError("match start takes a count")
+		}
+		count, err := strconv.Atoi(args[0])
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid count %q", args[0]))
+		}
+		output, err := c.svc.StartMatches(ctx, c.caller, count)
+		if err != nil {
+			return err
+		}
+		return c.output(map[string]any{"count": count}, output)
+	case "stop":
+		if len(args) != 0 {
+			return usageError("match stop takes no arguments")
+		}
+		output, err := c.svc.StopMatches(ctx, c.caller)
+		if err != nil {
+			return err
+		}
+		return c.output(map[string]any{}, output)
+	case "map":
+		if len(args) < 1 || len(args) > 2 {
+			return usageError("match map takes a map and an optional server")
+		}
+		server := ""
+		if len(args) == 2 {
+			server = args[1]
+		}
+		results, err := c.svc.ChangeMap(ctx, c.caller, args[0], server)
+		if err != nil {
+			return err
+		}
+		return c.rconResults(map[string]any{"map": args[0]}, results)
+	default:
+		return usageError(fmt.Sprintf("unknown match command %q", sub))
+	}
+}
+
+// output prints script output. extra is merged into the JSON output.
+func (c *cli) output(extra map[string]any, output string) error {
+	if c.json {
+		extra["output"] = secret.Redact(output)
+		return c.emit(extra)
+	}
+	_, err := io.WriteString(c.out, output)
+	return err
+}
+
+func (c *cli) welcome(_ context.Context, args []string) error {
+	if len(args) != 0 {
+		return usageError("welcome takes no arguments")
+	}
+	msg := c.cfg.BuildWelcomeMessage()
+	if msg == "" {
+		return errors.New("no welcome message configured; add a welcome section to the config")
+	}
+	return c.message(msg)
+}
+
+func (c *cli) tournament(_ context.Context, args []string) error {
+	count := c.cfg.CS2Matches.Pro.MaxInstances
+	switch len(args) {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > count {
+			return usageError(fmt.Sprintf("matches must be between 1 and %d", count))
+		}
+		count = n
+	default:
+		return usageError("tournament takes at most one match count")
+	}
+	return c.message(c.cfg.BuildTournamentMessage(count))
+}
+
+// message prints a message that Discord would post to the channel. Posting
+// needs the bot, so -print is required.
+func (c *cli) message(msg string) error {
+	if !c.print {
+		return usageError("posting to Discord needs the bot; use -print to write the message to stdout")
+	}
+	if c.json {
+		return c.emit(map[string]string{"message": msg})
+	}
+	_, err := fmt.Fprintln(c.out, msg)
+	return err
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/policy"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+type fakeExecutor struct {
+	exitCode int
+	ran      []string
+}
+
+func (f *fakeExecutor) Run(_ context.Context, scriptPath, command string, _ map[string]string) (*executor.Result, error) {
+	f.ran = append(f.ran, scriptPath+" "+command)
+	return &executor.Result{Stdout: "script output\n", ExitCode: f.exitCode}, nil
+}
+
+type fakeRCON struct{}
+
+func (fakeRCON) Execute(_ context.Context, address, _, command string) (string, error) {
+	if strings.HasPrefix(address, "10.0.0.9") {
+		return "", errors.New("connection refused")
+	}
+	return "ran " + command, nil
+}
+
+type fakeQuerier struct{}
+
+func (fakeQuerier) QueryStatus(_ context.Context, address string) (*query.ServerStatus, error) {
+	if address == "10.0.0.1:27015" {
+		return &query.ServerStatus{Online: true, Map: "ctf_2fort", Players: 3, MaxPlayers: 24}, nil
+	}
+	return &query.ServerStatus{Online: false}, nil
+}
+
+func (fakeQuerier) QueryPlayers(context.Context, string) ([]query.PlayerInfo, error) {
+	return []query.PlayerInfo{{Name: "alice", Score: 5}}, nil
+}
+
+type discardAudit struct{}
+
+func (discardAudit) Record(audit.Entry) {}
+
+func newTestCLI(t *testing.T, exec *fakeExecutor) (*cli, *bytes.Buffer) {
+	t.Helper()
+	cfg := &config.Config{
+		Servers: map[string]config.Server{
+			"tf2":  {DisplayName: "TF2", Script: "tf2/tf2.sh", LogsVerb: "logs", Protocol: "source", Category: "game", IP: "10.0.0.1", Port: 27015, QueryPort: 27015, RCONPort: 27015, RCONPassword: "pw"},
+			"rust": {DisplayName: "Rust", Script: "rust/rust.sh", Protocol: "none", Category: "game", IP: "10.0.0.9", RCONPort: 28016, RCONPassword: "pw"},
+		},
+		CS2Matches: config.CS2MatchConfig{
+			Script: "cs2/cs2.sh",
+			Pro:    config.MatchTierConfig{MaxInstances: 2, IPBase: "10.0.1.0", DisplayPrefix: "CS2 Match"},
+		},
+		Welcome: config.WelcomeConfig{Sections: []config.WelcomeSection{{Title: "Welcome to NETWAR", Text: "Have fun"}}},
+	}
+	pol, err := policy.NewRCONPolicy(config.RCONPolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.New(cfg, service.Deps{
+		Executor: exec,
+		Querier:  fakeQuerier{},
+		RCON:     fakeRCON{},
+		Policy:   pol,
+		Audit:    discardAudit{},
+	})
+	out := &bytes.Buffer{}
+	return &cli{svc: svc, cfg: cfg, caller: localCaller(cfg), out: out}, out
+}
+
+func TestParseInterleaved(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "")
+	pos, err := parseInterleaved(fs, []string{"tf2", "-json", "say", "--", "-hi", "-json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*jsonOut {
+		t.Error("-json after a positional argument was not parsed")
+	}
+	if want := []string{"tf2", "say", "-hi", "-json"}; !reflect.DeepEqual(pos, want) {
+		t.Errorf("positional = %q, want %q", pos, want)
+	}
+}
+
+func TestCLI_Lifecycle(t *testing.T) {
+	exec := &fakeExecutor{}
+	c, out := newTestCLI(t, exec)
+
+	if err := cliCommands["start"](c, context.Background(), []string{"tf2"}); err != nil {
+		t.Fatal(err)
+	}
+	// The script has finished by the time the command returns.
+	if len(exec.ran) != 1 || exec.ran[0] != "tf2/tf2.sh up" {
+		t.Errorf("ran %q, want tf2/tf2.sh up", exec.ran)
+	}
+	if !strings.Contains(out.String(), "script output") || !strings.Contains(out.String(), "TF2: up exited 0") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	exec.exitCode = 3
+	if err := cliCommands["stop"](c, context.Background(), []string{"tf2"}); err == nil {
+		t.Error("expected an error for a non-zero exit code")
+	}
+
+	err := cliCommands["restart"](c, context.Background(), nil)
+	var usage usageError
+	if !errors.As(err, &usage) {
+		t.Errorf("restart without a server: err = %v, want a usage error", err)
+	}
+}
+
+func TestCLI_Logs(t *testing.T) {
+	exec := &fakeExecutor{}
+	c, out := newTestCLI(t, exec)
+
+	if err := c.logs(context.Background(), []string{"tf2", "50", "1h", "output"}); err != nil {
+		t.Fatal(err)
+	}
+	if exec.ran[0] != "tf2/tf2.sh logs" || out.String() != "script output\n" {
+		t.Errorf("ran %q, output %q", exec.ran, out.String())
+	}
+
+	var usage usageError
+	if err := c.logs(context.Background(), []string{"tf2", "many"}); !errors.As(err, &usage) {
+		t.Errorf("bad line count: err = %v, want a usage error", err)
+	}
+}
+
+func TestCLI_StatusJSON(t *testing.T) {
+	c, out := newTestCLI(t, &fakeExecutor{})
+	c.json = true
+
+	if err := c.status(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Servers []service.ServerEntry `json:"servers"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if len(got.Servers) != 2 || got.Servers[1].Key != "tf2" || got.Servers[1].Status.Map != "ctf_2fort" {
+		t.Errorf("servers = %+v", got.Servers)
+	}
+}
+
+func TestCLI_RCON(t *testing.T) {
+	c, out := newTestCLI(t, &fakeExecutor{})
+
+	if err := c.rcon(context.Background(), []string{"tf2", "sv_cheats", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "ran sv_cheats 0" {
+		t.Errorf("output = %q", got)
+	}
+
+	out.Reset()
+	if err := c.rcon(context.Background(), []string{"rust", "status"}); err == nil {
+		t.Error("expected an error when a server fails")
+	}
+	if !strings.Contains(out.String(), "connection refused") {
+		t.Errorf("output = %q, want the failure", out.String())
+	}
+}
+
+func TestCLI_WelcomeRequiresPrint(t *testing.T) {
+	c, out := newTestCLI(t, &fakeExecutor{})
+
+	var usage usageError
+	if err := c.welcome(context.Background(), nil); !errors.As(err, &usage) {
+		t.Errorf("welcome without -print: err = %v, want a usage error", err)
+	}
+
+	c.print = true
+	if err := c.welcome(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Welcome to NETWAR") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRunCLI_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	if err := os.MkdirAll(filepath.Join(dir, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/bash\necho \"$1\" >> %q\n", marker)
+	if err := os.WriteFile(filepath.Join(dir, "x", "x.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	cfg := fmt.Sprintf(`scripts_dir:
+  local: %q
+environment: "local"
+servers:
+  x:
+    display_name: "X"
+    script: "x/x.sh"
+    protocol: "none"
+    category: "game"
+    local:
+      ip: "127.0.0.1"
+cs2_matches:
+  script: "cs2/cs2.sh"
+`, dir)
+	if err := os.WriteFile(configPath, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runCLI(configPath, "", true, []string{"start", "x"}); code != 0 {
+		t.Fatalf("dry-run start exited %d", code)
+	}
+	if code := runCLI(configPath, "", false, []string{"stop", "x", "-dry-run"}); code != 0 {
+		t.Fatalf("stop -dry-run exited %d", code)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("the script ran in dry-run mode (stat: %v)", err)
+	}
+
+	if code := runCLI(configPath, "", false, []string{"start", "x"}); code != 0 {
+		t.Fatalf("start exited %d", code)
+	}
+	if got, _ := os.ReadFile(marker); string(got) != "up\n" {
+		t.Errorf("script log = %q, want the one real start", got)
+	}
+}
+
+func TestRunCommand_GlobalFlags(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "ned.yaml")
+	cfg := fmt.Sprintf(`discord:
+  token: "token"
+  guild_id: "123"
+scripts_dir: %q
+environment: "local"
+servers:
+  x:
+    display_name: "X"
+    script: "x/x.sh"
+    protocol: "none"
+    category: "game"
+    local:
+      ip: "127.0.0.1"
+cs2_matches:
+  script: "cs2/cs2.sh"
+`, dir)
+	if err := os.WriteFile(configPath, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// ned -config ned.yaml config check
+	if code := runCommand(configPath, "", false, []string{"config", "check"}); code != 0 {
+		t.Errorf("config check after -config exited %d, want 0", code)
+	}
+	// ned -config missing.yaml config check -config ned.yaml
+	missing := filepath.Join(dir, "missing.yaml")
+	if code := runCommand(missing, "", false, []string{"config", "check", "-config", configPath}); code != 0 {
+		t.Errorf("config check -config exited %d, want 0", code)
+	}
+	if code := runCommand(missing, "", false, []string{"config", "check"}); code != 1 {
+		t.Errorf("config check of a missing file exited %d, want 1", code)
+	}
+	if code := runCommand(configPath, "nope", false, []string{"config", "check"}); code != 1 {
+		t.Errorf("config check after -env nope exited %d, want 1", code)
+	}
+}
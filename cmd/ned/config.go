@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/netwarlan/ned/internal/config"
+)
+
+const configUsage = `usage:
+  ned config check [-config F] [-env E]    report every problem in the config file`
+
+// runConfig checks a config file without starting the bot. configPath and
+// env are the defaults of its flags.
+func runConfig(configPath, env string, args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	fs.StringVar(&configPath, "config", configPath, "path to config file")
+	fs.StringVar(&env, "env", env, "environment to check instead of the config's")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	problems, err := config.Check(configPath, config.Options{Environment: env})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return 1
+	}
+
+	errs, warnings := 0, 0
+	for _, p := range problems {
+		severity := "error"
+		if p.Warning {
+			severity = "warning"
+			warnings++
+		} else {
+			errs++
+		}
+		loc := configPath
+		if p.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", loc, p.Line)
+		}
+		msg := p.Msg
+		if p.Field != "" {
+			msg = p.Field + ": " + msg
+		}
+		fmt.Printf("%s: %s: %s\n", loc, severity, msg)
+	}
+
+	if errs == 0 && warnings == 0 {
+		fmt.Printf("%s: OK\n", configPath)
+		return 0
+	}
+	fmt.Printf("%d error(s), %d warning(s)\n", errs, warnings)
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
@@ -4,12 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/netwarlan/ned/internal/bot"
 	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/secret"
 )
 
 var (
@@ -19,8 +22,15 @@ var (
 )
 
 func main() {
+	log.SetOutput(secret.NewRedactingWriter(os.Stderr))
+
 	configPath := flag.String("config", "config.yaml", "path to config file")
+	env := flag.String("env", "", "environment to use instead of the config's")
+	dryRun := flag.Bool("dry-run", false, "log scripts and RCON commands instead of running them")
 	showVersion := flag.Bool("version", false, "print version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ned [-config F] [-env E] [-dry-run] [-version]     run the Discord bot\n\n%s\n\n%s\n\n%s\n", cliUsage, configUsage, simulateUsage)
+	}
 	flag.Parse()
 
 	if *showVersion {
@@ -28,28 +38,59 @@ func main() {
 		os.Exit(0)
 	}
 
-	cfg, err := config.Load(*configPath)
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(*configPath, *env, *dryRun, flag.Args()))
+	}
+
+	cfg, err := config.LoadWith(*configPath, config.Options{Environment: *env})
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	b, err := bot.New(cfg, fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date))
+	logger, err := logging.New(cfg.Logging, os.Stderr)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	b, err := bot.New(cfg, fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date), *dryRun)
 	if err != nil {
-		log.Fatalf("Failed to create bot: %v", err)
+		fatal("failed to create bot", err)
 	}
 
 	if err := b.Start(); err != nil {
-		log.Fatalf("Failed to start bot: %v", err)
+		fatal("failed to start bot", err)
 	}
 
-	log.Printf("Ned %s is running. Press Ctrl+C to stop.", version)
+	slog.Info("Ned is running, press Ctrl+C to stop", "version", version, "environment", cfg.Environment, "dry_run", *dryRun)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	log.Println("Shutting down...")
+	slog.Info("shutting down")
 	if err := b.Stop(); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+		slog.Error("error during shutdown", "err", err)
+	}
+}
+
+// fatal logs err through the configured logger and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// runCommand runs the command named by args[0] and returns the exit status.
+// The global flags, which may come before any command, are the defaults of
+// the command's own.
+func runCommand(configPath, env string, dryRun bool, args []string) int {
+	switch args[0] {
+	case "secrets":
+		return runSecrets(args[1:])
+	case "config":
+		return runConfig(configPath, env, args[1:])
+	case "simulate":
+		return runSimulate(configPath, env, args[1:])
 	}
+	return runCLI(configPath, env, dryRun, args)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/netwarlan/ned/internal/secret"
+)
+
+const secretsUsage = `usage:
+  ned secrets keygen                              print a new base64 key
+  ned secrets set  [-file F] [-key-file K] NAME   read a value from stdin and store it
+  ned secrets list [-file F] [-key-file K]        list stored secret names`
+
+// runSecrets manages the encrypted secrets file referenced by secret:NAME.
+func runSecrets(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+
+	if args[0] == "keygen" {
+		key, err := secret.GenerateKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(key)
+		return 0
+	}
+
+	fs := flag.NewFlagSet("secrets "+args[0], flag.ContinueOnError)
+	file := fs.String("file", "secrets.enc.yaml", "path to the encrypted secrets file")
+	keyFile := fs.String("key-file", "", "path to the key file (default: $"+secret.KeyEnv+")")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	key, err := secret.LoadKey(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	store, err := secret.OpenStore(*file, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "set":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, secretsUsage)
+			return 2
+		}
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		value = strings.TrimRight(value, "\r\n")
+		if value == "" {
+			fmt.Fprintf(os.Stderr, "no value read from stdin: %v\n", err)
+			return 1
+		}
+		if err := store.Set(fs.Arg(0), value); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Stored %s in %s\n", fs.Arg(0), *file)
+	case "list":
+		for _, name := range store.Names() {
+			fmt.Println(name)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+	return 0
+}
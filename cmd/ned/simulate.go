@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/simulator"
+)
+
+const simulateUsage = `usage:
+  ned simulate [-config F] [-env E] [-listen H] [-players N] [-scripts DIR]
+                                           run a fake game server at every A2S-queryable server's address`
+
+// runSimulate runs simulated game servers until interrupted. configPath and
+// env are the defaults of its flags.
+func runSimulate(configPath, env string, args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.StringVar(&configPath, "config", configPath, "path to config file")
+	fs.StringVar(&env, "env", env, "environment to simulate instead of the config's")
+	listen := fs.String("listen", "", "host to listen on instead of each server's ip")
+	players := fs.Int("players", 0, "players connected to each server")
+	scripts := fs.String("scripts", "", "write a fake game-deployment-scripts tree to this directory")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, simulateUsage)
+		return 2
+	}
+
+	cfg, err := config.LoadWith(configPath, config.Options{Environment: env, Local: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	if *scripts != "" {
+		if err := simulator.WriteScripts(*scripts, scriptPaths(cfg)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Wrote fake scripts to %s; runs are logged to %s\n", *scripts, filepath.Join(*scripts, simulator.ScriptLog))
+	}
+
+	rconAddrs := map[string]string{}
+	for key, t := range cfg.AllCS2RCONTargets() {
+		rconAddrs[key] = t.Address
+	}
+	for key, srv := range cfg.RCONCapableServers() {
+		rconAddrs[key] = net.JoinHostPort(srv.IP, strconv.Itoa(srv.RCONPort))
+	}
+
+	queryAddrs := cfg.AllQueryTargets()
+	var sims []*simulator.Server
+	defer func() {
+		for _, sim := range sims {
+			sim.Close()
+		}
+	}()
+	for _, key := range slices.Sorted(maps.Keys(queryAddrs)) {
+		queryAddr := queryAddrs[key]
+		rconAddr, ok := rconAddrs[key]
+		if !ok {
+			rconAddr = queryAddr
+		}
+		if *listen != "" {
+			queryAddr, rconAddr = rehost(queryAddr, *listen), rehost(rconAddr, *listen)
+		}
+
+		sim, err := simulator.Start(simulator.Options{
+			Name:         cfg.DisplayName(key),
+			Players:      fakePlayers(*players),
+			RCONPassword: cfg.RCONPassword(key),
+			Challenge:    true,
+		}, queryAddr, rconAddr)
+		if err != nil {
+			// With -listen, servers told apart only by IP share a port.
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", cfg.DisplayName(key), err)
+			continue
+		}
+		sims = append(sims, sim)
+		fmt.Printf("%-20s A2S on %s, RCON on %s\n", cfg.DisplayName(key), sim.QueryAddr(), sim.RCONAddr())
+	}
+	if len(sims) == 0 {
+		fmt.Fprintln(os.Stderr, "No A2S-queryable servers to simulate")
+		return 1
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	return 0
+}
+
+// scriptPaths returns every script the config runs.
+func scriptPaths(cfg *config.Config) []string {
+	var paths []string
+	for _, srv := range cfg.Servers {
+		if srv.Script != "" {
+			paths = append(paths, srv.Script)
+		}
+	}
+	if cfg.CS2Matches.Script != "" {
+		paths = append(paths, cfg.CS2Matches.Script)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// rehost replaces the host of addr.
+func rehost(addr, host string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	return net.JoinHostPort(host, port)
+}
+
+// fakePlayers returns n players who joined over the last hour.
+func fakePlayers(n int) []simulator.Player {
+	players := make([]simulator.Player, n)
+	for i := range players {
+		players[i] = simulator.Player{
+			Name:     fmt.Sprintf("player%d", i+1),
+			Score:    i * 3,
+			Duration: time.Duration(n-i) * time.Hour / time.Duration(n),
+		}
+	}
+	return players
+}
@@ -0,0 +1,185 @@
+// Package api serves Ned's operations over an authenticated JSON HTTP API.
+// Every endpoint calls the same service layer as the Discord commands.
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// dryRunHeader is set to "true" on every response while Ned runs with
+// -dry-run, so callers can tell that nothing was actually run.
+const dryRunHeader = "X-Ned-Dry-Run"
+
+// maxBodyBytes bounds request bodies; every request is a small JSON object.
+const maxBodyBytes = 64 << 10
+
+// Authenticator identifies the caller behind a request. ok is false when the
+// request is not authenticated.
+type Authenticator func(r *http.Request) (c service.Caller, ok bool)
+
+// Server is the HTTP API.
+type Server struct {
+	svc  *service.Service
+	auth Authenticator
+	mux  *http.ServeMux
+}
+
+// New creates the API for svc. Every request must pass auth.
+func New(svc *service.Service, auth Authenticator) *Server {
+	s := &Server{svc: svc, auth: auth, mux: http.NewServeMux()}
+
+	s.handle("GET /api/v1/servers", s.listServers)
+	s.handle("GET /api/v1/servers/{key}", s.getServer)
+	s.handle("POST /api/v1/servers/{key}/start", s.lifecycle(service.ActionStart))
+	s.handle("POST /api/v1/servers/{key}/stop", s.lifecycle(service.ActionStop))
+	s.handle("POST /api/v1/servers/{key}/restart", s.lifecycle(service.ActionRestart))
+	s.handle("GET /api/v1/rcon/targets", s.listRCONTargets)
+	s.handle("GET /api/v1/players", s.listPlayers)
+	s.handle("GET /api/v1/players/{key}", s.getPlayers)
+	s.handle("POST /api/v1/rcon", s.sendRCON)
+	s.handle("POST /api/v1/matches", s.startMatches)
+	s.handle("DELETE /api/v1/matches", s.stopMatches)
+	s.handle("POST /api/v1/matches/map", s.changeMap)
+	return s
+}
+
+// Handler returns the API's HTTP handler.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// handlerFunc is an authenticated endpoint.
+type handlerFunc func(ctx context.Context, c service.Caller, w http.ResponseWriter, r *http.Request)
+
+// handle registers an endpoint behind authentication and request logging.
+func (s *Server) handle(pattern string, h handlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		if s.svc.DryRun() {
+			w.Header().Set(dryRunHeader, "true")
+		}
+
+		logger := slog.Default().With("request_id", requestID, "method", r.Method, "path", r.URL.Path)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		c, ok := s.auth(r)
+		if !ok {
+			writeError(rec, http.StatusUnauthorized, "not authenticated")
+			logger.Warn("api request rejected", "status", rec.status, "remote", r.RemoteAddr)
+			return
+		}
+
+		logger = logger.With("user", c.Name)
+		ctx := logging.WithLogger(r.Context(), logger)
+
+		r.Body = http.MaxBytesReader(rec, r.Body, maxBodyBytes)
+		h(ctx, c, rec, r)
+		logger.Info("api request handled", "status", rec.status, "duration", time.Since(start))
+	})
+}
+
+// TokenAuth authenticates requests by bearer token. The caller is named
+// "api:<token name>" and holds the token's roles.
+func TokenAuth(tokens []config.APIToken) Authenticator {
+	return func(r *http.Request) (service.Caller, bool) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || got == "" {
+			return service.Caller{}, false
+		}
+		for _, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(got), []byte(t.Token)) == 1 {
+				return service.Caller{Name: "api:" + t.Name, Roles: t.Roles}, true
+			}
+		}
+		return service.Caller{}, false
+	}
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// statusRecorder remembers the response status for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error   string   `json:"error"`
+	Detail  string   `json:"detail,omitempty"`
+	Servers []string `json:"servers,omitempty"` // denied servers, for 403s
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// writeServiceError maps a service error to an HTTP status.
+func writeServiceError(w http.ResponseWriter, err error) {
+	var denied *service.DeniedError
+	if errors.As(err, &denied) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "denied by RCON policy", Servers: denied.Servers})
+		return
+	}
+
+	resp := errorResponse{Error: err.Error()}
+	if cause := errors.Unwrap(err); cause != nil {
+		resp.Detail = cause.Error()
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrBusy):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrUnavailable):
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, resp)
+}
+
+// decode reads a JSON request body into v, reporting failures as 400s.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
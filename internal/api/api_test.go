@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/policy"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+const testToken = "0123456789abcdef-admin"
+
+type fakeExecutor struct {
+	ran chan string
+}
+
+func (f *fakeExecutor) Run(_ context.Context, scriptPath, command string, _ map[string]string) (*executor.Result, error) {
+	f.ran <- scriptPath + " " + command
+	return &executor.Result{Stdout: "ok"}, nil
+}
+
+type fakeRCON struct{}
+
+func (fakeRCON) Execute(_ context.Context, address, _, command string) (string, error) {
+	if strings.HasPrefix(address, "10.0.0.9") {
+		return "", errors.New("connection refused")
+	}
+	return "ran " + command, nil
+}
+
+type fakeQuerier struct{}
+
+func (fakeQuerier) QueryStatus(_ context.Context, address string) (*query.ServerStatus, error) {
+	if address == "10.0.0.1:27015" {
+		return &query.ServerStatus{Online: true, Map: "ctf_2fort", Players: 3, MaxPlayers: 24}, nil
+	}
+	return &query.ServerStatus{Online: false}, nil
+}
+
+func (fakeQuerier) QueryPlayers(context.Context, string) ([]query.PlayerInfo, error) {
+	return []query.PlayerInfo{{Name: "alice", Score: 5}}, nil
+}
+
+type auditRecorder struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (a *auditRecorder) Record(e audit.Entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+}
+
+func newTestAPI(t *testing.T) (http.Handler, *fakeExecutor, *auditRecorder) {
+	t.Helper()
+	return newTestAPIWith(t, nil)
+}
+
+// newTestAPIWith is newTestAPI with the service's collaborators adjusted by
+// setup before it is created.
+func newTestAPIWith(t *testing.T, setup func(*service.Deps)) (http.Handler, *fakeExecutor, *auditRecorder) {
+	t.Helper()
+	cfg := &config.Config{
+		Servers: map[string]config.Server{
+			"tf2":  {DisplayName: "TF2", Script: "tf2/tf2.sh", Protocol: "source", Category: "game", IP: "10.0.0.1", Port: 27015, QueryPort: 27015, RCONPort: 27015, RCONPassword: "tf2pass"},
+			"rust": {DisplayName: "Rust", Script: "rust/rust.sh", Protocol: "none", Category: "game", IP: "10.0.0.9", RCONPort: 28016, RCONPassword: "rustpass"},
+		},
+		CS2Matches: config.CS2MatchConfig{Script: "cs2/cs2.sh", Pro: config.MatchTierConfig{MaxInstances: 2, IPBase: "10.0.1.0"}},
+	}
+	pol, err := policy.NewRCONPolicy(config.RCONPolicyConfig{
+		Default: map[string]config.RCONRule{
+			"admin":     {Allow: []string{".*"}},
+			"volunteer": {Allow: []string{"^status$"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &fakeExecutor{ran: make(chan string, 4)}
+	rec := &auditRecorder{}
+	deps := service.Deps{
+		Executor: exec,
+		Match:    executor.NewMatchExecutor(exec, cfg.CS2Matches.Script, cfg.CS2Matches.Pro.MaxInstances),
+		Querier:  fakeQuerier{},
+		RCON:     fakeRCON{},
+		Policy:   pol,
+		Audit:    rec,
+	}
+	if setup != nil {
+		setup(&deps)
+	}
+	svc := service.New(cfg, deps)
+	tokens := []config.APIToken{
+		{Name: "admin", Token: testToken, Roles: []string{"admin"}},
+		{Name: "vol", Token: "0123456789abcdef-volunteer", Roles: []string{"volunteer"}},
+	}
+	return New(svc, TokenAuth(tokens)).Handler(), exec, rec
+}
+
+func do(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPI_RequiresToken(t *testing.T) {
+	h, _, _ := newTestAPI(t)
+	for _, token := range []string{"", "wrong-token-value"} {
+		if rr := do(t, h, "GET", "/api/v1/servers", token, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, rr.Code)
+		}
+	}
+}
+
+func TestAPI_ListServers(t *testing.T) {
+	h, _, _ := newTestAPI(t)
+	rr := do(t, h, "GET", "/api/v1/servers", testToken, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+	var body struct {
+		Servers []service.ServerEntry `json:"servers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Servers) != 2 || body.Servers[0].Key != "rust" || body.Servers[0].Status != nil {
+		t.Fatalf("servers = %+v", body.Servers)
+	}
+	if tf2 := body.Servers[1]; tf2.Status == nil || !tf2.Status.Online || tf2.Status.Players != 3 {
+		t.Errorf("tf2 = %+v", tf2)
+	}
+}
+
+func TestAPI_StartServer(t *testing.T) {
+	h, exec, rec := newTestAPI(t)
+
+	rr := do(t, h, "POST", "/api/v1/servers/tf2/start", testToken, "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+	select {
+	case got := <-exec.ran:
+		if got != "tf2/tf2.sh up" {
+			t.Errorf("ran %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("script was not run")
+	}
+
+	if rr := do(t, h, "POST", "/api/v1/servers/nope/start", testToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown server: status = %d, want 404", rr.Code)
+	}
+
+	// The audit entry is written when the script exits.
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec.mu.Lock()
+		n := len(rec.entries)
+		rec.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lifecycle action was not audited")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if e := rec.entries[0]; e.User != "api:admin" || e.Action != "up" || e.Target != "tf2" || e.Outcome != audit.OutcomeOK {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
+
+func TestAPI_DryRun(t *testing.T) {
+	h, _, rec := newTestAPIWith(t, (*service.Deps).UseDryRun)
+
+	rr := do(t, h, "POST", "/api/v1/rcon", testToken, `{"target":"tf2","command":"status"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+	if got := rr.Header().Get(dryRunHeader); got != "true" {
+		t.Errorf("%s = %q, want true", dryRunHeader, got)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.entries) != 1 || !rec.entries[0].DryRun {
+		t.Errorf("audit entries = %+v, want one marked dry-run", rec.entries)
+	}
+
+	h, _, _ = newTestAPI(t)
+	if rr := do(t, h, "GET", "/api/v1/servers", testToken, ""); rr.Header().Get(dryRunHeader) != "" {
+		t.Errorf("%s set outside dry-run mode", dryRunHeader)
+	}
+}
+
+func TestAPI_RCON(t *testing.T) {
+	h, _, _ := newTestAPI(t)
+
+	rr := do(t, h, "POST", "/api/v1/rcon", testToken, `{"target":"game","command":"status"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+	var body struct {
+		Results []rconResult `json:"results"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if len(body.Results) != 2 {
+		t.Fatalf("results = %+v", body.Results)
+	}
+	if r := body.Results[0]; r.Server != "rust" || r.Error == "" {
+		t.Errorf("rust result = %+v, want an error", r)
+	}
+	if r := body.Results[1]; r.Server != "tf2" || r.Response != "ran status" {
+		t.Errorf("tf2 result = %+v", r)
+	}
+}
+
+func TestAPI_RCONDeniedByPolicy(t *testing.T) {
+	h, _, rec := newTestAPI(t)
+
+	rr := do(t, h, "POST", "/api/v1/rcon", "0123456789abcdef-volunteer", `{"target":"tf2","command":"quit"}`)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body)
+	}
+	if len(rec.entries) != 1 || rec.entries[0].Outcome != audit.OutcomeDenied || rec.entries[0].User != "api:vol" {
+		t.Errorf("audit = %+v", rec.entries)
+	}
+}
+
+func TestAPI_BadRequests(t *testing.T) {
+	h, _, _ := newTestAPI(t)
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/api/v1/rcon", `{"target":"tf2"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/rcon", `{"target":"tf2","command":"status","extra":1}`, http.StatusBadRequest},
+		{"POST", "/api/v1/matches", `{"count":9}`, http.StatusBadRequest},
+		{"GET", "/api/v1/players/rust", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rr := do(t, h, tt.method, tt.path, testToken, tt.body); rr.Code != tt.want {
+			t.Errorf("%s %s %s: status = %d, want %d (%s)", tt.method, tt.path, tt.body, rr.Code, tt.want, rr.Body)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/netwarlan/ned/internal/secret"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// rconResult is one server's RCON outcome in API responses.
+type rconResult struct {
+	Server   string `json:"server"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// rconResults converts service results, redacting known secrets.
+func rconResults(results []service.RCONResult) []rconResult {
+	out := make([]rconResult, 0, len(results))
+	for _, r := range results {
+		res := rconResult{Server: r.Server, Response: secret.Redact(r.Response)}
+		if r.Err != nil {
+			res.Error = secret.Redact(r.Err.Error())
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+func (s *Server) listServers(ctx context.Context, _ service.Caller, w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"servers": s.svc.Board(ctx)})
+}
+
+func (s *Server) getServer(ctx context.Context, _ service.Caller, w http.ResponseWriter, r *http.Request) {
+	detail, err := s.svc.Server(ctx, r.PathValue("key"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// lifecycle returns the handler for a start, stop or restart endpoint. The
+// script keeps running after the response, so success is 202 Accepted.
+// ?force=true skips a stop's shutdown grace and a start's address conflict
+// check.
+func (s *Server) lifecycle(action string) handlerFunc {
+	return func(ctx context.Context, c service.Caller, w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		force := r.URL.Query().Get("force") == "true"
+		if _, err := s.svc.Lifecycle(ctx, c, key, action, force); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"server": key, "action": action})
+	}
+}
+
+// listRCONTargets returns the groups, categories and servers accepted as an
+// RCON target, in the order the Discord command offers them.
+func (s *Server) listRCONTargets(_ context.Context, _ service.Caller, w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"targets": s.svc.RCONTargets()})
+}
+
+func (s *Server) listPlayers(ctx context.Context, _ service.Caller, w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"servers": s.svc.Online(ctx)})
+}
+
+func (s *Server) getPlayers(ctx context.Context, _ service.Caller, w http.ResponseWriter, r *http.Request) {
+	detail, err := s.svc.Players(ctx, r.PathValue("key"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func (s *Server) sendRCON(ctx context.Context, c service.Caller, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target  string `json:"target"`
+		Command string `json:"command"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Target == "" || req.Command == "" {
+		writeError(w, http.StatusBadRequest, "target and command are required")
+		return
+	}
+	results, err := s.svc.SendRCON(ctx, c, req.Target, req.Command)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": rconResults(results)})
+}
+
+func (s *Server) startMatches(ctx context.Context, c service.Caller, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Count int `json:"count"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	output, err := s.svc.StartMatches(ctx, c, req.Count)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"count": req.Count, "output": secret.Redact(output)})
+}
+
+func (s *Server) stopMatches(ctx context.Context, c service.Caller, w http.ResponseWriter, _ *http.Request) {
+	output, err := s.svc.StopMatches(ctx, c)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"output": secret.Redact(output)})
+}
+
+func (s *Server) changeMap(ctx context.Context, c service.Caller, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Map    string `json:"map"`
+		Server string `json:"server"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	results, err := s.svc.ChangeMap(ctx, c, req.Map, req.Server)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"map": req.Map, "results": rconResults(results)})
+}
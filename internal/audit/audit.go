@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/secret"
+)
+
+// Outcomes recorded in Entry.Outcome.
+const (
+	OutcomeOK      = "ok"
+	OutcomePartial = "partial" // some of several targets failed
+	OutcomeDenied  = "denied"
+	OutcomeError   = "error"
+)
+
+// Entry is a single auditable action taken through Ned.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	UserID  string    `json:"user_id,omitempty"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+	Outcome string    `json:"outcome"`
+	DryRun  bool      `json:"dry_run,omitempty"` // nothing actually ran
+}
+
+// Logger records audit entries.
+type Logger interface {
+	Record(e Entry)
+}
+
+// FileLogger appends entries as JSON lines to a file.
+type FileLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileLogger opens (or creates) path for appending.
+func NewFileLogger(path string) (*FileLogger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return &FileLogger{file: f}, nil
+}
+
+// Record writes e as one JSON line. Write failures are logged, not returned,
+// so auditing never blocks a command.
+func (l *FileLogger) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Detail = secret.Redact(e.Detail)
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("encoding audit entry", "err", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		slog.Error("writing audit entry", "err", err)
+	}
+}
+
+// Close closes the underlying file.
+func (l *FileLogger) Close() error {
+	return l.file.Close()
+}
+
+// LogLogger writes entries to the default slog logger. It is used when no
+// audit file is configured.
+type LogLogger struct{}
+
+func (LogLogger) Record(e Entry) {
+	slog.Info("audit",
+		"user", e.User,
+		"user_id", e.UserID,
+		"action", e.Action,
+		"target", e.Target,
+		"outcome", e.Outcome,
+		"detail", secret.Redact(e.Detail),
+		"dry_run", e.DryRun,
+	)
+}
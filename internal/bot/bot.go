@@ -1,71 +1,125 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/api"
 	"github.com/netwarlan/ned/internal/command"
 	"github.com/netwarlan/ned/internal/config"
-	"github.com/netwarlan/ned/internal/executor"
-	"github.com/netwarlan/ned/internal/query"
-	"github.com/netwarlan/ned/internal/rcon"
+	"github.com/netwarlan/ned/internal/dashboard"
+	"github.com/netwarlan/ned/internal/history"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/metrics"
+	"github.com/netwarlan/ned/internal/poller"
+	"github.com/netwarlan/ned/internal/service"
+	"github.com/netwarlan/ned/internal/sessions"
 )
 
 // Bot is the top-level Discord bot that owns the session and command handlers.
 type Bot struct {
 	cfg     *config.Config
-	version string
 	session *discordgo.Session
+	svc     *service.Service
+	router  *command.Router
 
-	serverHandler  *command.ServerHandler
-	cs2Handler     *command.CS2Handler
-	rconHandler    *command.RCONHandler
-	playersHandler *command.PlayersHandler
-	welcomeHandler *command.WelcomeHandler
+	metrics *metrics.Metrics   // nil when metrics.listen is unset
+	history *history.Store     // nil when history.path is unset
+	poller  *poller.Poller     // nil when nothing consumes server polls
+	servers []*http.Server     // optional HTTP listeners
+	cancel  context.CancelFunc // stops background work started by Start
 
 	registeredCommand *discordgo.ApplicationCommand
 }
 
-// New creates a new Bot instance with all dependencies wired up.
-func New(cfg *config.Config, version string) (*Bot, error) {
+// New creates a new Bot instance with all dependencies wired up. With
+// dryRun, scripts and RCON commands are logged instead of run.
+func New(cfg *config.Config, version string, dryRun bool) (*Bot, error) {
 	session, err := discordgo.New("Bot " + cfg.Discord.Token)
 	if err != nil {
 		return nil, err
 	}
 
-	exec := executor.NewShellExecutor(cfg.ResolvedScriptsDir, cfg.Environment)
-	matchExec := executor.NewMatchExecutor(
-		exec,
-		cfg.CS2Matches.Script,
-		cfg.CS2Matches.Pro.MaxInstances,
-	)
-	querier := query.NewA2SQuerier(5 * time.Second)
-	rconClient := rcon.NewGorconClient(10 * time.Second)
+	deps, err := service.DefaultDeps(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		deps.UseDryRun()
+	}
+
+	var observers []poller.Observer
+
+	var m *metrics.Metrics
+	if cfg.Metrics.Listen != "" {
+		m = metrics.New()
+		deps.Executor = m.InstrumentExecutor(deps.Executor)
+		deps.Docker = m.InstrumentExecutor(deps.Docker)
+		deps.RCON = m.InstrumentRCON(deps.RCON)
+		observers = append(observers, m)
+	}
+
+	var hist *history.Store
+	if cfg.History.Path != "" {
+		hist, err = history.Open(cfg.History.Path, cfg.History.Retention)
+		if err != nil {
+			return nil, err
+		}
+		observers = append(observers, hist)
+	}
+
+	var tracker *sessions.Tracker
+	if cfg.Sessions.Path != "" {
+		tracker, err = sessions.Open(cfg.Sessions.Path)
+		if err != nil {
+			return nil, err
+		}
+		observers = append(observers, tracker)
+	}
+
+	var p *poller.Poller
+	if len(observers) > 0 {
+		p = poller.New(cfg, deps.Querier, cfg.PollInterval)
+		for _, o := range observers {
+			p.Add(o)
+		}
+	}
+
+	svc := service.New(cfg, deps)
 
 	return &Bot{
-		cfg:            cfg,
-		version:        version,
-		session:        session,
-		serverHandler:  command.NewServerHandler(cfg, exec, querier),
-		cs2Handler:     command.NewCS2Handler(cfg, matchExec, rconClient),
-		rconHandler:    command.NewRCONHandler(cfg, rconClient),
-		playersHandler: command.NewPlayersHandler(cfg, querier),
-		welcomeHandler: command.NewWelcomeHandler(cfg),
+		cfg:     cfg,
+		session: session,
+		svc:     svc,
+		router:  command.NewRouter(svc, hist, tracker, version),
+		metrics: m,
+		history: hist,
+		poller:  p,
 	}, nil
 }
 
 // Start opens the Discord websocket connection and registers the /ned command.
 func (b *Bot) Start() error {
 	b.session.AddHandler(b.handleInteraction)
+	if b.metrics != nil {
+		b.session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Connect) { b.metrics.SetDiscordConnected(true) })
+		b.session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Resumed) { b.metrics.SetDiscordConnected(true) })
+		b.session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Disconnect) { b.metrics.SetDiscordConnected(false) })
+	}
+
+	b.startBackground()
 
 	if err := b.session.Open(); err != nil {
 		return err
 	}
 
-	cmd := b.buildCommand()
+	cmd := b.router.Command()
 	registered, err := b.session.ApplicationCommandCreate(
 		b.session.State.User.ID,
 		b.cfg.Discord.GuildID,
@@ -75,61 +129,75 @@ func (b *Bot) Start() error {
 		return err
 	}
 	b.registeredCommand = registered
-	log.Printf("Registered command: /%s", cmd.Name)
+	slog.Info("registered command", "name", "/"+cmd.Name)
 
 	return nil
 }
 
+// startBackground launches the server poller and optional HTTP listeners.
+func (b *Bot) startBackground() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+
+	if b.poller != nil {
+		go b.poller.Run(ctx)
+	}
+
+	if b.metrics != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", b.metrics.Registry.Handler())
+		b.serve("metrics", b.cfg.Metrics.Listen, mux)
+	}
+
+	if b.cfg.API.Listen != "" {
+		b.serve("api", b.cfg.API.Listen, api.New(b.svc, api.TokenAuth(b.cfg.API.Tokens)).Handler())
+	}
+
+	if b.cfg.Dashboard.Listen != "" {
+		b.serve("dashboard", b.cfg.Dashboard.Listen, dashboard.New(b.svc).Handler())
+	}
+}
+
+// serve runs an HTTP listener in the background until Stop.
+func (b *Bot) serve(name, addr string, handler http.Handler) {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	b.servers = append(b.servers, srv)
+	go func() {
+		slog.Info("HTTP listener started", "listener", name, "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP listener failed", "listener", name, "addr", addr, "err", err)
+		}
+	}()
+}
+
 // Stop deregisters the slash command and closes the Discord session.
 func (b *Bot) Stop() error {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	for _, srv := range b.servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		srv.Shutdown(ctx)
+		cancel()
+	}
+	if b.history != nil {
+		b.history.Close()
+	}
+
 	if b.registeredCommand != nil {
 		if err := b.session.ApplicationCommandDelete(
 			b.session.State.User.ID,
 			b.cfg.Discord.GuildID,
 			b.registeredCommand.ID,
 		); err != nil {
-			log.Printf("Failed to deregister command: %v", err)
+			slog.Error("deregistering command", "err", err)
 		}
 	}
 	return b.session.Close()
 }
 
-// buildCommand constructs the single /ned command with all subcommands.
-func (b *Bot) buildCommand() *discordgo.ApplicationCommand {
-	opts := []*discordgo.ApplicationCommandOption{}
-	opts = append(opts, b.serverHandler.Subcommands()...)
-	opts = append(opts,
-		b.cs2Handler.MatchSubcommandGroup(),
-		b.rconHandler.Subcommand(),
-		b.playersHandler.Subcommand(),
-		b.welcomeHandler.WelcomeSubcommand(),
-		b.welcomeHandler.TournamentSubcommand(),
-		&discordgo.ApplicationCommandOption{
-			Type:        discordgo.ApplicationCommandOptionSubCommand,
-			Name:        "help",
-			Description: "Show available commands",
-		},
-		&discordgo.ApplicationCommandOption{
-			Type:        discordgo.ApplicationCommandOptionSubCommand,
-			Name:        "ping",
-			Description: "Check if the bot is alive",
-		},
-		&discordgo.ApplicationCommandOption{
-			Type:        discordgo.ApplicationCommandOptionSubCommand,
-			Name:        "version",
-			Description: "Show the running bot version",
-		},
-	)
-
-	return &discordgo.ApplicationCommand{
-		Name:        "ned",
-		Description: "NETWAR Event Discord bot — manage game servers",
-		Options:     opts,
-	}
-}
-
 // formatOptions builds a human-readable string from a command option tree.
-// e.g. "server start service=tf2" or "rcon server=cs2-casual command=status"
+// e.g. "server start service=tf2" or "rcon send target=cs2-casual command=status"
 func formatOptions(opt *discordgo.ApplicationCommandInteractionDataOption) string {
 	var parts []string
 	parts = append(parts, opt.Name)
@@ -144,6 +212,17 @@ func formatOptions(opt *discordgo.ApplicationCommandInteractionDataOption) strin
 	return strings.Join(parts, " ")
 }
 
+// commandPath returns the subcommand names of an option tree, e.g. "match start".
+func commandPath(opt *discordgo.ApplicationCommandInteractionDataOption) string {
+	path := opt.Name
+	for _, child := range opt.Options {
+		if child.Type == discordgo.ApplicationCommandOptionSubCommand ||
+			child.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			return path + " " + commandPath(child)
+		}
+	}
+	return path
+}
 
 func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	if i.Type != discordgo.InteractionApplicationCommand {
@@ -153,64 +232,28 @@ func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCr
 		return
 	}
 
-	sub := i.ApplicationCommandData().Options[0]
-
-	user := "unknown"
-	if i.Member != nil && i.Member.User != nil {
-		user = i.Member.User.Username
-	}
-	log.Printf("[command] user=%s cmd=/ned %s", user, formatOptions(sub))
-
-	switch sub.Name {
-	case "start":
-		b.serverHandler.HandleStart(s, i, sub)
-	case "stop":
-		b.serverHandler.HandleStop(s, i, sub)
-	case "restart":
-		b.serverHandler.HandleRestart(s, i, sub)
-	case "status":
-		b.serverHandler.HandleStatus(s, i, sub)
-	case "match":
-		b.cs2Handler.HandleMatch(s, i, sub)
-	case "rcon":
-		b.rconHandler.Handle(s, i, sub)
-	case "players":
-		b.playersHandler.Handle(s, i, sub)
-	case "welcome":
-		b.welcomeHandler.HandleWelcome(s, i)
-	case "tournament":
-		b.welcomeHandler.HandleTournament(s, i, sub)
-	case "help":
-		help := "**Ned — NETWAR Event Discord Bot**\n" +
-			"```\n" +
-			"/ned start <service>            Start a game server\n" +
-			"/ned stop <service>             Stop a game server\n" +
-			"/ned restart <service>          Restart a game server\n" +
-			"/ned status                     Show all server statuses\n" +
-			"/ned match start <count>        Spin up CS2 match instances\n" +
-			"/ned match stop                 Tear down all match instances\n" +
-			"/ned match map <map> [server]   Change CS2 map via RCON\n" +
-			"/ned rcon <server> <command>    Send RCON command\n" +
-			"/ned players [server]           Show player counts\n" +
-			"/ned welcome                    Post event welcome message\n" +
-			"/ned tournament [matches]       Post CS2 tournament info\n" +
-			"/ned help                       Show this message\n" +
-			"/ned ping                       Pong\n" +
-			"/ned version                    Show bot version\n" +
-			"```"
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{Content: help, Flags: discordgo.MessageFlagsEphemeral},
-		})
-	case "ping":
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{Content: "Pong!"},
-		})
-	case "version":
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{Content: fmt.Sprintf("Ned %s", b.version)},
-		})
-	}
+	in := command.FromDiscord(b.cfg, s, i)
+	sub := in.Command
+
+	// The interaction ID is the correlation ID for everything this command does.
+	logger := slog.Default().With(
+		"interaction_id", i.ID,
+		"user", in.Caller.Name,
+		"user_id", in.Caller.ID,
+		"guild_id", i.GuildID,
+	)
+	ctx := logging.WithLogger(context.Background(), logger)
+	logger.Info("command received", "cmd", "/ned "+formatOptions(sub))
+
+	start := time.Now()
+	defer func() {
+		path := commandPath(sub)
+		outcome := in.Outcome()
+		if b.metrics != nil {
+			b.metrics.Commands.Inc(path, outcome)
+		}
+		logger.Info("command handled", "subcommand", path, "outcome", outcome, "duration", time.Since(start))
+	}()
+
+	b.router.Dispatch(ctx, in)
 }
@@ -0,0 +1,892 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/policy"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// fieldValue returns the value of the named embed field, or "".
+func fieldValue(e *discordgo.MessageEmbed, name string) string {
+	for _, f := range e.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func TestLifecycle(t *testing.T) {
+	tests := []struct {
+		sub, want, ran string
+	}{
+		{"start", "**Starting** TF2...", "tf2/tf2.sh up"},
+		{"stop", "**Stopping** TF2...", "tf2/tf2.sh down"},
+		{"restart", "**Restarting** TF2...", "tf2/tf2.sh restart"},
+	}
+	for _, tt := range tests {
+		env := newTestEnv(t)
+		in, reply := env.run(t, admin, subcommand(tt.sub, str("service", "tf2")))
+		if msg := reply.reply(); msg.Content != tt.want || !msg.Ephemeral {
+			t.Errorf("%s: reply = %+v, want ephemeral %q", tt.sub, msg, tt.want)
+		}
+		if in.Outcome() != OutcomeOK {
+			t.Errorf("%s: outcome = %s", tt.sub, in.Outcome())
+		}
+		if got := env.exec.waitRan(t); got != tt.ran {
+			t.Errorf("%s: ran %q, want %q", tt.sub, got, tt.ran)
+		}
+	}
+}
+
+func TestStop_ShutdownGrace(t *testing.T) {
+	cfg := testConfig()
+	tf2 := cfg.Servers["tf2"]
+	tf2.ShutdownGrace = 1100 * time.Millisecond
+	cfg.Servers["tf2"] = tf2
+
+	env := newTestEnvWith(t, cfg, false)
+	start := time.Now()
+	_, reply := env.run(t, admin, subcommand("stop", str("service", "tf2")))
+	if msg := reply.reply(); msg.Content != "**Stopping** TF2 once players have left, in at most 1.1s..." {
+		t.Errorf("reply = %q", msg.Content)
+	}
+	// tf2 keeps its 3 players, so the whole grace period is waited out.
+	if got := env.exec.waitRanWithin(t, 3*time.Second); got != "tf2/tf2.sh down" {
+		t.Errorf("ran %q", got)
+	}
+	if waited := time.Since(start); waited < 1100*time.Millisecond {
+		t.Errorf("stopped after %s, before the grace period ended", waited)
+	}
+	env.rcon.mu.Lock()
+	sent := strings.Join(env.rcon.sent, "\n")
+	env.rcon.mu.Unlock()
+	if !strings.Contains(sent, "10.0.0.1:27015 say Server shutting down in 1 second") {
+		t.Errorf("RCON sent %q, want a countdown", sent)
+	}
+
+	env = newTestEnvWith(t, cfg, false)
+	env.run(t, admin, subcommand("stop", str("service", "tf2"),
+		&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Value: true}))
+	if got := env.exec.waitRan(t); got != "tf2/tf2.sh down" {
+		t.Errorf("forced stop ran %q", got)
+	}
+	if len(env.rcon.sent) != 0 {
+		t.Errorf("forced stop sent %q, want no warnings", env.rcon.sent)
+	}
+}
+
+func TestStop_ForceEndsDrain(t *testing.T) {
+	cfg := testConfig()
+	tf2 := cfg.Servers["tf2"]
+	tf2.ShutdownGrace = time.Minute
+	cfg.Servers["tf2"] = tf2
+
+	env := newTestEnvWith(t, cfg, false)
+	env.run(t, admin, subcommand("stop", str("service", "tf2")))
+	// The drain has begun once the first warning is sent.
+	deadline := time.Now().Add(time.Second)
+	for {
+		env.rcon.mu.Lock()
+		n := len(env.rcon.sent)
+		env.rcon.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the drain did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	in, reply := env.run(t, volunteer, subcommand("stop", str("service", "tf2"),
+		&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Value: true}))
+	if in.Outcome() != OutcomeOK || reply.reply().Content != "**Stopping** TF2..." {
+		t.Errorf("forced stop: reply = %+v", reply.reply())
+	}
+	if got := env.exec.waitRan(t); got != "tf2/tf2.sh down" {
+		t.Errorf("ran %q", got)
+	}
+	env.audit.mu.Lock()
+	defer env.audit.mu.Unlock()
+	if e := env.audit.entries[0]; e.User != "vic" || e.Action != "down" || !strings.Contains(e.Detail, "ended the shutdown grace") {
+		t.Errorf("audit = %+v, want the forced stop", e)
+	}
+}
+
+func TestStart_AddressConflict(t *testing.T) {
+	cfg := testConfig()
+	cfg.Environment = "event" // MAC VLAN, so a shared IP is a conflict
+	cfg.Servers["mvm"] = config.Server{DisplayName: "MvM", Script: "mvm/mvm.sh", Protocol: "none", Category: "game", IP: "10.0.0.1", Port: 27016}
+
+	env := newTestEnvWith(t, cfg, false)
+	in, reply := env.run(t, admin, subcommand("start", str("service", "mvm")))
+	if in.Outcome() != OutcomeError || !strings.Contains(reply.reply().Content, "shares 10.0.0.1 with TF2, which is online") {
+		t.Errorf("reply = %+v, want a conflict with TF2", reply.reply())
+	}
+	if len(env.exec.ran) != 0 {
+		t.Errorf("ran %q despite the conflict", env.exec.ran)
+	}
+
+	in, reply = env.run(t, admin, subcommand("start", str("service", "mvm"),
+		&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Value: true}))
+	if msg := reply.reply(); msg.Content != "**Starting** MvM..." {
+		t.Errorf("forced start: reply = %q", msg.Content)
+	}
+	if got := env.exec.waitRan(t); got != "mvm/mvm.sh up" {
+		t.Errorf("forced start ran %q", got)
+	}
+}
+
+func TestStart_UnknownPeer(t *testing.T) {
+	// A UDP-only server refuses a TCP probe whether it is running or not.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cfg := testConfig()
+	cfg.Environment = "event"
+	cfg.Servers["palworld"] = config.Server{DisplayName: "Palworld", Script: "palworld/palworld.sh", Protocol: "none", Category: "game", IP: "127.0.0.1", Port: port}
+	cfg.Servers["mvm"] = config.Server{DisplayName: "MvM", Script: "mvm/mvm.sh", Protocol: "none", Category: "game", IP: "127.0.0.1", Port: 27016}
+	cfg.Servers["cs16"] = config.Server{DisplayName: "CS 1.6", Script: "cs16/cs16.sh", Protocol: "source", Category: "game", IP: "10.0.0.8", Port: 27015, QueryPort: 27015}
+	cfg.Servers["gmod"] = config.Server{DisplayName: "Garry's Mod", Script: "gmod/gmod.sh", Protocol: "none", Category: "game", IP: "10.0.0.8", Port: 27016}
+	cfg.Servers["l4d2"] = config.Server{DisplayName: "L4D2", Script: "l4d2/l4d2.sh", Protocol: "none", Category: "game", IP: "10.0.0.2", ConflictsWith: []string{"tf2"}}
+
+	env := newTestEnvWith(t, cfg, false)
+	in, reply := env.run(t, admin, subcommand("start", str("service", "mvm")))
+	if in.Outcome() != OutcomeError || !strings.Contains(reply.reply().Content, "shares 127.0.0.1 with Palworld, which Ned cannot check") {
+		t.Errorf("reply = %+v, want Palworld's state unknown", reply.reply())
+	}
+	if len(env.exec.ran) != 0 {
+		t.Errorf("ran %q despite the unknown peer", env.exec.ran)
+	}
+
+	env.run(t, admin, subcommand("start", str("service", "mvm"),
+		&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Value: true}))
+	if got := env.exec.waitRan(t); got != "mvm/mvm.sh up" {
+		t.Errorf("forced start ran %q", got)
+	}
+
+	// A query that runs out of time says nothing about the peer.
+	env.exec.ran = nil
+	in, reply = env.run(t, admin, subcommand("start", str("service", "gmod")))
+	if in.Outcome() != OutcomeError || !strings.Contains(reply.reply().Content, "shares 10.0.0.8 with CS 1.6, which Ned cannot check") {
+		t.Errorf("reply = %+v, want CS 1.6's state unknown", reply.reply())
+	}
+	if len(env.exec.ran) != 0 {
+		t.Errorf("ran %q despite the unknown peer", env.exec.ran)
+	}
+
+	// conflicts_with applies on any address.
+	in, reply = env.run(t, admin, subcommand("start", str("service", "l4d2")))
+	if in.Outcome() != OutcomeError || !strings.Contains(reply.reply().Content, "L4D2 conflicts with TF2, which is online") {
+		t.Errorf("reply = %+v, want a conflict with TF2", reply.reply())
+	}
+}
+
+func TestLifecycle_Bulk(t *testing.T) {
+	cfg := testConfig()
+	cfg.Servers["dns"] = config.Server{DisplayName: "DNS", Script: "dns/dns.sh", Protocol: "none", Category: "infra"}
+
+	env := newTestEnvWith(t, cfg, false)
+	in, reply := env.run(t, admin, subcommand("start", str("target", "all")))
+	msg := reply.reply()
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("reply = %+v, want a summary embed", msg)
+	}
+	embed := msg.Embeds[0]
+	if embed.Title != "Start all servers" {
+		t.Errorf("title = %q", embed.Title)
+	}
+	for _, name := range []string{"DNS", "Rust", "TF2"} {
+		if !strings.Contains(embed.Description, name) {
+			t.Errorf("summary %q is missing %s", embed.Description, name)
+		}
+	}
+	if in.Outcome() != OutcomeOK {
+		t.Errorf("outcome = %s", in.Outcome())
+	}
+	// Infra is started on its own before the game servers.
+	if len(env.exec.ran) != 3 || env.exec.ran[0] != "dns/dns.sh up" {
+		t.Errorf("ran %q, want dns first", env.exec.ran)
+	}
+	if e := env.audit.last(t); e.Action != "bulk up" || e.Outcome != "ok" {
+		t.Errorf("audit = %+v", e)
+	}
+
+	env = newTestEnvWith(t, cfg, false)
+	env.run(t, admin, subcommand("stop", str("target", "game"), &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Value: true}))
+	if len(env.exec.ran) != 2 {
+		t.Errorf("ran %q, want only the game servers", env.exec.ran)
+	}
+
+	env = newTestEnvWith(t, cfg, false)
+	in, reply = env.run(t, admin, subcommand("restart", str("service", "tf2"), str("target", "game")))
+	if in.Outcome() != OutcomeError || !strings.Contains(reply.reply().Content, "not both") {
+		t.Errorf("service and target: reply = %+v", reply.reply())
+	}
+}
+
+func TestLifecycle_BulkOrder(t *testing.T) {
+	cfg := testConfig()
+	cfg.Servers["stats"] = config.Server{DisplayName: "Stats", Script: "stats/stats.sh", Protocol: "none", Category: "game", DependsOn: []string{"rust"}}
+	cfg.Servers["mvm"] = config.Server{DisplayName: "MvM", Script: "mvm/mvm.sh", Protocol: "none", Category: "game", ConflictsWith: []string{"tf2"}}
+	force := &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "force", Value: true}
+
+	env := newTestEnvWith(t, cfg, false)
+	in, reply := env.run(t, admin, subcommand("start", str("target", "all"), force))
+	ran := env.exec.ran
+	if i, j := slices.Index(ran, "rust/rust.sh up"), slices.Index(ran, "stats/stats.sh up"); i < 0 || j < i {
+		t.Errorf("ran %q, want rust before stats", ran)
+	}
+	// MvM and TF2 conflict, so TF2 waits for MvM and is then skipped.
+	if !slices.Contains(ran, "mvm/mvm.sh up") || slices.Contains(ran, "tf2/tf2.sh up") {
+		t.Errorf("ran %q, want MvM started and TF2 skipped", ran)
+	}
+	if desc := reply.reply().Embeds[0].Description; !strings.Contains(desc, "skipped: TF2 cannot run alongside MvM") {
+		t.Errorf("summary = %q", desc)
+	}
+	if e := env.audit.last(t); in.Outcome() != OutcomeError || e.Outcome != "partial" || e.Detail != "failed: tf2" {
+		t.Errorf("outcome = %s, audit = %+v", in.Outcome(), e)
+	}
+
+	env = newTestEnvWith(t, cfg, false)
+	env.run(t, admin, subcommand("stop", str("target", "all"), force))
+	ran = env.exec.ran
+	if i, j := slices.Index(ran, "stats/stats.sh down"), slices.Index(ran, "rust/rust.sh down"); i < 0 || j < i {
+		t.Errorf("ran %q, want stats stopped before rust", ran)
+	}
+	if len(ran) != 4 {
+		t.Errorf("ran %q, want every server stopped", ran)
+	}
+}
+
+func TestProfileApply(t *testing.T) {
+	cfg := testConfig()
+	cfg.Servers["connect"] = config.Server{DisplayName: "Connect", Script: "connect/connect.sh", Protocol: "none", Category: "infra"}
+	tf2 := cfg.Servers["tf2"]
+	tf2.DependsOn = []string{"connect"}
+	cfg.Servers["tf2"] = tf2
+	rust := cfg.Servers["rust"]
+	rust.ConflictsWith = []string{"tf2"}
+	rust.RCONPort = 0 // nothing to probe
+	cfg.Servers["rust"] = rust
+	cfg.Profiles = map[string][]string{"day1": {"tf2"}}
+
+	// A server that does not speak A2S is probed over TCP.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	cfg.Servers["tftp"] = config.Server{DisplayName: "TFTP", Script: "tftp/tftp.sh", Protocol: "none", Category: "infra", IP: "127.0.0.1", RCONPort: l.Addr().(*net.TCPAddr).Port}
+
+	env := newTestEnvWith(t, cfg, false)
+	in, reply := env.run(t, admin, group("profile", subcommand("apply", str("name", "day1"))))
+	if in.Outcome() != OutcomeOK {
+		t.Errorf("outcome = %s", in.Outcome())
+	}
+	// tf2 is already online and TFTP answers, so it is stopped. Rust's state
+	// is unknown, so it is stopped because it conflicts with tf2, and tf2's
+	// dependency is started.
+	if plan := reply.replies[0].Content; !strings.Contains(plan, "Stop: Rust, TFTP\nStart: Connect\nAlready running: TF2\nState unknown: Connect, Rust") {
+		t.Errorf("plan = %q", plan)
+	}
+	slices.Sort(env.exec.ran[:2]) // stopped together
+	if want := []string{"rust/rust.sh down", "tftp/tftp.sh down", "connect/connect.sh up"}; strings.Join(env.exec.ran, ",") != strings.Join(want, ",") {
+		t.Errorf("ran %q, want %q", env.exec.ran, want)
+	}
+	if embed := reply.embed(); embed.Title != "Profile day1" || !strings.Contains(embed.Description, "started in") {
+		t.Errorf("summary = %+v", embed)
+	}
+	if e := env.audit.last(t); e.Action != "profile apply" || e.Outcome != "ok" {
+		t.Errorf("audit = %+v", e)
+	}
+
+	env = newTestEnvWith(t, cfg, false)
+	in, reply = env.run(t, admin, group("profile", subcommand("apply", str("name", "day9"))))
+	if in.Outcome() != OutcomeError || !strings.Contains(reply.reply().Content, "Unknown profile") {
+		t.Errorf("unknown profile: reply = %+v", reply.reply())
+	}
+}
+
+func TestLifecycle_UnknownServer(t *testing.T) {
+	env := newTestEnv(t)
+	in, reply := env.run(t, admin, subcommand("start", str("service", "nope")))
+	if msg := reply.reply(); !strings.HasPrefix(msg.Content, "**Error:**") || !msg.Ephemeral {
+		t.Errorf("reply = %+v", msg)
+	}
+	if in.Outcome() != OutcomeError {
+		t.Errorf("outcome = %s, want error", in.Outcome())
+	}
+}
+
+func TestStatus_Board(t *testing.T) {
+	env := newTestEnv(t)
+	_, reply := env.run(t, admin, subcommand("status"))
+	embed := reply.embed()
+	games := fieldValue(embed, "Game Servers")
+	if !strings.Contains(games, "ctf_2fort") || !strings.Contains(games, "3/24") || !strings.Contains(games, "Rust") {
+		t.Errorf("Game Servers = %q", games)
+	}
+	if matches := fieldValue(embed, "CS2 Matches"); !strings.Contains(matches, "Offline") {
+		t.Errorf("CS2 Matches = %q", matches)
+	}
+}
+
+func TestStatus_Single(t *testing.T) {
+	env := newTestEnv(t)
+	_, reply := env.run(t, admin, subcommand("status", str("service", "tf2")))
+	embed := reply.embed()
+	if embed.Title != "TF2" || fieldValue(embed, "Status") != "Online" || fieldValue(embed, "Address") != "`10.0.0.1:27015`" {
+		t.Errorf("embed = %+v", embed)
+	}
+	if players := fieldValue(embed, "Connected Players"); !strings.Contains(players, "alice") {
+		t.Errorf("Connected Players = %q", players)
+	}
+
+	_, reply = env.run(t, admin, subcommand("status", str("service", "rust")))
+	if got := fieldValue(reply.embed(), "Status"); got != "Not queryable" {
+		t.Errorf("rust Status = %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, reply := env.run(t, admin, group("match", subcommand("start", num("count", 2))))
+	if msg := reply.reply(); !strings.HasPrefix(msg.Content, "**Started 2 CS2 match server(s)**") || !strings.Contains(msg.Content, "done") {
+		t.Errorf("start reply = %q", msg.Content)
+	}
+	if env.exec.ran[0] != "cs2/cs2.sh match up --count 2" {
+		t.Errorf("ran %q", env.exec.ran[0])
+	}
+
+	_, reply = env.run(t, admin, group("match", subcommand("stop")))
+	if msg := reply.reply(); !strings.HasPrefix(msg.Content, "**Stopped all CS2 match servers**") {
+		t.Errorf("stop reply = %q", msg.Content)
+	}
+
+	in, reply := env.run(t, admin, group("match", subcommand("start", num("count", 9))))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "count must be 1-2") || in.Outcome() != OutcomeError {
+		t.Errorf("count 9: reply = %q, outcome %s", msg.Content, in.Outcome())
+	}
+}
+
+func TestMatchMap(t *testing.T) {
+	env := newTestEnv(t)
+	_, reply := env.run(t, admin, group("match", subcommand("map", str("map_name", "de_dust2"), str("server", "match-pro-1"))))
+	msg := reply.reply()
+	if !strings.Contains(msg.Content, "CS2 Match Pro 1: changed to `de_dust2`") || !msg.Ephemeral {
+		t.Errorf("reply = %+v", msg)
+	}
+
+	in, reply := env.run(t, volunteer, group("match", subcommand("map", str("map_name", "de_dust2"))))
+	if msg := reply.reply(); !strings.HasPrefix(msg.Content, "**Denied:**") || in.Outcome() != OutcomeDenied {
+		t.Errorf("volunteer: reply = %q, outcome %s", msg.Content, in.Outcome())
+	}
+}
+
+func TestRCONSend(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, reply := env.run(t, admin, group("rcon", subcommand("send", str("target", "tf2"), str("command", "status"))))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "ran status") || !msg.Ephemeral {
+		t.Errorf("single server reply = %+v", msg)
+	}
+	if e := env.audit.last(t); e.Outcome != "ok" || e.Detail != "status" {
+		t.Errorf("single server audit = %+v", e)
+	}
+
+	_, reply = env.run(t, admin, group("rcon", subcommand("send", str("target", "game"), str("command", "status"))))
+	msg := reply.reply().Content
+	if !strings.Contains(msg, "Rust") || !strings.Contains(msg, "FAIL") || !strings.Contains(msg, "**1 of 2 failed**") {
+		t.Errorf("category reply = %q", msg)
+	}
+	// The audit entry follows the broadcast and names the server that failed.
+	if e := env.audit.last(t); e.Outcome != "partial" || e.Detail != "status; failed: rust" {
+		t.Errorf("category audit = %+v", e)
+	}
+
+	in, reply := env.run(t, volunteer, group("rcon", subcommand("send", str("target", "tf2"), str("command", "quit"))))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "`quit` is not permitted for your roles on: TF2") || in.Outcome() != OutcomeDenied {
+		t.Errorf("denied reply = %q, outcome %s", msg.Content, in.Outcome())
+	}
+}
+
+func TestRCONRotate_RequiresWritableSecret(t *testing.T) {
+	env := newTestEnv(t)
+	in, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "tf2"))))
+	msg := reply.reply()
+	if !strings.Contains(msg.Content, "Cannot rotate RCON passwords") || !strings.Contains(msg.Content, "not a file: or secret: reference") {
+		t.Errorf("reply = %q", msg.Content)
+	}
+	if in.Outcome() != OutcomeError {
+		t.Errorf("outcome = %s", in.Outcome())
+	}
+}
+
+// newRotateEnv loads a config whose TF2 password is in its own file and
+// whose two CS2 servers share one, and serves it over rc, which starts out
+// accepting those passwords. It returns the directory of password files.
+func newRotateEnv(t *testing.T, rc *passwordRCON) (*testEnv, string) {
+	t.Helper()
+	return newRotateEnvWith(t, rc, 0, nil)
+}
+
+// onlineQuerier is fakeQuerier with more addresses online.
+type onlineQuerier struct {
+	fakeQuerier
+	online map[string]bool
+}
+
+func (q onlineQuerier) QueryStatus(ctx context.Context, address string) (*query.ServerStatus, error) {
+	if q.online[address] {
+		return &query.ServerStatus{Online: true}, nil
+	}
+	return q.fakeQuerier.QueryStatus(ctx, address)
+}
+
+// newRotateEnvWith is newRotateEnv with n CS2 match instances at 10.0.2.1
+// onwards, whose password is in the file "match". Of those, the instances
+// whose query address is in online are running and accept it.
+func newRotateEnvWith(t *testing.T, rc *passwordRCON, n int, online map[string]bool) (*testEnv, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, pw := range map[string]string{"tf2": "tf2-old-pass", "cs2": "cs2-old-pass", "match": "match-old-pass"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(pw+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := func(key, name, ip, ref string) string {
+		return fmt.Sprintf(`  %s:
+    display_name: %q
+    script: "%s/%s.sh"
+    protocol: "none"
+    category: "game"
+    rcon_password: "file:%s"
+    local:
+      ip: %q
+      rcon_port: 27015
+`, key, name, key, key, filepath.Join(dir, ref), ip)
+	}
+	matches := fmt.Sprintf(`cs2_matches:
+  script: "cs2/cs2.sh"
+  rcon_password: "file:%s"
+  rcon_port: 27015
+  query_port: 27015
+  protocol: "source"
+  pro:
+    max_instances: %d
+    ip_base: "10.0.2.0"
+    display_prefix: "CS2 Match Pro"
+`, filepath.Join(dir, "match"), n)
+	yaml := fmt.Sprintf("environment: \"local\"\nscripts_dir:\n  local: %q\n", dir) + matches + "servers:\n" +
+		server("tf2", "TF2", "10.0.0.1", "tf2") + server("cs2a", "CS2 A", "10.0.0.2", "cs2") + server("cs2b", "CS2 B", "10.0.0.3", "cs2")
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadWith(path, config.Options{Local: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc.passwords = map[string]string{"10.0.0.1:27015": "tf2-old-pass", "10.0.0.2:27015": "cs2-old-pass", "10.0.0.3:27015": "cs2-old-pass"}
+	for addr := range online {
+		rc.passwords[addr] = "match-old-pass"
+	}
+	pol, err := policy.NewRCONPolicy(config.RCONPolicyConfig{Default: map[string]config.RCONRule{"admin": {Allow: []string{".*"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordingAudit{}
+	svc := service.New(cfg, service.Deps{Executor: &fakeExecutor{}, Querier: onlineQuerier{online: online}, RCON: rc, Policy: pol, Audit: rec})
+	return &testEnv{cfg: cfg, router: NewRouter(svc, nil, nil, "v1.2.3"), audit: rec}, dir
+}
+
+// readPassword returns the password persisted in dir/name.
+func readPassword(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestRCONRotate(t *testing.T) {
+	rc := &passwordRCON{}
+	env, dir := newRotateEnv(t, rc)
+
+	in, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "tf2"))))
+	if msg := reply.reply().Content; msg != "**RCON password rotation**\nTF2: rotated" || in.Outcome() != OutcomeOK {
+		t.Errorf("reply = %q, outcome %s", msg, in.Outcome())
+	}
+	pw := readPassword(t, dir, "tf2")
+	if pw == "tf2-old-pass" || len(pw) != 24 || rc.password("10.0.0.1:27015") != pw {
+		t.Errorf("persisted %q, server has %q", pw, rc.password("10.0.0.1:27015"))
+	}
+	if got := env.cfg.RCONPassword("tf2"); got != pw {
+		t.Errorf("Ned uses %q, want the new password", got)
+	}
+	if readPassword(t, dir, "cs2") != "cs2-old-pass" || rc.password("10.0.0.2:27015") != "cs2-old-pass" {
+		t.Error("rotating TF2 changed the CS2 password")
+	}
+}
+
+func TestRCONRotate_SlowServer(t *testing.T) {
+	// TF2 still refuses the first login after taking the new password.
+	rc := &passwordRCON{slow: map[string]bool{"10.0.0.1:27015": true}}
+	env, dir := newRotateEnv(t, rc)
+
+	_, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "tf2"))))
+	if msg := reply.reply().Content; msg != "**RCON password rotation**\nTF2: rotated" {
+		t.Errorf("reply = %q, want the reconnect retried", msg)
+	}
+	if pw := readPassword(t, dir, "tf2"); pw == "tf2-old-pass" || rc.password("10.0.0.1:27015") != pw {
+		t.Errorf("persisted %q, server has %q", pw, rc.password("10.0.0.1:27015"))
+	}
+}
+
+func TestRCONRotate_SharedSecret(t *testing.T) {
+	rc := &passwordRCON{}
+	env, dir := newRotateEnv(t, rc)
+
+	// A shared reference is rotated across its whole group.
+	_, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "cs2a"))))
+	if msg := reply.reply().Content; !strings.Contains(msg, "shares its password with CS2 B") {
+		t.Errorf("partial group: reply = %q", msg)
+	}
+
+	_, reply = env.run(t, admin, group("rcon", subcommand("rotate", str("target", "all"))))
+	if msg := reply.reply().Content; msg != "**RCON password rotation**\nCS2 A: rotated\nCS2 B: rotated\nTF2: rotated" {
+		t.Errorf("reply = %q", msg)
+	}
+	pw := readPassword(t, dir, "cs2")
+	if pw == "cs2-old-pass" || rc.password("10.0.0.2:27015") != pw || rc.password("10.0.0.3:27015") != pw {
+		t.Errorf("persisted %q, servers have %q and %q", pw, rc.password("10.0.0.2:27015"), rc.password("10.0.0.3:27015"))
+	}
+	if pw == readPassword(t, dir, "tf2") {
+		t.Error("separate references were given the same password")
+	}
+}
+
+func TestRCONRotate_VerifyFailureRollsBack(t *testing.T) {
+	// CS2 B takes the command but keeps its password, so verifying fails.
+	rc := &passwordRCON{ignore: map[string]bool{"10.0.0.3:27015": true}}
+	env, dir := newRotateEnv(t, rc)
+
+	in, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "all"))))
+	msg := reply.reply().Content
+	if !strings.Contains(msg, "CS2 A, CS2 B: **failed** (verifying on CS2 B") || !strings.Contains(msg, "  CS2 A: still on old password\n  CS2 B: still on old password") {
+		t.Errorf("reply = %q", msg)
+	}
+	if !strings.Contains(msg, "TF2: rotated") {
+		t.Errorf("TF2 was not rotated on its own: %q", msg)
+	}
+	if rc.password("10.0.0.2:27015") != "cs2-old-pass" || readPassword(t, dir, "cs2") != "cs2-old-pass" {
+		t.Errorf("CS2 A has %q, file has %q, want both rolled back", rc.password("10.0.0.2:27015"), readPassword(t, dir, "cs2"))
+	}
+	if e := env.audit.last(t); in.Outcome() != OutcomeError || e.Outcome != "partial" || e.Detail != "failed: cs2a, cs2b" {
+		t.Errorf("outcome = %s, audit = %+v", in.Outcome(), e)
+	}
+}
+
+func TestRCONRotate_StuckOnNew(t *testing.T) {
+	// CS2 A takes the new password but not the old one back.
+	rc := &passwordRCON{
+		ignore: map[string]bool{"10.0.0.3:27015": true},
+		sticky: map[string]bool{"10.0.0.2:27015": true},
+	}
+	env, dir := newRotateEnv(t, rc)
+
+	_, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "all"))))
+	msg := reply.reply().Content
+	if !strings.Contains(msg, "  CS2 A: **stuck on new password**") || !strings.Contains(msg, "  CS2 B: still on old password") {
+		t.Errorf("reply = %q", msg)
+	}
+	stuck := rc.password("10.0.0.2:27015")
+	if stuck == "cs2-old-pass" {
+		t.Fatal("CS2 A never took the new password")
+	}
+	// Ned keeps reaching CS2 A with the new password, but does not persist it.
+	if env.cfg.RCONPassword("cs2a") != stuck || env.cfg.RCONPassword("cs2b") != "cs2-old-pass" {
+		t.Errorf("Ned uses %q and %q", env.cfg.RCONPassword("cs2a"), env.cfg.RCONPassword("cs2b"))
+	}
+	if readPassword(t, dir, "cs2") != "cs2-old-pass" {
+		t.Error("the new password was persisted")
+	}
+}
+
+func TestRCONRotate_OfflineMatches(t *testing.T) {
+	// Matches 1 and 3 are running; match 2 was never started.
+	rc := &passwordRCON{}
+	env, dir := newRotateEnvWith(t, rc, 3, map[string]bool{"10.0.2.1:27015": true, "10.0.2.3:27015": true})
+
+	in, reply := env.run(t, admin, group("rcon", subcommand("rotate", str("target", "all-matches"))))
+	msg := reply.reply().Content
+	if want := "**RCON password rotation**\nCS2 Match Pro 1: rotated\nCS2 Match Pro 3: rotated\nCS2 Match Pro 2: offline, skipped; start it with the new password"; msg != want || in.Outcome() != OutcomeOK {
+		t.Errorf("reply = %q, outcome %s", msg, in.Outcome())
+	}
+	pw := readPassword(t, dir, "match")
+	if pw == "match-old-pass" || rc.password("10.0.2.1:27015") != pw || rc.password("10.0.2.3:27015") != pw {
+		t.Errorf("persisted %q, matches have %q and %q", pw, rc.password("10.0.2.1:27015"), rc.password("10.0.2.3:27015"))
+	}
+	if got := env.cfg.RCONPassword("match-pro-2"); got != pw {
+		t.Errorf("Ned uses %q for match 2, want the saved password", got)
+	}
+	if e := env.audit.last(t); e.Outcome != "ok" || e.Detail != "skipped offline: match-pro-2" {
+		t.Errorf("audit = %+v", e)
+	}
+}
+
+func TestPlayers(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, reply := env.run(t, admin, subcommand("players"))
+	embed := reply.embed()
+	if embed.Title != "NETWAR Players (3 total)" || !strings.Contains(embed.Description, "TF2") {
+		t.Errorf("all servers embed = %+v", embed)
+	}
+
+	_, reply = env.run(t, admin, subcommand("players", str("server", "tf2")))
+	if players := fieldValue(reply.embed(), "Connected Players"); !strings.Contains(players, "alice") {
+		t.Errorf("Connected Players = %q", players)
+	}
+
+	in, reply := env.run(t, admin, subcommand("players", str("server", "match-pro-1")))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "offline or unreachable") || in.Outcome() != OutcomeError {
+		t.Errorf("offline server: reply = %q, outcome %s", msg.Content, in.Outcome())
+	}
+}
+
+func TestLogs(t *testing.T) {
+	env := newTestEnv(t)
+	env.exec.output = "starting\nerror: map not found\nretrying\nerror: map not found\n"
+
+	_, reply := env.run(t, admin, subcommand("logs", str("service", "tf2"), num("lines", 1), str("grep", "^error")))
+	msg := reply.reply()
+	if !msg.Ephemeral || !strings.Contains(msg.Content, "last 1 line(s)") || !strings.Contains(msg.Content, "```\nerror: map not found\n```") {
+		t.Errorf("reply = %+v, want one ephemeral line inline", msg)
+	}
+	if got := env.exec.ran[0]; got != "tf2/tf2.sh logs" {
+		t.Errorf("ran %q, want the logs verb", got)
+	}
+
+	env.exec.output = strings.Repeat("L 10/18/2026 - 20:00:00: a line of server output\n", 100)
+	_, reply = env.run(t, admin, subcommand("logs", str("service", "tf2"),
+		&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionBoolean, Name: "public", Value: true}))
+	msg = reply.reply()
+	if msg.Ephemeral || len(msg.Files) != 1 || msg.Files[0].Name != "tf2.log" {
+		t.Errorf("reply = %+v, want a public reply with tf2.log attached", msg)
+	}
+
+	in, reply := env.run(t, admin, subcommand("logs", str("service", "rust")))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "no logs_verb configured") || in.Outcome() != OutcomeError {
+		t.Errorf("rust: reply = %q, outcome %s", msg.Content, in.Outcome())
+	}
+
+	in, reply = env.run(t, admin, subcommand("logs", str("service", "tf2"), str("since", "yesterday")))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "Invalid since") || in.Outcome() != OutcomeError {
+		t.Errorf("bad since: reply = %q, outcome %s", msg.Content, in.Outcome())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	env := newTestEnv(t)
+
+	in, reply := env.run(t, admin, subcommand("update", str("service", "tf2")))
+	if msg := reply.reply(); msg.Content != "TF2: updated in 0s and restarted" || !msg.Ephemeral {
+		t.Errorf("reply = %+v", msg)
+	}
+	if in.Outcome() != OutcomeOK {
+		t.Errorf("outcome = %s", in.Outcome())
+	}
+	want := []string{"tf2/tf2.sh down", "tf2/tf2.sh update", "tf2/tf2.sh up"}
+	if strings.Join(env.exec.ran, ",") != strings.Join(want, ",") {
+		t.Errorf("ran %q, want %q", env.exec.ran, want)
+	}
+	if len(reply.replies) < 4 || !strings.Contains(reply.replies[0].Content, "TF2: warned 3 player(s)") {
+		t.Errorf("progress = %+v, want the warning first", reply.replies)
+	}
+	// Steps accumulate in the one deferred reply.
+	if p := reply.replies[2].Content; !strings.HasPrefix(p, "**Updating...**\nTF2: warned") || !strings.HasSuffix(p, "TF2: updating, this can take a while") {
+		t.Errorf("progress = %q, want every step so far", p)
+	}
+
+	// Rust cannot be queried, so it might be running: it is stopped and
+	// started again around the update.
+	env = newTestEnv(t)
+	_, reply = env.run(t, admin, subcommand("update", str("service", "rust")))
+	if msg := reply.reply().Content; msg != "Rust: updated in 0s and started again (status unknown, so it was treated as running)" {
+		t.Errorf("unknown status: reply = %q", msg)
+	}
+	want = []string{"rust/rust.sh down", "rust/rust.sh update", "rust/rust.sh up"}
+	if strings.Join(env.exec.ran, ",") != strings.Join(want, ",") {
+		t.Errorf("unknown status: ran %q, want %q", env.exec.ran, want)
+	}
+
+	env = newTestEnv(t)
+	_, reply = env.run(t, admin, subcommand("update", str("service", "all")))
+	msg := reply.reply().Content
+	if !strings.Contains(msg, "TF2: skipped, 3 player(s) online") || !strings.Contains(msg, "Rust: skipped, status unknown") {
+		t.Errorf("reply = %q", msg)
+	}
+	if len(env.exec.ran) != 0 {
+		t.Errorf("ran %q, want nothing for busy or unknown servers", env.exec.ran)
+	}
+}
+
+func TestStats(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, reply := env.run(t, admin, subcommand("stats"))
+	embed := reply.embed()
+	if !strings.HasPrefix(embed.Title, "NETWAR Player Stats — last 24h") || !strings.Contains(embed.Description, "peak 12") {
+		t.Errorf("overview = %+v", embed)
+	}
+	if got := fieldValue(embed, "Peak Concurrent Players"); !strings.HasPrefix(got, "12 across all servers") {
+		t.Errorf("peak concurrency = %q", got)
+	}
+
+	_, reply = env.run(t, admin, subcommand("stats", str("server", "tf2"), str("window", "6h")))
+	embed = reply.embed()
+	if embed.Title != "TF2 — last 6h" || !strings.HasPrefix(fieldValue(embed, "Peak"), "12 ") {
+		t.Errorf("server embed = %+v", embed)
+	}
+
+	_, reply = env.run(t, admin, subcommand("stats", str("window", "1h"), str("server", "rust")))
+	if msg := reply.reply(); msg.Content != "No player history recorded in the last 1h." {
+		t.Errorf("empty window reply = %q", msg.Content)
+	}
+
+	in, reply := env.run(t, admin, subcommand("stats", str("window", "2w")))
+	if msg := reply.reply(); !strings.Contains(msg.Content, `Unknown window "2w"`) || in.Outcome() != OutcomeError {
+		t.Errorf("bad window reply = %q", msg.Content)
+	}
+}
+
+func TestWhoisAndSeen(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, reply := env.run(t, admin, subcommand("whois", str("player", "ALICE")))
+	embed := reply.embed()
+	if embed.Title != "alice" || !strings.Contains(fieldValue(embed, "Now"), "TF2") {
+		t.Errorf("whois embed = %+v", embed)
+	}
+
+	_, reply = env.run(t, admin, subcommand("seen", str("player", "bob")))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "`bob` is on **TF2** right now") {
+		t.Errorf("seen reply = %q", msg.Content)
+	}
+
+	_, reply = env.run(t, admin, subcommand("seen", str("player", "ali")))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "Several players match") || !msg.Ephemeral {
+		t.Errorf("ambiguous reply = %+v", msg)
+	}
+
+	_, reply = env.run(t, admin, subcommand("whois", str("player", "zed")))
+	if msg := reply.reply(); msg.Content != "No player matching `zed` has been seen." {
+		t.Errorf("unknown reply = %q", msg.Content)
+	}
+}
+
+func TestTrackingDisabled(t *testing.T) {
+	env := newTestEnvWith(t, testConfig(), false)
+	for _, cmd := range []string{"stats", "whois", "seen"} {
+		in, reply := env.run(t, admin, subcommand(cmd, str("player", "alice")))
+		if msg := reply.reply(); !strings.Contains(msg.Content, "disabled") || in.Outcome() != OutcomeError {
+			t.Errorf("%s: reply = %q, outcome %s", cmd, msg.Content, in.Outcome())
+		}
+	}
+}
+
+func TestWelcomeAndTournament(t *testing.T) {
+	env := newTestEnv(t)
+	in, reply := env.run(t, admin, subcommand("welcome"))
+	if msg := reply.reply(); !strings.Contains(msg.Content, "No welcome message configured") || in.Outcome() != OutcomeError {
+		t.Errorf("unconfigured welcome: reply = %q", msg.Content)
+	}
+
+	cfg := testConfig()
+	cfg.Welcome.Sections = []config.WelcomeSection{{Title: "Rules", Text: "Be nice."}}
+	env = newTestEnvWith(t, cfg, false)
+	_, reply = env.run(t, admin, subcommand("welcome"))
+	if msg := reply.reply(); msg.Content != "**Rules**\nBe nice.\n" || msg.Ephemeral {
+		t.Errorf("welcome reply = %+v", msg)
+	}
+
+	_, reply = env.run(t, admin, subcommand("tournament", num("matches", 1)))
+	msg := reply.reply().Content
+	if !strings.HasPrefix(msg, "**CS2 Tournament**") || !strings.Contains(msg, "MATCH 1") || strings.Contains(msg, "MATCH 2") {
+		t.Errorf("tournament reply = %q", msg)
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	env := newTestEnv(t)
+	tests := []struct {
+		sub, want string
+		ephemeral bool
+	}{
+		{"ping", "Pong!", false},
+		{"version", "Ned v1.2.3", false},
+		{"help", "/ned whois <player>", true},
+		{"bogus", "**Error:** Unknown command: bogus", true},
+	}
+	for _, tt := range tests {
+		_, reply := env.run(t, admin, subcommand(tt.sub))
+		if msg := reply.reply(); !strings.Contains(msg.Content, tt.want) || msg.Ephemeral != tt.ephemeral {
+			t.Errorf("%s: reply = %+v", tt.sub, msg)
+		}
+	}
+}
+
+func TestCommand_FitsDiscordLimits(t *testing.T) {
+	cmd := newTestEnv(t).router.Command()
+	if len(cmd.Options) > 25 {
+		t.Errorf("/ned has %d subcommands, Discord allows 25", len(cmd.Options))
+	}
+	var check func(opts []*discordgo.ApplicationCommandOption)
+	check = func(opts []*discordgo.ApplicationCommandOption) {
+		for _, o := range opts {
+			if len(o.Choices) > maxChoices {
+				t.Errorf("option %s has %d choices", o.Name, len(o.Choices))
+			}
+			check(o.Options)
+		}
+	}
+	check(cmd.Options)
+}
+
+func TestDryRun(t *testing.T) {
+	deps := service.Deps{Querier: fakeQuerier{}, Audit: discardAudit{}}
+	deps.UseDryRun()
+	env := &testEnv{router: NewRouter(service.New(testConfig(), deps), nil, nil, "v1.2.3")}
+
+	_, reply := env.run(t, admin, subcommand("start", str("service", "rust")))
+	if msg := reply.reply(); msg.Content != "[DRY RUN] **Starting** Rust..." {
+		t.Errorf("start reply = %q", msg.Content)
+	}
+
+	_, reply = env.run(t, admin, subcommand("ping"))
+	if msg := reply.reply(); msg.Content != "[DRY RUN] Pong!" {
+		t.Errorf("ping reply = %q", msg.Content)
+	}
+}
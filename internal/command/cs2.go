@@ -5,29 +5,20 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/netwarlan/ned/internal/config"
-	"github.com/netwarlan/ned/internal/executor"
-	"github.com/netwarlan/ned/internal/rcon"
+	"github.com/netwarlan/ned/internal/service"
 )
 
 // CS2Handler handles /ned match and /ned map commands.
 type CS2Handler struct {
-	cfg     *config.Config
-	match   *executor.MatchExecutor
-	rcon    rcon.Client
-	matchMu sync.Mutex // serializes match start/stop operations
+	cfg *config.Config
+	svc *service.Service
 }
 
-func NewCS2Handler(cfg *config.Config, match *executor.MatchExecutor, rcon rcon.Client) *CS2Handler {
-	return &CS2Handler{
-		cfg:   cfg,
-		match: match,
-		rcon:  rcon,
-	}
+func NewCS2Handler(svc *service.Service) *CS2Handler {
+	return &CS2Handler{cfg: svc.Config(), svc: svc}
 }
 
 // MatchSubcommandGroup returns the "match" subcommand group for the /ned command.
@@ -94,21 +85,20 @@ func (h *CS2Handler) MatchSubcommandGroup() *discordgo.ApplicationCommandOption
 }
 
 // HandleMatch dispatches /ned match subcommands.
-// sub is the "match" subcommand group option.
-func (h *CS2Handler) HandleMatch(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	action := sub.Options[0]
+func (h *CS2Handler) HandleMatch(ctx context.Context, in *Interaction) {
+	action := in.Command.Options[0]
 	switch action.Name {
 	case "start":
-		h.handleMatchStart(s, i, action)
+		h.handleMatchStart(ctx, in, action)
 	case "stop":
-		h.handleMatchStop(s, i)
+		h.handleMatchStop(ctx, in)
 	case "map":
-		h.handleMap(s, i, action)
+		h.handleMap(ctx, in, action)
 	}
 }
 
-func (h *CS2Handler) handleMap(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	respondDeferred(s, i, true)
+func (h *CS2Handler) handleMap(ctx context.Context, in *Interaction, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	in.respondDeferred(true)
 
 	var mapName, serverKey string
 	for _, opt := range sub.Options {
@@ -120,101 +110,56 @@ func (h *CS2Handler) handleMap(s *discordgo.Session, i *discordgo.InteractionCre
 		}
 	}
 
-	targets := h.cfg.AllCS2RCONTargets()
-
-	if serverKey != "" {
-		target, ok := targets[serverKey]
-		if !ok {
-			followUpError(s, i, fmt.Sprintf("Unknown CS2 server: %s", serverKey), nil)
-			return
-		}
-		targets = map[string]config.RCONTarget{serverKey: target}
-	}
-
-	command := "changelevel " + mapName
-
-	type rconResult struct {
-		server   string
-		response string
-		err      error
-	}
-
-	var (
-		mu      sync.Mutex
-		results []rconResult
-		wg      sync.WaitGroup
-	)
-
-	for key, target := range targets {
-		wg.Add(1)
-		go func(key string, target config.RCONTarget) {
-			defer wg.Done()
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			resp, err := h.rcon.Execute(ctx, target.Address, target.Password, command)
-			mu.Lock()
-			results = append(results, rconResult{server: key, response: resp, err: err})
-			mu.Unlock()
-		}(key, target)
+	results, err := h.svc.ChangeMap(ctx, in.Caller, mapName, serverKey)
+	if err != nil {
+		in.followUpServiceError(h.cfg, err)
+		return
 	}
-	wg.Wait()
 
 	var lines []string
 	for _, r := range results {
-		name := h.cfg.DisplayName(r.server)
-		if r.err != nil {
-			lines = append(lines, fmt.Sprintf("%s: **failed** - %s", name, r.err.Error()))
+		name := h.cfg.DisplayName(r.Server)
+		if r.Err != nil {
+			lines = append(lines, fmt.Sprintf("%s: **failed** - %s", name, r.Err.Error()))
 		} else {
 			lines = append(lines, fmt.Sprintf("%s: changed to `%s`", name, mapName))
 		}
 	}
 
 	msg := fmt.Sprintf("**Map change: %s**\n%s", mapName, strings.Join(lines, "\n"))
-	followUp(s, i, msg)
+	in.followUp(msg)
 }
 
-func (h *CS2Handler) handleMatchStart(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	respondDeferred(s, i, true)
+func (h *CS2Handler) handleMatchStart(ctx context.Context, in *Interaction, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	in.respondDeferred(true)
 
 	count := int(sub.Options[0].IntValue())
 
-	if !h.matchMu.TryLock() {
-		followUpError(s, i, "A match operation is already in progress", nil)
-		return
-	}
-	defer h.matchMu.Unlock()
-
-	result, err := h.match.Start(context.Background(), count)
+	stdout, err := h.svc.StartMatches(ctx, in.Caller, count)
 	if err != nil {
-		followUpError(s, i, "Failed to start match servers", err)
+		in.followUpServiceError(h.cfg, err)
 		return
 	}
 
 	msg := fmt.Sprintf("**Started %d CS2 match server(s)**", count)
-	if result.Stdout != "" {
-		msg += fmt.Sprintf("\n```\n%s\n```", truncate(result.Stdout, maxMessageLen))
+	if stdout != "" {
+		msg += fmt.Sprintf("\n```\n%s\n```", truncate(stdout, maxMessageLen))
 	}
-	followUp(s, i, msg)
+	in.followUp(msg)
 }
 
-func (h *CS2Handler) handleMatchStop(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	respondDeferred(s, i, true)
-
-	if !h.matchMu.TryLock() {
-		followUpError(s, i, "A match operation is already in progress", nil)
-		return
-	}
-	defer h.matchMu.Unlock()
+func (h *CS2Handler) handleMatchStop(ctx context.Context, in *Interaction) {
+	in.respondDeferred(true)
 
-	result, err := h.match.Stop(context.Background())
+	stdout, err := h.svc.StopMatches(ctx, in.Caller)
 	if err != nil {
-		followUpError(s, i, "Failed to stop match servers", err)
+		in.followUpServiceError(h.cfg, err)
 		return
 	}
 
 	msg := "**Stopped all CS2 match servers**"
-	if result.Stdout != "" {
-		msg += fmt.Sprintf("\n```\n%s\n```", truncate(result.Stdout, maxMessageLen))
+	if stdout != "" {
+		msg += fmt.Sprintf("\n```\n%s\n```", truncate(stdout, maxMessageLen))
 	}
-	followUp(s, i, msg)
+	in.followUp(msg)
 }
@@ -0,0 +1,75 @@
+package command
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// DiscordResponder answers a Discord interaction.
+type DiscordResponder struct {
+	session     *discordgo.Session
+	interaction *discordgo.Interaction
+}
+
+// FromDiscord wraps a /ned application command interaction. The caller's
+// Discord roles are mapped to Ned roles through cfg.
+func FromDiscord(cfg *config.Config, s *discordgo.Session, i *discordgo.InteractionCreate) *Interaction {
+	return &Interaction{
+		ID:      i.ID,
+		Caller:  callerOf(cfg, i),
+		Command: i.ApplicationCommandData().Options[0],
+		Reply:   &DiscordResponder{session: s, interaction: i.Interaction},
+	}
+}
+
+// callerOf extracts the invoking user from an interaction and maps their
+// Discord roles to Ned roles. Guild interactions carry a Member; DMs only
+// carry a User and have no roles.
+func callerOf(cfg *config.Config, i *discordgo.InteractionCreate) service.Caller {
+	c := service.Caller{Name: "unknown"}
+	if i.Member != nil {
+		c.Roles = cfg.RolesFor(i.Member.Roles)
+		if i.Member.User != nil {
+			c.Name = i.Member.User.Username
+			c.ID = i.Member.User.ID
+		}
+	} else if i.User != nil {
+		c.Name = i.User.Username
+		c.ID = i.User.ID
+	}
+	return c
+}
+
+func flags(ephemeral bool) discordgo.MessageFlags {
+	if ephemeral {
+		return discordgo.MessageFlagsEphemeral
+	}
+	return 0
+}
+
+func (r *DiscordResponder) Respond(msg Message) error {
+	return r.session.InteractionRespond(r.interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: msg.Content, Embeds: msg.Embeds, Files: msg.Files, Flags: flags(msg.Ephemeral)},
+	})
+}
+
+func (r *DiscordResponder) Defer(ephemeral bool) error {
+	return r.session.InteractionRespond(r.interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: flags(ephemeral)},
+	})
+}
+
+func (r *DiscordResponder) Edit(msg Message) error {
+	edit := &discordgo.WebhookEdit{Files: msg.Files}
+	if msg.Content != "" {
+		edit.Content = &msg.Content
+	}
+	if len(msg.Embeds) > 0 {
+		edit.Embeds = &msg.Embeds
+	}
+	_, err := r.session.InteractionResponseEdit(r.interaction, edit)
+	return err
+}
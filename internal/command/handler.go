@@ -1,68 +1,206 @@
 package command
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/secret"
+	"github.com/netwarlan/ned/internal/service"
 )
 
 const maxMessageLen = 1500
 
+// maxChoices is Discord's limit on the number of choices per option.
+const maxChoices = 25
+
+// Responder delivers the replies to a command. DiscordResponder answers a
+// Discord interaction; other front ends and tests supply their own.
+type Responder interface {
+	// Respond sends the reply straight away.
+	Respond(msg Message) error
+	// Defer acknowledges the command so the reply can follow within 15
+	// minutes. Ephemeral applies to the reply that follows.
+	Defer(ephemeral bool) error
+	// Edit replaces the deferred acknowledgement with the reply.
+	Edit(msg Message) error
+}
+
+// Message is one reply: text, embeds, or both, and optionally attached
+// files.
+type Message struct {
+	Content   string
+	Embeds    []*discordgo.MessageEmbed
+	Files     []*discordgo.File
+	Ephemeral bool
+}
+
+// dryRunPrefix marks the replies of a bot running with -dry-run.
+const dryRunPrefix = "[DRY RUN]"
+
+// dryRunResponder prefixes every reply with dryRunPrefix, so nobody takes
+// a rehearsal for the real thing.
+type dryRunResponder struct {
+	Responder
+}
+
+func (r dryRunResponder) Respond(msg Message) error {
+	return r.Responder.Respond(markDryRun(msg))
+}
+
+func (r dryRunResponder) Edit(msg Message) error {
+	return r.Responder.Edit(markDryRun(msg))
+}
+
+func markDryRun(msg Message) Message {
+	if msg.Content == "" {
+		msg.Content = dryRunPrefix
+	} else {
+		msg.Content = dryRunPrefix + " " + msg.Content
+	}
+	return msg
+}
+
+// Interaction is one /ned invocation, independent of the front end it
+// arrived on.
+type Interaction struct {
+	// ID correlates logs and outcomes, e.g. the Discord interaction ID.
+	ID string
+	// Caller is who ran the command, with their Ned roles.
+	Caller service.Caller
+	// Command is the /ned subcommand with its options.
+	Command *discordgo.ApplicationCommandInteractionDataOption
+	Reply   Responder
+
+	outcome string
+}
+
+// Command outcomes reported through Outcome.
+const (
+	OutcomeOK     = "ok"
+	OutcomeError  = "error"
+	OutcomeDenied = "denied"
+)
+
+// Outcome reports how the command ended. Commands that never reported an
+// error or denial are OutcomeOK.
+func (in *Interaction) Outcome() string {
+	if in.outcome == "" {
+		return OutcomeOK
+	}
+	return in.outcome
+}
+
+// respondError sends an immediate ephemeral error response.
+func (in *Interaction) respondError(msg string) {
+	in.outcome = OutcomeError
+	in.respondNow("**Error:** "+msg, true)
+}
+
 // respondNow sends an immediate text response (no deferred "thinking..." state).
-func respondNow(s *discordgo.Session, i *discordgo.InteractionCreate, content string, ephemeral bool) {
-	flags := discordgo.MessageFlags(0)
-	if ephemeral {
-		flags = discordgo.MessageFlagsEphemeral
+func (in *Interaction) respondNow(content string, ephemeral bool) {
+	if err := in.Reply.Respond(Message{Content: secret.Redact(content), Ephemeral: ephemeral}); err != nil {
+		slog.Error("sending response", "interaction_id", in.ID, "err", err)
+	}
+}
+
+// respondEmbed sends an immediate rich embed response.
+func (in *Interaction) respondEmbed(embed *discordgo.MessageEmbed) {
+	if err := in.Reply.Respond(Message{Embeds: []*discordgo.MessageEmbed{embed}}); err != nil {
+		slog.Error("sending embed response", "interaction_id", in.ID, "err", err)
 	}
-	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{Content: content, Flags: flags},
-	}); err != nil {
-		log.Printf("Error sending response: %v", err)
+}
+
+// respondDeferred sends a "thinking..." response that gives us up to 15
+// minutes to reply.
+func (in *Interaction) respondDeferred(ephemeral bool) {
+	if err := in.Reply.Defer(ephemeral); err != nil {
+		slog.Error("deferring response", "interaction_id", in.ID, "err", err)
 	}
 }
 
-// respondDeferred sends an ephemeral "thinking..." response that gives us
-// up to 15 minutes to reply.
-func respondDeferred(s *discordgo.Session, i *discordgo.InteractionCreate, ephemeral bool) {
-	flags := discordgo.MessageFlags(0)
-	if ephemeral {
-		flags = discordgo.MessageFlagsEphemeral
+// followUp edits the deferred response with a text message. Known secrets
+// are redacted, since RCON and script output can echo them back.
+func (in *Interaction) followUp(content string) {
+	if err := in.Reply.Edit(Message{Content: secret.Redact(content)}); err != nil {
+		slog.Error("editing response", "interaction_id", in.ID, "err", err)
 	}
-	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{Flags: flags},
-	}); err != nil {
-		log.Printf("Error deferring response: %v", err)
+}
+
+// progress edits the deferred response in place with the latest steps of
+// a long command, so they stream into one message. A failed edit, e.g. once
+// Discord's 15 minutes are up, is only logged at debug level, since the
+// outcome is reported (or audited) when the command finishes.
+func (in *Interaction) progress(title string, steps []string) {
+	content := fmt.Sprintf("**%s**\n%s", title, strings.Join(lastN(steps, 10), "\n"))
+	if err := in.Reply.Edit(Message{Content: secret.Redact(content)}); err != nil {
+		slog.Debug("editing progress", "interaction_id", in.ID, "err", err)
 	}
 }
 
-// followUp edits the deferred response with a text message.
-func followUp(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
-	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Content: &content,
-	}); err != nil {
-		log.Printf("Error editing response: %v", err)
+// followUpFile edits the deferred response with a text message and an
+// attached text file. Both are redacted like followUp.
+func (in *Interaction) followUpFile(content, name, data string) {
+	file := &discordgo.File{Name: name, ContentType: "text/plain", Reader: strings.NewReader(secret.Redact(data))}
+	if err := in.Reply.Edit(Message{Content: secret.Redact(content), Files: []*discordgo.File{file}}); err != nil {
+		slog.Error("editing response with file", "interaction_id", in.ID, "err", err)
 	}
 }
 
 // followUpEmbed edits the deferred response with a rich embed.
-func followUpEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, embeds []*discordgo.MessageEmbed) {
-	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Embeds: &embeds,
-	}); err != nil {
-		log.Printf("Error editing response with embed: %v", err)
+func (in *Interaction) followUpEmbed(embeds []*discordgo.MessageEmbed) {
+	if err := in.Reply.Edit(Message{Embeds: embeds}); err != nil {
+		slog.Error("editing response with embed", "interaction_id", in.ID, "err", err)
 	}
 }
 
 // followUpError edits the deferred response with an error message.
-func followUpError(s *discordgo.Session, i *discordgo.InteractionCreate, msg string, err error) {
+func (in *Interaction) followUpError(msg string, err error) {
+	in.outcome = OutcomeError
 	content := fmt.Sprintf("**Error:** %s", msg)
 	if err != nil {
 		content += fmt.Sprintf("\n```\n%s\n```", truncate(err.Error(), 500))
 	}
-	followUp(s, i, content)
+	in.followUp(content)
+}
+
+// followUpServiceError reports an error returned by the service layer.
+// Policy denials are reported as such; other errors show their message and,
+// when there is one, the underlying cause.
+func (in *Interaction) followUpServiceError(cfg *config.Config, err error) {
+	var denied *service.DeniedError
+	if errors.As(err, &denied) {
+		in.outcome = OutcomeDenied
+		names := make([]string, 0, len(denied.Servers))
+		for _, key := range denied.Servers {
+			names = append(names, cfg.DisplayName(key))
+		}
+		in.followUp(fmt.Sprintf("**Denied:** `%s` is not permitted for your roles on: %s\nNothing was sent.",
+			denied.Command, strings.Join(names, ", ")))
+		return
+	}
+	in.followUpError(err.Error(), errors.Unwrap(err))
+}
+
+// option returns the named option of opt, or nil when it was not given.
+func option(opt *discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, o := range opt.Options {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// stringOption returns the named string option of opt, or "".
+func stringOption(opt *discordgo.ApplicationCommandInteractionDataOption, name string) string {
+	if o := option(opt, name); o != nil {
+		return o.StringValue()
+	}
+	return ""
 }
 
 // truncate shortens a string to maxLen, appending "... (truncated)" if needed.
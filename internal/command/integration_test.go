@@ -0,0 +1,138 @@
+package command
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/policy"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/rcon"
+	"github.com/netwarlan/ned/internal/service"
+	"github.com/netwarlan/ned/internal/simulator"
+)
+
+// simEnv is a router over real A2S and RCON clients talking to simulated
+// game servers on localhost.
+type simEnv struct {
+	*testEnv
+	sims map[string]*simulator.Server
+}
+
+// newSimEnv simulates a CS2 server, a TF2 server with players, and a L4D2
+// server that has gone away.
+func newSimEnv(t *testing.T) *simEnv {
+	t.Helper()
+	cfg := &config.Config{Servers: map[string]config.Server{}, PollInterval: 30 * time.Second}
+	env := &simEnv{sims: map[string]*simulator.Server{}}
+
+	add := func(key, name, category string, opts simulator.Options) {
+		opts.Name = name
+		opts.RCONPassword = key + "pass"
+		sim, err := simulator.Start(opts, "127.0.0.1:0", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sim.Close() })
+		env.sims[key] = sim
+
+		_, qport, _ := net.SplitHostPort(sim.QueryAddr())
+		_, rport, _ := net.SplitHostPort(sim.RCONAddr())
+		cfg.Servers[key] = config.Server{
+			DisplayName: name, Script: key + "/" + key + ".sh", Protocol: "source", Category: category,
+			IP: "127.0.0.1", Port: atoi(qport), QueryPort: atoi(qport), RCONPort: atoi(rport), RCONPassword: opts.RCONPassword,
+		}
+	}
+	add("cs2", "CS2 Casual", "cs2", simulator.Options{Map: "de_dust2", MaxPlayers: 10, Challenge: true})
+	add("tf2", "TF2", "game", simulator.Options{Map: "ctf_2fort", MaxPlayers: 24, Bots: 1, Players: []simulator.Player{
+		{Name: "alice", Score: 12, Duration: 30 * time.Minute},
+		{Name: "bob", Score: 3, Duration: 5 * time.Minute},
+	}})
+	add("l4d2", "L4D2", "game", simulator.Options{})
+	env.sims["l4d2"].Close()
+
+	pol, err := policy.NewRCONPolicy(config.RCONPolicyConfig{
+		Default: map[string]config.RCONRule{"admin": {Allow: []string{".*"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.New(cfg, service.Deps{
+		Executor: &fakeExecutor{},
+		Querier:  query.NewA2SQuerier(500 * time.Millisecond),
+		RCON:     rcon.NewGorconClient(time.Second),
+		Policy:   pol,
+		Audit:    discardAudit{},
+	})
+	env.testEnv = &testEnv{cfg: cfg, router: NewRouter(svc, nil, nil, "v1.2.3")}
+	return env
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func TestSim_MatchMap(t *testing.T) {
+	env := newSimEnv(t)
+
+	_, reply := env.run(t, admin, group("match", subcommand("map", str("map_name", "de_inferno"), str("server", "cs2"))))
+	if msg := reply.reply().Content; !strings.Contains(msg, "CS2 Casual: changed to `de_inferno`") {
+		t.Errorf("reply = %q", msg)
+	}
+	if got := env.sims["cs2"].Map(); got != "de_inferno" {
+		t.Errorf("map = %q, want de_inferno", got)
+	}
+
+	// The new map shows up in the next query.
+	_, reply = env.run(t, admin, subcommand("players", str("server", "cs2")))
+	if got := fieldValue(reply.embed(), "Map"); got != "de_inferno" {
+		t.Errorf("queried map = %q", got)
+	}
+
+	env.sims["cs2"].SetFault(simulator.RefuseRCON)
+	_, reply = env.run(t, admin, group("match", subcommand("map", str("map_name", "de_nuke"), str("server", "cs2"))))
+	if msg := reply.reply().Content; !strings.Contains(msg, "CS2 Casual: **failed**") {
+		t.Errorf("refused reply = %q", msg)
+	}
+}
+
+func TestSim_Players(t *testing.T) {
+	env := newSimEnv(t)
+
+	_, reply := env.run(t, admin, subcommand("players", str("server", "tf2")))
+	embed := reply.embed()
+	if fieldValue(embed, "Map") != "ctf_2fort" || fieldValue(embed, "Players") != "2/24" || fieldValue(embed, "Bots") != "1" {
+		t.Errorf("fields = %+v", embed.Fields)
+	}
+	if list := fieldValue(embed, "Connected Players"); !strings.Contains(list, "alice") || !strings.Contains(list, "bob") {
+		t.Errorf("player list = %q (fields %+v)", list, embed.Fields)
+	}
+
+	env.sims["tf2"].SetPlayers()
+	_, reply = env.run(t, admin, subcommand("players"))
+	if embed := reply.embed(); embed.Title != "NETWAR Players (0 total)" || !strings.Contains(embed.Description, "CS2 Casual") || strings.Contains(embed.Description, "L4D2") {
+		t.Errorf("all servers = %q: %q", embed.Title, embed.Description)
+	}
+}
+
+func TestSim_Status(t *testing.T) {
+	env := newSimEnv(t)
+	env.sims["cs2"].SetFault(simulator.Unresponsive)
+
+	_, reply := env.run(t, admin, subcommand("status"))
+	embed := reply.embed()
+	game, cs2 := fieldValue(embed, "Game Servers"), fieldValue(embed, "CS2")
+	if !strings.Contains(game, "ctf_2fort") || !strings.Contains(game, "2/24") {
+		t.Errorf("TF2 line missing from %q", game)
+	}
+	if !strings.Contains(game, "L4D2") || !strings.Contains(game, "Offline (refused)") {
+		t.Errorf("L4D2 not refused in %q", game)
+	}
+	if !strings.Contains(cs2, "CS2 Casual") || !strings.Contains(cs2, "Offline (no reply)") {
+		t.Errorf("unresponsive CS2 not timed out in %q", cs2)
+	}
+}
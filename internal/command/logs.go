@@ -0,0 +1,128 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// LogsHandler handles /ned logs.
+type LogsHandler struct {
+	cfg *config.Config
+	svc *service.Service
+}
+
+func NewLogsHandler(svc *service.Service) *LogsHandler {
+	return &LogsHandler{cfg: svc.Config(), svc: svc}
+}
+
+// Subcommand returns the "logs" subcommand option for the /ned command.
+// Only servers with container logs or a logs verb are offered.
+func (h *LogsHandler) Subcommand() *discordgo.ApplicationCommandOption {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for key, srv := range h.cfg.Servers {
+		if srv.Executor == config.ExecutorDocker || srv.LogsVerb != "" {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: srv.DisplayName, Value: key})
+		}
+	}
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Name < choices[j].Name })
+	if len(choices) > maxChoices {
+		choices = choices[:maxChoices]
+	}
+
+	minLines := float64(1)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        "logs",
+		Description: "Show a server's recent output",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "service",
+				Description: "The game server",
+				Required:    true,
+				Choices:     choices,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "lines",
+				Description: fmt.Sprintf("How many lines (default %d)", service.DefaultLogLines),
+				MinValue:    &minLines,
+				MaxValue:    service.MaxLogLines,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "since",
+				Description: "Only lines newer than this, e.g. 15m or 2h",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "grep",
+				Description: "Only lines matching this regular expression",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "public",
+				Description: "Post the logs in the channel instead of only to you",
+			},
+		},
+	}
+}
+
+// Handle executes /ned logs <service> [lines] [since] [grep] [public].
+func (h *LogsHandler) Handle(ctx context.Context, in *Interaction) {
+	key := stringOption(in.Command, "service")
+	q := service.LogQuery{Grep: stringOption(in.Command, "grep")}
+	if o := option(in.Command, "lines"); o != nil {
+		q.Lines = int(o.IntValue())
+	}
+	if since := stringOption(in.Command, "since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			in.respondError(fmt.Sprintf("Invalid since %q, use a duration like 15m or 2h", since))
+			return
+		}
+		q.Since = d
+	}
+	public := false
+	if o := option(in.Command, "public"); o != nil {
+		public = o.BoolValue()
+	}
+
+	in.respondDeferred(!public)
+
+	text, err := h.svc.Logs(ctx, key, q)
+	if err != nil {
+		in.followUpError(err.Error(), errors.Unwrap(err))
+		return
+	}
+
+	name := h.cfg.DisplayName(key)
+	if text == "" {
+		in.followUp(fmt.Sprintf("**%s**: no matching log lines.", name))
+		return
+	}
+
+	lines := countLines(text)
+	header := fmt.Sprintf("**%s**: last %d line(s)", name, lines)
+	if len(text) > maxMessageLen {
+		in.followUpFile(header, key+".log", text)
+		return
+	}
+	in.followUp(fmt.Sprintf("%s\n```\n%s```", header, text))
+}
+
+func countLines(text string) int {
+	n := 0
+	for range strings.Lines(text) {
+		n++
+	}
+	return n
+}
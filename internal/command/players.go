@@ -2,25 +2,25 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/netwarlan/ned/internal/config"
-	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
 )
 
 // PlayersHandler handles /ned players commands.
 type PlayersHandler struct {
-	cfg     *config.Config
-	querier query.Querier
+	cfg *config.Config
+	svc *service.Service
 }
 
-func NewPlayersHandler(cfg *config.Config, querier query.Querier) *PlayersHandler {
-	return &PlayersHandler{cfg: cfg, querier: querier}
+func NewPlayersHandler(svc *service.Service) *PlayersHandler {
+	return &PlayersHandler{cfg: svc.Config(), svc: svc}
 }
 
 // Subcommand returns the "players" subcommand option for the /ned command.
@@ -51,40 +51,26 @@ func (h *PlayersHandler) Subcommand() *discordgo.ApplicationCommandOption {
 }
 
 // Handle executes /ned players.
-// sub is the "players" subcommand option.
-func (h *PlayersHandler) Handle(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	respondDeferred(s, i, false)
+func (h *PlayersHandler) Handle(ctx context.Context, in *Interaction) {
+	in.respondDeferred(false)
 
-	if len(sub.Options) > 0 && sub.Options[0].StringValue() != "" {
-		h.handleSingleServer(s, i, sub.Options[0].StringValue())
+	if key := stringOption(in.Command, "server"); key != "" {
+		h.handleSingleServer(ctx, in, key)
 		return
 	}
-	h.handleAllServers(s, i)
+	h.handleAllServers(ctx, in)
 }
 
-func (h *PlayersHandler) handleSingleServer(s *discordgo.Session, i *discordgo.InteractionCreate, serverKey string) {
-	targets := h.cfg.AllQueryTargets()
-	addr, ok := targets[serverKey]
-	if !ok {
-		followUpError(s, i, fmt.Sprintf("Server %s is not queryable", serverKey), nil)
-		return
-	}
-
-	name := h.cfg.DisplayName(serverKey)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	status, err := h.querier.QueryStatus(ctx, addr)
-	if err != nil || !status.Online {
-		followUpError(s, i, fmt.Sprintf("%s is offline or unreachable", name), err)
+func (h *PlayersHandler) handleSingleServer(ctx context.Context, in *Interaction, serverKey string) {
+	detail, err := h.svc.Players(ctx, serverKey)
+	if err != nil {
+		in.followUpError(err.Error(), errors.Unwrap(err))
 		return
 	}
-
-	players, _ := h.querier.QueryPlayers(ctx, addr)
+	status := detail.Status
 
 	embed := &discordgo.MessageEmbed{
-		Title: name,
+		Title: detail.Name,
 		Color: 0x00ff00,
 		Fields: []*discordgo.MessageEmbedField{
 			{Name: "Map", Value: status.Map, Inline: true},
@@ -99,64 +85,20 @@ func (h *PlayersHandler) handleSingleServer(s *discordgo.Session, i *discordgo.I
 		})
 	}
 
-	if len(players) > 0 {
-		var lines []string
-		for _, p := range players {
-			dur := p.Duration.Truncate(time.Second)
-			lines = append(lines, fmt.Sprintf("`%-20s` | Score: %d | %s", p.Name, p.Score, dur))
-		}
-		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-			Name:  "Connected Players",
-			Value: truncate(strings.Join(lines, "\n"), 1024),
-		})
+	if field := playerListField(detail.Players); field != nil {
+		embed.Fields = append(embed.Fields, field)
 	}
 
-	followUpEmbed(s, i, []*discordgo.MessageEmbed{embed})
+	in.followUpEmbed([]*discordgo.MessageEmbed{embed})
 }
 
-func (h *PlayersHandler) handleAllServers(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	targets := h.cfg.AllQueryTargets()
-
-	type entry struct {
-		key    string
-		status *query.ServerStatus
-	}
-
-	var (
-		mu      sync.Mutex
-		results []entry
-		wg      sync.WaitGroup
-	)
-
-	for key, addr := range targets {
-		wg.Add(1)
-		go func(key, addr string) {
-			defer wg.Done()
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			status, _ := h.querier.QueryStatus(ctx, addr)
-			if status == nil {
-				status = &query.ServerStatus{Online: false}
-			}
-			mu.Lock()
-			results = append(results, entry{key: key, status: status})
-			mu.Unlock()
-		}(key, addr)
-	}
-	wg.Wait()
-
-	sort.Slice(results, func(i, j int) bool { return results[i].key < results[j].key })
-
+func (h *PlayersHandler) handleAllServers(ctx context.Context, in *Interaction) {
 	totalPlayers := 0
 	var lines []string
-	for _, e := range results {
-		name := h.cfg.DisplayName(e.key)
-		if !e.status.Online {
-			continue
-		}
-		totalPlayers += e.status.Players
+	for _, e := range h.svc.Online(ctx) {
+		totalPlayers += e.Status.Players
 		lines = append(lines, fmt.Sprintf("`%-20s` | `%-16s` | **%d**/%d",
-			name, e.status.Map, e.status.Players, e.status.MaxPlayers))
+			e.Name, e.Status.Map, e.Status.Players, e.Status.MaxPlayers))
 	}
 
 	description := "No servers are currently online."
@@ -171,5 +113,5 @@ func (h *PlayersHandler) handleAllServers(s *discordgo.Session, i *discordgo.Int
 		Timestamp:   time.Now().Format(time.RFC3339),
 	}
 
-	followUpEmbed(s, i, []*discordgo.MessageEmbed{embed})
+	in.followUpEmbed([]*discordgo.MessageEmbed{embed})
 }
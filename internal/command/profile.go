@@ -0,0 +1,124 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// ProfileHandler handles /ned profile commands.
+type ProfileHandler struct {
+	cfg *config.Config
+	svc *service.Service
+}
+
+func NewProfileHandler(svc *service.Service) *ProfileHandler {
+	return &ProfileHandler{cfg: svc.Config(), svc: svc}
+}
+
+// SubcommandGroup returns the "profile" subcommand group for the /ned
+// command.
+func (h *ProfileHandler) SubcommandGroup() *discordgo.ApplicationCommandOption {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, name := range h.cfg.ProfileNames() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+	}
+	if len(choices) > maxChoices {
+		choices = choices[:maxChoices]
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+		Name:        "profile",
+		Description: "Run a named set of servers",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "apply",
+				Description: "Start a profile's servers and stop the rest, in dependency order",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "The startup profile",
+						Required:    true,
+						Choices:     choices,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "force",
+						Description: "Stop servers now instead of giving players their shutdown grace",
+					},
+				},
+			},
+		},
+	}
+}
+
+// Handle dispatches /ned profile subcommands.
+func (h *ProfileHandler) Handle(ctx context.Context, in *Interaction) {
+	action := in.Command.Options[0]
+	switch action.Name {
+	case "apply":
+		h.handleApply(ctx, in, action)
+	}
+}
+
+// handleApply handles /ned profile apply <name>. The plan is shown while
+// it runs, then replaced by each server's outcome.
+func (h *ProfileHandler) handleApply(ctx context.Context, in *Interaction, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	name := stringOption(sub, "name")
+	force := false
+	if o := option(sub, "force"); o != nil {
+		force = o.BoolValue()
+	}
+	in.respondDeferred(true)
+
+	plan, err := h.svc.PlanProfile(ctx, name)
+	if err != nil {
+		in.followUpServiceError(h.cfg, err)
+		return
+	}
+	if plan.Empty() {
+		in.followUp(fmt.Sprintf("Profile **%s** is already applied: %d server(s) running.", name, len(plan.Running)))
+		return
+	}
+	in.followUp(truncate(fmt.Sprintf("**Applying profile %s...**\n%s", name, planText(h.cfg, plan)), maxMessageLen))
+
+	results := h.svc.ApplyProfile(ctx, in.Caller, plan, force)
+	if slices.ContainsFunc(results, service.BulkResult.Failed) {
+		in.outcome = OutcomeError
+	}
+	in.followUpEmbed([]*discordgo.MessageEmbed{bulkSummary("Profile "+name, results)})
+}
+
+// planText lists a plan's steps, one wave per line.
+func planText(cfg *config.Config, plan *service.ProfilePlan) string {
+	names := func(keys []string) string {
+		out := make([]string, len(keys))
+		for i, key := range keys {
+			out[i] = cfg.DisplayName(key)
+		}
+		return strings.Join(out, ", ")
+	}
+
+	var lines []string
+	for _, wave := range plan.Stop {
+		lines = append(lines, "Stop: "+names(wave))
+	}
+	for _, wave := range plan.Start {
+		lines = append(lines, "Start: "+names(wave))
+	}
+	if len(plan.Running) > 0 {
+		lines = append(lines, "Already running: "+names(plan.Running))
+	}
+	if len(plan.Unknown) > 0 {
+		lines = append(lines, "State unknown: "+names(plan.Unknown))
+	}
+	return strings.Join(lines, "\n")
+}
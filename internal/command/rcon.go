@@ -3,115 +3,163 @@ package command
 import (
 	"context"
 	"fmt"
-	"net"
-	"sort"
-	"strconv"
-	"time"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/netwarlan/ned/internal/config"
-	"github.com/netwarlan/ned/internal/rcon"
+	"github.com/netwarlan/ned/internal/service"
 )
 
 // RCONHandler handles /ned rcon commands.
 type RCONHandler struct {
-	cfg  *config.Config
-	rcon rcon.Client
+	cfg *config.Config
+	svc *service.Service
 }
 
-func NewRCONHandler(cfg *config.Config, rcon rcon.Client) *RCONHandler {
-	return &RCONHandler{cfg: cfg, rcon: rcon}
+func NewRCONHandler(svc *service.Service) *RCONHandler {
+	return &RCONHandler{cfg: svc.Config(), svc: svc}
 }
 
-// Subcommand returns the "rcon" subcommand option for the /ned command.
-func (h *RCONHandler) Subcommand() *discordgo.ApplicationCommandOption {
-	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
-
-	for key, srv := range h.cfg.Servers {
-		if srv.RCONPort > 0 && srv.RCONPassword != "" {
-			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
-				Name:  srv.DisplayName,
-				Value: key,
-			})
-		}
+// SubcommandGroup returns the "rcon" subcommand group for the /ned command.
+func (h *RCONHandler) SubcommandGroup() *discordgo.ApplicationCommandOption {
+	// Group targets come first so they survive the Discord choice limit.
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, t := range h.svc.RCONTargets() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: t.Name, Value: t.Value})
+	}
+	if len(choices) > maxChoices {
+		choices = choices[:maxChoices]
 	}
 
-	for i := 1; i <= h.cfg.CS2Matches.Pro.MaxInstances; i++ {
-		key := fmt.Sprintf("match-pro-%d", i)
-		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
-			Name:  h.cfg.DisplayName(key),
-			Value: key,
-		})
+	targetOption := func() *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "target",
+			Description: "Target server, category, or group",
+			Required:    true,
+			Choices:     choices,
+		}
 	}
-	sort.Slice(choices, func(i, j int) bool { return choices[i].Name < choices[j].Name })
 
 	return &discordgo.ApplicationCommandOption{
-		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
 		Name:        "rcon",
-		Description: "Send an RCON command to a game server",
+		Description: "Send RCON commands and manage RCON passwords",
 		Options: []*discordgo.ApplicationCommandOption{
 			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "server",
-				Description: "Target server",
-				Required:    true,
-				Choices:     choices,
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "send",
+				Description: "Send an RCON command to a server or group of servers",
+				Options: []*discordgo.ApplicationCommandOption{
+					targetOption(),
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "command",
+						Description: "RCON command to execute",
+						Required:    true,
+					},
+				},
 			},
 			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "command",
-				Description: "RCON command to execute",
-				Required:    true,
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "rotate",
+				Description: "Generate, apply and save a new RCON password (file: or secret: passwords only)",
+				Options:     []*discordgo.ApplicationCommandOption{targetOption()},
 			},
 		},
 	}
 }
 
-// Handle executes /ned rcon.
-// sub is the "rcon" subcommand option.
-func (h *RCONHandler) Handle(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	respondDeferred(s, i, true) // ephemeral — RCON output may be sensitive
+// Handle dispatches /ned rcon subcommands.
+func (h *RCONHandler) Handle(ctx context.Context, in *Interaction) {
+	action := in.Command.Options[0]
+	switch action.Name {
+	case "send":
+		h.handleSend(ctx, in, action)
+	case "rotate":
+		h.handleRotate(ctx, in, action)
+	}
+}
 
-	serverKey := sub.Options[0].StringValue()
-	command := sub.Options[1].StringValue()
+// handleSend handles /ned rcon send <target> <command>.
+func (h *RCONHandler) handleSend(ctx context.Context, in *Interaction, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	in.respondDeferred(true) // ephemeral — RCON output may be sensitive
+
+	var target, command string
+	for _, opt := range sub.Options {
+		switch opt.Name {
+		case "target":
+			target = opt.StringValue()
+		case "command":
+			command = opt.StringValue()
+		}
+	}
 
-	address, password, err := h.resolveServer(serverKey)
+	results, err := h.svc.SendRCON(ctx, in.Caller, target, command)
 	if err != nil {
-		followUpError(s, i, err.Error(), nil)
+		in.followUpServiceError(h.cfg, err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	response, err := h.rcon.Execute(ctx, address, password, command)
-	if err != nil {
-		followUpError(s, i, fmt.Sprintf("RCON failed on %s", h.cfg.DisplayName(serverKey)), err)
+	// A single server keeps the original full-response output.
+	if len(results) == 1 {
+		r := results[0]
+		name := h.cfg.DisplayName(r.Server)
+		if r.Err != nil {
+			in.followUpError(fmt.Sprintf("RCON failed on %s", name), r.Err)
+			return
+		}
+		msg := fmt.Sprintf("**RCON** `%s` → %s", command, name)
+		if r.Response != "" {
+			msg += fmt.Sprintf("\n```\n%s\n```", truncate(r.Response, maxMessageLen))
+		} else {
+			msg += "\n*No response*"
+		}
+		in.followUp(msg)
 		return
 	}
 
-	name := h.cfg.DisplayName(serverKey)
-	msg := fmt.Sprintf("**RCON** `%s` → %s", command, name)
-	if response != "" {
-		msg += fmt.Sprintf("\n```\n%s\n```", truncate(response, maxMessageLen))
-	} else {
-		msg += "\n*No response*"
-	}
-	followUp(s, i, msg)
+	msg := fmt.Sprintf("**RCON** `%s` → %d servers\n%s", command, len(results), formatRCONTable(h.cfg, results))
+	in.followUp(msg)
 }
 
-func (h *RCONHandler) resolveServer(key string) (address, password string, err error) {
-	if srv, ok := h.cfg.Servers[key]; ok {
-		if srv.RCONPort == 0 || srv.RCONPassword == "" {
-			return "", "", fmt.Errorf("server %s does not have RCON configured", key)
+// formatRCONTable renders broadcast results as a per-server table with the
+// first line of each response.
+func formatRCONTable(cfg *config.Config, results []service.RCONResult) string {
+	var lines []string
+	failed := 0
+	for _, r := range results {
+		name := cfg.DisplayName(r.Server)
+		if r.Err != nil {
+			failed++
+			lines = append(lines, fmt.Sprintf("%-20s | FAIL | %s", name, firstLine(r.Err.Error())))
+			continue
+		}
+		resp := firstLine(r.Response)
+		if resp == "" {
+			resp = "(no response)"
 		}
-		return net.JoinHostPort(srv.IP, strconv.Itoa(srv.RCONPort)), srv.RCONPassword, nil
+		lines = append(lines, fmt.Sprintf("%-20s | OK   | %s", name, resp))
 	}
 
-	targets := h.cfg.AllCS2RCONTargets()
-	if target, ok := targets[key]; ok {
-		return target.Address, target.Password, nil
+	table := fmt.Sprintf("```\n%s\n```", truncate(strings.Join(lines, "\n"), maxMessageLen))
+	if failed > 0 {
+		table += fmt.Sprintf("\n**%d of %d failed**", failed, len(results))
 	}
+	return table
+}
 
-	return "", "", fmt.Errorf("unknown server: %s", key)
+// firstLine returns the first non-empty line of s, trimmed to 60 characters.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) > 60 {
+			line = line[:57] + "..."
+		}
+		return line
+	}
+	return ""
 }
@@ -0,0 +1,333 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/history"
+	"github.com/netwarlan/ned/internal/policy"
+	"github.com/netwarlan/ned/internal/poller"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
+	"github.com/netwarlan/ned/internal/sessions"
+)
+
+// fakeResponder records replies and enforces Discord's rules for them: one
+// initial response, and edits only after a deferral.
+type fakeResponder struct {
+	t         *testing.T
+	deferred  bool
+	ephemeral bool
+	replies   []Message
+}
+
+func (f *fakeResponder) Respond(msg Message) error {
+	if f.deferred || len(f.replies) > 0 {
+		f.t.Errorf("Respond after the interaction was already acknowledged: %q", msg.Content)
+		return errors.New("interaction has already been acknowledged")
+	}
+	f.replies = append(f.replies, msg)
+	return nil
+}
+
+func (f *fakeResponder) Defer(ephemeral bool) error {
+	if f.deferred || len(f.replies) > 0 {
+		f.t.Error("Defer after the interaction was already acknowledged")
+		return errors.New("interaction has already been acknowledged")
+	}
+	f.deferred, f.ephemeral = true, ephemeral
+	return nil
+}
+
+func (f *fakeResponder) Edit(msg Message) error {
+	if !f.deferred {
+		f.t.Errorf("Edit without a deferred response: %q", msg.Content)
+		return errors.New("unknown interaction")
+	}
+	msg.Ephemeral = f.ephemeral
+	f.replies = append(f.replies, msg)
+	return nil
+}
+
+// reply returns the message the user ends up seeing.
+func (f *fakeResponder) reply() Message {
+	f.t.Helper()
+	if len(f.replies) == 0 {
+		f.t.Fatal("no reply was sent")
+	}
+	return f.replies[len(f.replies)-1]
+}
+
+// embed returns the single embed of the final reply.
+func (f *fakeResponder) embed() *discordgo.MessageEmbed {
+	f.t.Helper()
+	msg := f.reply()
+	if len(msg.Embeds) != 1 {
+		f.t.Fatalf("reply has %d embeds, want 1 (content %q)", len(msg.Embeds), msg.Content)
+	}
+	return msg.Embeds[0]
+}
+
+// Option builders for synthesized interactions.
+
+func subcommand(name string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionSubCommand, Name: name, Options: opts}
+}
+
+func group(name string, sub *discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Type: discordgo.ApplicationCommandOptionSubCommandGroup, Name: name,
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{sub},
+	}
+}
+
+func str(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionString, Name: name, Value: value}
+}
+
+func num(name string, value int) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionInteger, Name: name, Value: float64(value)}
+}
+
+var (
+	admin     = service.Caller{Name: "alice", ID: "1", Roles: []string{"admin"}}
+	volunteer = service.Caller{Name: "vic", ID: "2", Roles: []string{"volunteer"}}
+)
+
+type fakeExecutor struct {
+	mu     sync.Mutex
+	ran    []string
+	output string // stdout of every run; default "done"
+}
+
+func (f *fakeExecutor) Run(_ context.Context, scriptPath, command string, _ map[string]string) (*executor.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ran = append(f.ran, scriptPath+" "+command)
+	if f.output != "" {
+		return &executor.Result{Stdout: f.output}, nil
+	}
+	return &executor.Result{Stdout: "done"}, nil
+}
+
+// waitRan waits for the background lifecycle script to be run.
+func (f *fakeExecutor) waitRan(t *testing.T) string {
+	t.Helper()
+	return f.waitRanWithin(t, time.Second)
+}
+
+// waitRanWithin is waitRan with a custom deadline.
+func (f *fakeExecutor) waitRanWithin(t *testing.T, d time.Duration) string {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		if len(f.ran) > 0 {
+			got := f.ran[0]
+			f.mu.Unlock()
+			return got
+		}
+		f.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("script was not run")
+	return ""
+}
+
+type fakeRCON struct {
+	mu   sync.Mutex
+	sent []string // "address command"
+}
+
+func (f *fakeRCON) Execute(_ context.Context, address, _, command string) (string, error) {
+	f.mu.Lock()
+	f.sent = append(f.sent, address+" "+command)
+	f.mu.Unlock()
+	if strings.HasPrefix(address, "10.0.0.9") {
+		return "", errors.New("connection refused")
+	}
+	return "ran " + command, nil
+}
+
+// passwordRCON is an RCON client for servers that check their password and
+// change it on rcon_password. Servers in ignore accept rcon_password
+// without changing anything; servers in sticky change it once and then
+// ignore it. Servers in slow refuse the first login after a change.
+type passwordRCON struct {
+	mu        sync.Mutex
+	passwords map[string]string // by address
+	ignore    map[string]bool
+	sticky    map[string]bool
+	slow      map[string]bool
+	changed   map[string]bool
+}
+
+func (f *passwordRCON) Execute(_ context.Context, address, password, command string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.slow[address] && f.changed[address] {
+		delete(f.slow, address)
+		return "", errors.New("authentication failed")
+	}
+	if f.passwords[address] != password {
+		return "", errors.New("authentication failed")
+	}
+	if pw, ok := strings.CutPrefix(command, "rcon_password "); ok && !f.ignore[address] && !(f.sticky[address] && f.changed[address]) {
+		f.passwords[address] = pw
+		if f.changed == nil {
+			f.changed = map[string]bool{}
+		}
+		f.changed[address] = true
+	}
+	return "", nil
+}
+
+// password returns the password address currently accepts.
+func (f *passwordRCON) password(address string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.passwords[address]
+}
+
+// fakeQuerier reports tf2 online. Queries of 10.0.0.8 run out of time.
+type fakeQuerier struct{}
+
+func (fakeQuerier) QueryStatus(_ context.Context, address string) (*query.ServerStatus, error) {
+	if address == "10.0.0.1:27015" {
+		return &query.ServerStatus{Online: true, Map: "ctf_2fort", Players: 3, MaxPlayers: 24}, nil
+	}
+	if strings.HasPrefix(address, "10.0.0.8:") {
+		return &query.ServerStatus{Online: false}, context.DeadlineExceeded
+	}
+	return &query.ServerStatus{Online: false}, nil
+}
+
+func (fakeQuerier) QueryPlayers(context.Context, string) ([]query.PlayerInfo, error) {
+	return []query.PlayerInfo{{Name: "alice", Score: 5, Duration: 10 * time.Minute}}, nil
+}
+
+type discardAudit struct{}
+
+func (discardAudit) Record(audit.Entry) {}
+
+// recordingAudit keeps the entries it is given.
+type recordingAudit struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (a *recordingAudit) Record(e audit.Entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+}
+
+// last returns the most recent entry.
+func (a *recordingAudit) last(t *testing.T) audit.Entry {
+	t.Helper()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) == 0 {
+		t.Fatal("nothing was audited")
+	}
+	return a.entries[len(a.entries)-1]
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Servers: map[string]config.Server{
+			"tf2":  {DisplayName: "TF2", Script: "tf2/tf2.sh", LogsVerb: "logs", Protocol: "source", Category: "game", IP: "10.0.0.1", Port: 27015, QueryPort: 27015, RCONPort: 27015, RCONPassword: "tf2pass"},
+			"rust": {DisplayName: "Rust", Script: "rust/rust.sh", Protocol: "none", Category: "game", IP: "10.0.0.9", RCONPort: 28016, RCONPassword: "rustpass"},
+		},
+		CS2Matches: config.CS2MatchConfig{
+			Script: "cs2/cs2.sh", RCONPassword: "matchpass", RCONPort: 27015, QueryPort: 27015, Protocol: "source",
+			Pro: config.MatchTierConfig{MaxInstances: 2, IPBase: "10.0.1.0", DisplayPrefix: "CS2 Match Pro"},
+		},
+		PollInterval: 30 * time.Second,
+	}
+}
+
+// testEnv is a router over fakes, with player history and sessions enabled.
+type testEnv struct {
+	cfg    *config.Config
+	router *Router
+	exec   *fakeExecutor
+	rcon   *fakeRCON
+	audit  *recordingAudit
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	return newTestEnvWith(t, testConfig(), true)
+}
+
+func newTestEnvWith(t *testing.T, cfg *config.Config, tracking bool) *testEnv {
+	t.Helper()
+	pol, err := policy.NewRCONPolicy(config.RCONPolicyConfig{
+		Default: map[string]config.RCONRule{
+			"admin":     {Allow: []string{".*"}},
+			"volunteer": {Allow: []string{"^status$"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &fakeExecutor{}
+	rcon := &fakeRCON{}
+	rec := &recordingAudit{}
+	svc := service.New(cfg, service.Deps{
+		Executor: exec,
+		Match:    executor.NewMatchExecutor(exec, cfg.CS2Matches.Script, cfg.CS2Matches.Pro.MaxInstances),
+		Querier:  fakeQuerier{},
+		RCON:     rcon,
+		Policy:   pol,
+		Audit:    rec,
+	})
+
+	var store *history.Store
+	var tracker *sessions.Tracker
+	if tracking {
+		store, err = history.Open(filepath.Join(t.TempDir(), "history.jsonl"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		now := time.Now()
+		store.Append(
+			history.Record{Time: now.Add(-time.Hour), Server: "tf2", Map: "ctf_2fort", Players: 5},
+			history.Record{Time: now.Add(-30 * time.Minute), Server: "tf2", Map: "pl_upward", Players: 12},
+		)
+
+		tracker, _ = sessions.Open("")
+		tracker.Observe(context.Background(), []poller.Sample{{
+			Key:    "tf2",
+			Time:   now,
+			Status: &query.ServerStatus{Online: true, Players: 3},
+			Players: []query.PlayerInfo{
+				{Name: "alice", Duration: 10 * time.Minute},
+				{Name: "alicia", Duration: 5 * time.Minute},
+				{Name: "bob", Duration: time.Minute},
+			},
+		}})
+	}
+
+	return &testEnv{cfg: cfg, router: NewRouter(svc, store, tracker, "v1.2.3"), exec: exec, rcon: rcon, audit: rec}
+}
+
+// run dispatches cmd as caller and returns the interaction and its replies.
+func (e *testEnv) run(t *testing.T, caller service.Caller, cmd *discordgo.ApplicationCommandInteractionDataOption) (*Interaction, *fakeResponder) {
+	t.Helper()
+	reply := &fakeResponder{t: t}
+	in := &Interaction{ID: "test", Caller: caller, Command: cmd, Reply: reply}
+	e.router.Dispatch(context.Background(), in)
+	return in, reply
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// handleRotate handles /ned rcon rotate <target>.
+func (h *RCONHandler) handleRotate(ctx context.Context, in *Interaction, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	in.respondDeferred(true)
+
+	var target string
+	for _, opt := range sub.Options {
+		if opt.Name == "target" {
+			target = opt.StringValue()
+		}
+	}
+
+	groups, err := h.svc.RotateRCON(ctx, in.Caller, target)
+	if err != nil {
+		in.followUpServiceError(h.cfg, err)
+		return
+	}
+
+	var lines []string
+	for _, g := range groups {
+		lines = append(lines, h.rotationLines(g)...)
+		if g.Failure != "" {
+			in.outcome = OutcomeError
+		}
+	}
+	in.followUp("**RCON password rotation**\n" + truncate(strings.Join(lines, "\n"), maxMessageLen))
+}
+
+// rotationLines reports one rotation group, listing where each server ended
+// up when the group was rolled back, and which offline match instances were
+// left out.
+func (h *RCONHandler) rotationLines(g service.RotationGroup) []string {
+	skipped := "offline, skipped"
+	if g.Failure == "" && len(g.Servers) > 0 {
+		skipped = "offline, skipped; start it with the new password"
+	}
+	var offline []string
+	for _, key := range g.Offline {
+		offline = append(offline, fmt.Sprintf("%s: %s", h.cfg.DisplayName(key), skipped))
+	}
+
+	if g.Failure == "" {
+		lines := make([]string, 0, len(g.Servers)+len(offline))
+		for _, key := range g.Servers {
+			lines = append(lines, fmt.Sprintf("%s: rotated", h.cfg.DisplayName(key)))
+		}
+		return append(lines, offline...)
+	}
+
+	lines := []string{fmt.Sprintf("%s: **failed** (%s), rolled back", h.svc.GroupNames(g.Servers), g.Failure)}
+	for _, key := range g.Servers {
+		name := h.cfg.DisplayName(key)
+		switch g.States[key] {
+		case service.StillOld:
+			lines = append(lines, fmt.Sprintf("  %s: still on old password", name))
+		case service.StuckOnNew:
+			lines = append(lines, fmt.Sprintf("  %s: **stuck on new password** (Ned will keep using it until restart)", name))
+		default:
+			lines = append(lines, fmt.Sprintf("  %s: unreachable, password state unknown", name))
+		}
+	}
+	return append(lines, offline...)
+}
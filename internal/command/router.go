@@ -0,0 +1,164 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/history"
+	"github.com/netwarlan/ned/internal/service"
+	"github.com/netwarlan/ned/internal/sessions"
+)
+
+// helpText lists every /ned subcommand for /ned help.
+const helpText = "**Ned — NETWAR Event Discord Bot**\n" +
+	"```\n" +
+	"/ned start <service>            Start a game server\n" +
+	"/ned stop <service>             Stop a game server\n" +
+	"/ned restart <service>          Restart a game server\n" +
+	"/ned start|stop|restart target:<category|all>\n" +
+	"                                Manage many servers, infra first\n" +
+	"/ned update <service|all>       Update a game server or all idle ones\n" +
+	"/ned profile apply <name>       Run a startup profile's servers\n" +
+	"/ned status                     Show all server statuses\n" +
+	"/ned match start <count>        Spin up CS2 match instances\n" +
+	"/ned match stop                 Tear down all match instances\n" +
+	"/ned match map <map> [server]   Change CS2 map via RCON\n" +
+	"/ned rcon send <target> <cmd>   Send RCON to a server or group\n" +
+	"/ned rcon rotate <target>       Rotate RCON passwords\n" +
+	"/ned logs <service> [lines]     Show a server's recent output\n" +
+	"/ned players [server]           Show player counts\n" +
+	"/ned stats [server] [window]    Show player history and peaks\n" +
+	"/ned whois <player>             Show where a player is and has played\n" +
+	"/ned seen <player>              Show when a player was last seen\n" +
+	"/ned welcome                    Post event welcome message\n" +
+	"/ned tournament [matches]       Post CS2 tournament info\n" +
+	"/ned help                       Show this message\n" +
+	"/ned ping                       Pong\n" +
+	"/ned version                    Show bot version\n" +
+	"```"
+
+// Router defines the /ned command and dispatches its subcommands to the
+// handlers.
+type Router struct {
+	version string
+	dryRun  bool
+
+	server   *ServerHandler
+	logs     *LogsHandler
+	update   *UpdateHandler
+	profile  *ProfileHandler
+	cs2      *CS2Handler
+	rcon     *RCONHandler
+	players  *PlayersHandler
+	stats    *StatsHandler
+	sessions *SessionsHandler
+	welcome  *WelcomeHandler
+}
+
+// NewRouter creates the handlers for every /ned subcommand. store and
+// tracker may be nil when history or session tracking is disabled.
+func NewRouter(svc *service.Service, store *history.Store, tracker *sessions.Tracker, version string) *Router {
+	cfg := svc.Config()
+	return &Router{
+		version:  version,
+		dryRun:   svc.DryRun(),
+		server:   NewServerHandler(svc),
+		logs:     NewLogsHandler(svc),
+		update:   NewUpdateHandler(svc),
+		profile:  NewProfileHandler(svc),
+		cs2:      NewCS2Handler(svc),
+		rcon:     NewRCONHandler(svc),
+		players:  NewPlayersHandler(svc),
+		stats:    NewStatsHandler(cfg, store),
+		sessions: NewSessionsHandler(cfg, tracker),
+		welcome:  NewWelcomeHandler(cfg),
+	}
+}
+
+// Command constructs the single /ned command with all subcommands.
+func (r *Router) Command() *discordgo.ApplicationCommand {
+	opts := []*discordgo.ApplicationCommandOption{}
+	opts = append(opts, r.server.Subcommands()...)
+	opts = append(opts, r.logs.Subcommand(), r.update.Subcommand(), r.profile.SubcommandGroup())
+	opts = append(opts,
+		r.cs2.MatchSubcommandGroup(),
+		r.rcon.SubcommandGroup(),
+		r.players.Subcommand(),
+		r.stats.Subcommand(),
+	)
+	opts = append(opts, r.sessions.Subcommands()...)
+	opts = append(opts,
+		r.welcome.WelcomeSubcommand(),
+		r.welcome.TournamentSubcommand(),
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "help",
+			Description: "Show available commands",
+		},
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "ping",
+			Description: "Check if the bot is alive",
+		},
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "version",
+			Description: "Show the running bot version",
+		},
+	)
+
+	return &discordgo.ApplicationCommand{
+		Name:        "ned",
+		Description: "NETWAR Event Discord bot — manage game servers",
+		Options:     opts,
+	}
+}
+
+// Dispatch runs the handler for in's subcommand. Unknown subcommands are
+// reported as errors. In dry-run mode every reply is marked as such.
+func (r *Router) Dispatch(ctx context.Context, in *Interaction) {
+	if r.dryRun {
+		in.Reply = dryRunResponder{in.Reply}
+	}
+	switch in.Command.Name {
+	case "start":
+		r.server.HandleStart(ctx, in)
+	case "stop":
+		r.server.HandleStop(ctx, in)
+	case "restart":
+		r.server.HandleRestart(ctx, in)
+	case "status":
+		r.server.HandleStatus(ctx, in)
+	case "update":
+		r.update.Handle(ctx, in)
+	case "logs":
+		r.logs.Handle(ctx, in)
+	case "profile":
+		r.profile.Handle(ctx, in)
+	case "match":
+		r.cs2.HandleMatch(ctx, in)
+	case "rcon":
+		r.rcon.Handle(ctx, in)
+	case "players":
+		r.players.Handle(ctx, in)
+	case "stats":
+		r.stats.Handle(ctx, in)
+	case "whois":
+		r.sessions.HandleWhois(ctx, in)
+	case "seen":
+		r.sessions.HandleSeen(ctx, in)
+	case "welcome":
+		r.welcome.HandleWelcome(ctx, in)
+	case "tournament":
+		r.welcome.HandleTournament(ctx, in)
+	case "help":
+		in.respondNow(helpText, true)
+	case "ping":
+		in.respondNow("Pong!", false)
+	case "version":
+		in.respondNow(fmt.Sprintf("Ned %s", r.version), false)
+	default:
+		in.respondError(fmt.Sprintf("Unknown command: %s", in.Command.Name))
+	}
+}
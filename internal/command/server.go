@@ -3,37 +3,25 @@ package command
 import (
 	"context"
 	"fmt"
-	"log"
+	"slices"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/netwarlan/ned/internal/config"
-	"github.com/netwarlan/ned/internal/executor"
 	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
 )
 
 // ServerHandler handles /ned server commands.
 type ServerHandler struct {
-	cfg      *config.Config
-	executor executor.Executor
-	querier  query.Querier
-	locks    sync.Map // per-server mutexes
+	cfg *config.Config
+	svc *service.Service
 }
 
-func NewServerHandler(cfg *config.Config, exec executor.Executor, querier query.Querier) *ServerHandler {
-	return &ServerHandler{
-		cfg:      cfg,
-		executor: exec,
-		querier:  querier,
-	}
-}
-
-func (h *ServerHandler) serverLock(key string) *sync.Mutex {
-	val, _ := h.locks.LoadOrStore(key, &sync.Mutex{})
-	return val.(*sync.Mutex)
+func NewServerHandler(svc *service.Service) *ServerHandler {
+	return &ServerHandler{cfg: svc.Config(), svc: svc}
 }
 
 // Subcommands returns the start, stop, restart, and status subcommands for /ned.
@@ -47,14 +35,35 @@ func (h *ServerHandler) Subcommands() []*discordgo.ApplicationCommandOption {
 	}
 	sort.Slice(choices, func(i, j int) bool { return choices[i].Name < choices[j].Name })
 
-	serviceOption := func() *discordgo.ApplicationCommandOption {
-		return &discordgo.ApplicationCommandOption{
-			Type:        discordgo.ApplicationCommandOptionString,
-			Name:        "service",
-			Description: "The game server to manage",
-			Required:    true,
-			Choices:     choices,
+	targetChoices := []*discordgo.ApplicationCommandOptionChoice{{Name: "All servers", Value: service.TargetAll}}
+	for _, cat := range service.Categories {
+		if slices.Contains(h.svc.ServerCategories(), cat.Key) {
+			targetChoices = append(targetChoices, &discordgo.ApplicationCommandOptionChoice{Name: cat.Label, Value: cat.Key})
+		}
+	}
+
+	// Lifecycle commands take either one server or a bulk target.
+	lifecycleOptions := func(extra ...*discordgo.ApplicationCommandOption) []*discordgo.ApplicationCommandOption {
+		opts := []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "service",
+				Description: "The game server to manage",
+				Choices:     choices,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "target",
+				Description: "Every server, or every server in a category, instead of one service",
+				Choices:     targetChoices,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "ordered",
+				Description: "With target: start infra servers and dependencies first, stop them last (default: true)",
+			},
 		}
+		return append(opts, extra...)
 	}
 
 	statusChoices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(h.cfg.Servers))
@@ -70,20 +79,28 @@ func (h *ServerHandler) Subcommands() []*discordgo.ApplicationCommandOption {
 		{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
 			Name:        "start",
-			Description: "Start a game server",
-			Options:     []*discordgo.ApplicationCommandOption{serviceOption()},
+			Description: "Start a game server, or a category of them",
+			Options: lifecycleOptions(&discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "force",
+				Description: "Start even if another server using the same address is online",
+			}),
 		},
 		{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
 			Name:        "stop",
-			Description: "Stop a game server",
-			Options:     []*discordgo.ApplicationCommandOption{serviceOption()},
+			Description: "Stop a game server, or a category of them",
+			Options: lifecycleOptions(&discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "force",
+				Description: "Stop now instead of giving players the server's shutdown grace",
+			}),
 		},
 		{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
 			Name:        "restart",
-			Description: "Restart a game server",
-			Options:     []*discordgo.ApplicationCommandOption{serviceOption()},
+			Description: "Restart a game server, or a category of them",
+			Options:     lifecycleOptions(),
 		},
 		{
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -101,107 +118,190 @@ func (h *ServerHandler) Subcommands() []*discordgo.ApplicationCommandOption {
 	}
 }
 
-// HandleStart handles /ned start <service>.
-func (h *ServerHandler) HandleStart(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	h.handleLifecycle(s, i, sub, "up")
+// HandleStart handles /ned start <service|target>.
+func (h *ServerHandler) HandleStart(ctx context.Context, in *Interaction) {
+	h.handleLifecycle(ctx, in, "up")
 }
 
-// HandleStop handles /ned stop <service>.
-func (h *ServerHandler) HandleStop(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	h.handleLifecycle(s, i, sub, "down")
+// HandleStop handles /ned stop <service|target>.
+func (h *ServerHandler) HandleStop(ctx context.Context, in *Interaction) {
+	h.handleLifecycle(ctx, in, "down")
 }
 
-// HandleRestart handles /ned restart <service>.
-func (h *ServerHandler) HandleRestart(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	h.handleLifecycle(s, i, sub, "restart")
+// HandleRestart handles /ned restart <service|target>.
+func (h *ServerHandler) HandleRestart(ctx context.Context, in *Interaction) {
+	h.handleLifecycle(ctx, in, "restart")
 }
 
 // HandleStatus handles /ned status [service].
-func (h *ServerHandler) HandleStatus(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
-	if len(sub.Options) > 0 && sub.Options[0].StringValue() != "" {
-		h.handleSingleStatus(s, i, sub.Options[0].StringValue())
+func (h *ServerHandler) HandleStatus(ctx context.Context, in *Interaction) {
+	if key := stringOption(in.Command, "service"); key != "" {
+		h.handleSingleStatus(ctx, in, key)
 		return
 	}
-	h.handleStatus(s, i)
+	h.handleStatus(ctx, in)
 }
 
-func (h *ServerHandler) handleLifecycle(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption, action string) {
-	serviceKey := sub.Options[0].StringValue()
-	srv, ok := h.cfg.Servers[serviceKey]
-	if !ok {
-		respondNow(s, i, fmt.Sprintf("**Error:** Unknown server: %s", serviceKey), true)
+func (h *ServerHandler) handleLifecycle(ctx context.Context, in *Interaction, action string) {
+	serviceKey := stringOption(in.Command, "service")
+	target := stringOption(in.Command, "target")
+	force := false
+	if o := option(in.Command, "force"); o != nil {
+		force = o.BoolValue()
+	}
+	switch {
+	case serviceKey != "" && target != "":
+		in.respondError("Choose a service or a target, not both")
+		return
+	case target != "":
+		h.handleBulk(ctx, in, target, action, force)
+		return
+	case serviceKey == "":
+		in.respondError("Choose a service or a target")
 		return
 	}
 
-	mu := h.serverLock(serviceKey)
-	if !mu.TryLock() {
-		respondNow(s, i, fmt.Sprintf("**Error:** %s is already being managed by another command", srv.DisplayName), true)
+	// Checking for a server that must not run alongside this one probes it,
+	// which can take longer than Discord waits for a response.
+	deferred := action == service.ActionStart && !force && len(h.cfg.StartConflicts(serviceKey)) > 0
+	if deferred {
+		in.respondDeferred(true)
+	}
+	reply := func(content string) {
+		if deferred {
+			in.followUp(content)
+		} else {
+			in.respondNow(content, true)
+		}
+	}
+
+	// Fire-and-forget: respond immediately while the script runs in the
+	// background. The game server scripts tail logs forever after starting,
+	// so waiting for them to finish would leave Discord stuck on "thinking...".
+	srv, err := h.svc.Lifecycle(ctx, in.Caller, serviceKey, action, force)
+	if err != nil {
+		in.outcome = OutcomeError
+		reply("**Error:** " + err.Error())
+		return
+	}
+	if action == service.ActionStop && !force && srv.ShutdownGrace > 0 {
+		reply(fmt.Sprintf("**Stopping** %s once players have left, in at most %s...", srv.DisplayName, shortDuration(srv.ShutdownGrace)))
 		return
 	}
 
-	// Fire-and-forget: respond immediately and run the script in the background.
-	// The game server scripts tail logs forever after starting, so waiting
-	// for them to finish would leave Discord stuck on "thinking...".
 	actionVerb := map[string]string{"up": "Starting", "down": "Stopping", "restart": "Restarting"}
 	verb := actionVerb[action]
 	if verb == "" {
 		verb = action
 	}
-	respondNow(s, i, fmt.Sprintf("**%s** %s...", verb, srv.DisplayName), true)
+	reply(fmt.Sprintf("**%s** %s...", verb, srv.DisplayName))
+}
+
+// handleBulk runs a lifecycle action on every server in target and reports
+// each server's outcome in one embed once all of them are done.
+func (h *ServerHandler) handleBulk(ctx context.Context, in *Interaction, target, action string, force bool) {
+	ordered := true
+	if o := option(in.Command, "ordered"); o != nil {
+		ordered = o.BoolValue()
+	}
+	in.respondDeferred(true)
+
+	results, err := h.svc.BulkLifecycle(ctx, in.Caller, target, action, ordered, force)
+	if err != nil {
+		in.followUpServiceError(h.cfg, err)
+		return
+	}
+
+	if slices.ContainsFunc(results, service.BulkResult.Failed) {
+		in.outcome = OutcomeError
+	}
+	in.followUpEmbed([]*discordgo.MessageEmbed{bulkSummary(fmt.Sprintf("%s %s", bulkVerbs[action], bulkTargetName(target)), results)})
+}
 
-	go func() {
-		defer mu.Unlock()
-		result, err := h.executor.Run(context.Background(), srv.Script, action, nil)
-		if err != nil {
-			log.Printf("[%s] %s %s failed: %v", serviceKey, action, srv.DisplayName, err)
-			return
+// bulkSummary renders the per-server outcomes of a bulk operation as one
+// embed. Failures turn it red and are counted in the footer.
+func bulkSummary(title string, results []service.BulkResult) *discordgo.MessageEmbed {
+	var lines []string
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Err != "":
+			failed++
+			lines = append(lines, fmt.Sprintf("`%-20s` | **failed** - %s", r.Name, firstLine(r.Err)))
+		case r.ExitCode != 0:
+			failed++
+			lines = append(lines, fmt.Sprintf("`%-20s` | **failed** - exit code %d", r.Name, r.ExitCode))
+		default:
+			lines = append(lines, fmt.Sprintf("`%-20s` | %s in %s", r.Name, bulkDone[r.Action], r.Duration))
 		}
-		if result.ExitCode != 0 {
-			log.Printf("[%s] %s %s exited with code %d", serviceKey, action, srv.DisplayName, result.ExitCode)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: truncate(strings.Join(lines, "\n"), 4000),
+		Color:       0x00ff00,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	if failed > 0 {
+		embed.Color = 0xff0000
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d of %d failed", failed, len(results))}
+	}
+	return embed
+}
+
+// bulkDone describes a lifecycle action that succeeded.
+var bulkDone = map[string]string{service.ActionStart: "started", service.ActionStop: "stopped", service.ActionRestart: "restarted"}
+
+// bulkVerbs titles the summary of a bulk lifecycle action.
+var bulkVerbs = map[string]string{service.ActionStart: "Start", service.ActionStop: "Stop", service.ActionRestart: "Restart"}
+
+// bulkTargetName names a bulk target for display, e.g. "Game Servers".
+func bulkTargetName(target string) string {
+	if target == service.TargetAll {
+		return "all servers"
+	}
+	for _, cat := range service.Categories {
+		if cat.Key == target {
+			return cat.Label
 		}
-	}()
+	}
+	return target
 }
 
-func (h *ServerHandler) handleSingleStatus(s *discordgo.Session, i *discordgo.InteractionCreate, serverKey string) {
-	respondDeferred(s, i, false)
+func (h *ServerHandler) handleSingleStatus(ctx context.Context, in *Interaction, serverKey string) {
+	in.respondDeferred(false)
 
-	srv, ok := h.cfg.Servers[serverKey]
-	if !ok {
-		followUpError(s, i, fmt.Sprintf("Unknown server: %s", serverKey), nil)
+	detail, err := h.svc.Server(ctx, serverKey)
+	if err != nil {
+		in.followUpError(err.Error(), nil)
 		return
 	}
 
-	name := srv.DisplayName
 	embed := &discordgo.MessageEmbed{
-		Title:     name,
+		Title:     detail.Name,
 		Color:     0x00bfff,
 		Timestamp: time.Now().Format(time.RFC3339),
 		Fields:    []*discordgo.MessageEmbedField{},
 	}
 
 	// Connection info from config
-	if srv.Port > 0 {
+	if detail.Address != "" {
 		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-			Name: "Address", Value: fmt.Sprintf("`%s:%d`", srv.IP, srv.Port), Inline: true,
+			Name: "Address", Value: fmt.Sprintf("`%s`", detail.Address), Inline: true,
 		})
 	}
 
-	// If queryable, get live data
-	if srv.Protocol == "source" && srv.QueryPort > 0 {
-		addr := fmt.Sprintf("%s:%d", srv.IP, srv.QueryPort)
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		status, err := h.querier.QueryStatus(ctx, addr)
-		if err != nil || status == nil || !status.Online {
-			embed.Color = 0xff0000
-			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-				Name: "Status", Value: "Offline", Inline: true,
-			})
-			followUpEmbed(s, i, []*discordgo.MessageEmbed{embed})
-			return
-		}
-
+	switch status := detail.Status; {
+	case !detail.Queryable:
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Status", Value: "Not queryable", Inline: true,
+		})
+	case !status.Online:
+		embed.Color = 0xff0000
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Status", Value: status.Failure.Describe(), Inline: true,
+		})
+	default:
 		embed.Color = 0x00ff00
 		embed.Fields = append(embed.Fields,
 			&discordgo.MessageEmbedField{Name: "Status", Value: "Online", Inline: true},
@@ -214,88 +314,50 @@ func (h *ServerHandler) handleSingleStatus(s *discordgo.Session, i *discordgo.In
 				Name: "Bots", Value: fmt.Sprintf("%d", status.Bots), Inline: true,
 			})
 		}
-
-		// Player list
-		players, _ := h.querier.QueryPlayers(ctx, addr)
-		if len(players) > 0 {
-			var lines []string
-			for _, p := range players {
-				dur := p.Duration.Truncate(time.Second)
-				lines = append(lines, fmt.Sprintf("`%-20s` | Score: %d | %s", p.Name, p.Score, dur))
-			}
-			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-				Name:  "Connected Players",
-				Value: truncate(strings.Join(lines, "\n"), 1024),
-			})
+		if field := playerListField(detail.Players); field != nil {
+			embed.Fields = append(embed.Fields, field)
 		}
-	} else {
-		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-			Name: "Status", Value: "Not queryable", Inline: true,
-		})
 	}
 
-	followUpEmbed(s, i, []*discordgo.MessageEmbed{embed})
+	in.followUpEmbed([]*discordgo.MessageEmbed{embed})
 }
 
-func (h *ServerHandler) handleStatus(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	respondDeferred(s, i, false)
-
-	targets := h.cfg.AllQueryTargets()
-
-	type statusEntry struct {
-		key    string
-		status *query.ServerStatus
+// shortDuration formats d without zero trailing units, e.g. "5m" rather
+// than "5m0s".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
 	}
-
-	var (
-		mu      sync.Mutex
-		results []statusEntry
-		wg      sync.WaitGroup
-	)
-
-	for key, addr := range targets {
-		wg.Add(1)
-		go func(key, addr string) {
-			defer wg.Done()
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			status, _ := h.querier.QueryStatus(ctx, addr)
-			if status == nil {
-				status = &query.ServerStatus{Online: false}
-			}
-			mu.Lock()
-			results = append(results, statusEntry{key: key, status: status})
-			mu.Unlock()
-		}(key, addr)
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
 	}
-	wg.Wait()
+	return s
+}
 
-	// Add non-queryable servers as "N/A"
-	for key, srv := range h.cfg.Servers {
-		if srv.Protocol != "source" {
-			results = append(results, statusEntry{
-				key:    key,
-				status: nil,
-			})
-		}
+// playerListField renders connected players, or nil when there are none.
+func playerListField(players []query.PlayerInfo) *discordgo.MessageEmbedField {
+	if len(players) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, p := range players {
+		dur := p.Duration.Truncate(time.Second)
+		lines = append(lines, fmt.Sprintf("`%-20s` | Score: %d | %s", p.Name, p.Score, dur))
+	}
+	return &discordgo.MessageEmbedField{
+		Name:  "Connected Players",
+		Value: truncate(strings.Join(lines, "\n"), 1024),
 	}
+}
 
-	sort.Slice(results, func(i, j int) bool { return results[i].key < results[j].key })
+func (h *ServerHandler) handleStatus(ctx context.Context, in *Interaction) {
+	in.respondDeferred(false)
 
 	// Group by category
-	categories := map[string][]statusEntry{
-		"game":  {},
-		"cs2":   {},
-		"match": {},
-		"infra": {},
-	}
-
-	for _, entry := range results {
-		if strings.HasPrefix(entry.key, "match-") {
-			categories["match"] = append(categories["match"], entry)
-		} else if srv, ok := h.cfg.Servers[entry.key]; ok {
-			categories[srv.Category] = append(categories[srv.Category], entry)
-		}
+	categories := map[string][]service.ServerEntry{}
+	for _, entry := range h.svc.Board(ctx) {
+		categories[entry.Category] = append(categories[entry.Category], entry)
 	}
 
 	embed := &discordgo.MessageEmbed{
@@ -305,40 +367,29 @@ func (h *ServerHandler) handleStatus(s *discordgo.Session, i *discordgo.Interact
 		Fields:    []*discordgo.MessageEmbedField{},
 	}
 
-	categoryNames := []struct {
-		key   string
-		label string
-	}{
-		{"game", "Game Servers"},
-		{"cs2", "CS2"},
-		{"match", "CS2 Matches"},
-		{"infra", "Infrastructure"},
-	}
-
-	for _, cat := range categoryNames {
-		entries := categories[cat.key]
+	for _, cat := range service.Categories {
+		entries := categories[cat.Key]
 		if len(entries) == 0 {
 			continue
 		}
 
 		var lines []string
 		for _, e := range entries {
-			name := h.cfg.DisplayName(e.key)
-			if e.status == nil {
-				lines = append(lines, fmt.Sprintf("`%-20s` | N/A", name))
-			} else if !e.status.Online {
-				lines = append(lines, fmt.Sprintf("`%-20s` | Offline", name))
+			if e.Status == nil {
+				lines = append(lines, fmt.Sprintf("`%-20s` | N/A", e.Name))
+			} else if !e.Status.Online {
+				lines = append(lines, fmt.Sprintf("`%-20s` | %s", e.Name, e.Status.Failure.Describe()))
 			} else {
 				lines = append(lines, fmt.Sprintf("`%-20s` | `%-16s` | %d/%d",
-					name, e.status.Map, e.status.Players, e.status.MaxPlayers))
+					e.Name, e.Status.Map, e.Status.Players, e.Status.MaxPlayers))
 			}
 		}
 
 		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-			Name:  cat.label,
+			Name:  cat.Label,
 			Value: strings.Join(lines, "\n"),
 		})
 	}
 
-	followUpEmbed(s, i, []*discordgo.MessageEmbed{embed})
+	in.followUpEmbed([]*discordgo.MessageEmbed{embed})
 }
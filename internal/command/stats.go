@@ -0,0 +1,194 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/history"
+)
+
+// sparklineWidth keeps charts on one line in a Discord embed on desktop.
+const sparklineWidth = 32
+
+// statsWindows are the selectable /ned stats windows. Zero means all history.
+var statsWindows = []struct {
+	name   string
+	window time.Duration
+}{
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+	{"24h", 24 * time.Hour},
+	{"3d", 3 * 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"all", 0},
+}
+
+// StatsHandler handles /ned stats.
+type StatsHandler struct {
+	cfg     *config.Config
+	history *history.Store // nil when history.path is unset
+}
+
+func NewStatsHandler(cfg *config.Config, store *history.Store) *StatsHandler {
+	return &StatsHandler{cfg: cfg, history: store}
+}
+
+// Subcommand returns the "stats" subcommand option for the /ned command.
+func (h *StatsHandler) Subcommand() *discordgo.ApplicationCommandOption {
+	targets := h.cfg.AllQueryTargets()
+	serverChoices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(targets))
+	for key := range targets {
+		serverChoices = append(serverChoices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  h.cfg.DisplayName(key),
+			Value: key,
+		})
+	}
+	sort.Slice(serverChoices, func(i, j int) bool { return serverChoices[i].Name < serverChoices[j].Name })
+	if len(serverChoices) > maxChoices {
+		serverChoices = serverChoices[:maxChoices]
+	}
+
+	windowChoices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(statsWindows))
+	for _, w := range statsWindows {
+		windowChoices = append(windowChoices, &discordgo.ApplicationCommandOptionChoice{Name: w.name, Value: w.name})
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        "stats",
+		Description: "Show player history, peaks and most-played maps",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "server",
+				Description: "Specific server (default: all)",
+				Choices:     serverChoices,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "window",
+				Description: "Time window (default: 24h)",
+				Choices:     windowChoices,
+			},
+		},
+	}
+}
+
+// Handle executes /ned stats.
+func (h *StatsHandler) Handle(_ context.Context, in *Interaction) {
+	if h.history == nil {
+		in.respondError("Player history is disabled. Set `history.path` in the config to enable it.")
+		return
+	}
+
+	server, windowName := "", "24h"
+	for _, opt := range in.Command.Options {
+		switch opt.Name {
+		case "server":
+			server = opt.StringValue()
+		case "window":
+			windowName = opt.StringValue()
+		}
+	}
+
+	var window time.Duration
+	found := false
+	for _, w := range statsWindows {
+		if w.name == windowName {
+			window, found = w.window, true
+		}
+	}
+	if !found {
+		in.respondError(fmt.Sprintf("Unknown window %q", windowName))
+		return
+	}
+
+	in.respondDeferred(false)
+
+	now := time.Now()
+	var since time.Time
+	if window > 0 {
+		since = now.Add(-window)
+	}
+	records := h.history.Query(server, since)
+	if len(records) == 0 {
+		in.followUp(fmt.Sprintf("No player history recorded in the last %s.", windowName))
+		return
+	}
+	if since.IsZero() {
+		since = records[0].Time
+	}
+
+	if server != "" {
+		in.followUpEmbed([]*discordgo.MessageEmbed{h.serverEmbed(server, windowName, records, since, now)})
+		return
+	}
+	in.followUpEmbed([]*discordgo.MessageEmbed{h.overviewEmbed(windowName, records, since, now)})
+}
+
+func (h *StatsHandler) serverEmbed(server, windowName string, records []history.Record, since, now time.Time) *discordgo.MessageEmbed {
+	sum := history.Summarize(server, records, h.cfg.PollInterval)
+
+	var maps []string
+	for n, m := range sum.Maps {
+		if n == 5 {
+			break
+		}
+		maps = append(maps, fmt.Sprintf("`%-16s` %s · %.1f player-h", m.Map, m.Duration.Round(time.Minute), m.PlayerHours))
+	}
+	if len(maps) == 0 {
+		maps = append(maps, "—")
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s — last %s", h.cfg.DisplayName(server), windowName),
+		Description: "```\n" + history.Sparkline(records, since, now, sparklineWidth) + "\n```",
+		Color:       0x00bfff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Peak", Value: fmt.Sprintf("%d (<t:%d:f>)", sum.Peak, sum.PeakTime.Unix()), Inline: true},
+			{Name: "Average", Value: fmt.Sprintf("%.1f", sum.Average), Inline: true},
+			{Name: "Player-hours", Value: fmt.Sprintf("%.1f", sum.PlayerHours), Inline: true},
+			{Name: "Most Played Maps", Value: truncate(strings.Join(maps, "\n"), 1000)},
+		},
+		Footer:    &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d samples since %s", sum.Samples, since.Format("Jan 2 15:04"))},
+		Timestamp: now.Format(time.RFC3339),
+	}
+}
+
+func (h *StatsHandler) overviewEmbed(windowName string, records []history.Record, since, now time.Time) *discordgo.MessageEmbed {
+	byServer := make(map[string][]history.Record)
+	for _, r := range records {
+		byServer[r.Server] = append(byServer[r.Server], r)
+	}
+
+	var total float64
+	var lines []string
+	for _, sum := range history.SummarizeAll(records, h.cfg.PollInterval) {
+		total += sum.PlayerHours
+		topMap := "—"
+		if len(sum.Maps) > 0 {
+			topMap = sum.Maps[0].Map
+		}
+		lines = append(lines, fmt.Sprintf("**%s** — peak %d · avg %.1f · %.1f player-h · %s\n`%s`",
+			h.cfg.DisplayName(sum.Server), sum.Peak, sum.Average, sum.PlayerHours, topMap,
+			history.Sparkline(byServer[sum.Server], since, now, sparklineWidth)))
+	}
+
+	peak, peakTime := history.PeakConcurrency(records, h.cfg.PollInterval)
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("NETWAR Player Stats — last %s (%.1f player-hours)", windowName, total),
+		Description: truncate(strings.Join(lines, "\n"), 4000),
+		Color:       0x00bfff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Peak Concurrent Players", Value: fmt.Sprintf("%d across all servers (<t:%d:f>)", peak, peakTime.Unix())},
+		},
+		Footer:    &discordgo.MessageEmbedFooter{Text: "Busiest servers first"},
+		Timestamp: now.Format(time.RFC3339),
+	}
+}
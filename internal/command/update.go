@@ -0,0 +1,140 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+// updateAll is the /ned update choice that updates every idle server.
+const updateAll = "all"
+
+// UpdateHandler handles /ned update.
+type UpdateHandler struct {
+	cfg *config.Config
+	svc *service.Service
+}
+
+func NewUpdateHandler(svc *service.Service) *UpdateHandler {
+	return &UpdateHandler{cfg: svc.Config(), svc: svc}
+}
+
+// Subcommand returns the "update" subcommand option for the /ned command.
+// Docker servers are updated through their image, so only script servers
+// are offered.
+func (h *UpdateHandler) Subcommand() *discordgo.ApplicationCommandOption {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for key, srv := range h.cfg.Servers {
+		if srv.Executor != config.ExecutorDocker {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: srv.DisplayName, Value: key})
+		}
+	}
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Name < choices[j].Name })
+	choices = append([]*discordgo.ApplicationCommandOptionChoice{{Name: "All idle servers", Value: updateAll}}, choices...)
+	if len(choices) > maxChoices {
+		choices = choices[:maxChoices]
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        "update",
+		Description: "Update a game server, restarting it if it was running",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "service",
+				Description: "The game server, or all idle servers",
+				Required:    true,
+				Choices:     choices,
+			},
+		},
+	}
+}
+
+// Handle executes /ned update <service|all>. Each step is shown as it
+// starts by editing the reply in place (see progress). Discord only allows
+// edits for 15 minutes, so the outcome of longer updates is left to the
+// audit log.
+func (h *UpdateHandler) Handle(ctx context.Context, in *Interaction) {
+	key := stringOption(in.Command, "service")
+	in.respondDeferred(true)
+
+	var steps []string
+	progress := func(server, step string) {
+		steps = append(steps, fmt.Sprintf("%s: %s", h.cfg.DisplayName(server), step))
+		in.progress("Updating...", steps)
+	}
+
+	if key == updateAll {
+		results := h.svc.UpdateIdle(ctx, in.Caller, progress)
+		h.reportAll(in, results)
+		return
+	}
+
+	result, err := h.svc.Update(ctx, in.Caller, key, progress)
+	if err != nil {
+		in.followUpError(err.Error(), errors.Unwrap(err))
+		return
+	}
+	if result.Failed() {
+		in.outcome = OutcomeError
+	}
+	in.followUp(truncate(updateSummary(result), maxMessageLen))
+}
+
+func (h *UpdateHandler) reportAll(in *Interaction, results []service.UpdateResult) {
+	var lines []string
+	for _, r := range results {
+		if r.Failed() {
+			in.outcome = OutcomeError
+		}
+		lines = append(lines, updateLine(r))
+	}
+	if len(lines) == 0 {
+		in.followUp("No servers to update.")
+		return
+	}
+	in.followUp(truncate("**Update all idle servers**\n"+strings.Join(lines, "\n"), maxMessageLen))
+}
+
+// updateLine is a one-line summary of an update.
+func updateLine(r service.UpdateResult) string {
+	switch {
+	case r.Skipped != "":
+		return fmt.Sprintf("%s: skipped, %s", r.Name, r.Skipped)
+	case r.Err != "":
+		return fmt.Sprintf("%s: **failed** - %s", r.Name, r.Err)
+	case r.ExitCode != 0:
+		return fmt.Sprintf("%s: **failed** - update exited with code %d", r.Name, r.ExitCode)
+	case r.Restarted && r.Unknown:
+		return fmt.Sprintf("%s: updated in %s and started again (status unknown, so it was treated as running)", r.Name, r.Duration)
+	case r.Restarted:
+		return fmt.Sprintf("%s: updated in %s and restarted", r.Name, r.Duration)
+	default:
+		return fmt.Sprintf("%s: updated in %s", r.Name, r.Duration)
+	}
+}
+
+// updateSummary reports a single update, with the script output when it
+// failed.
+func updateSummary(r service.UpdateResult) string {
+	summary := updateLine(r)
+	if r.Failed() && r.Output != "" {
+		summary += fmt.Sprintf("\n```\n%s\n```", truncate(strings.TrimSpace(r.Output), 1000))
+	}
+	return summary
+}
+
+// lastN returns the last n elements of s.
+func lastN(s []string, n int) []string {
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return s
+}
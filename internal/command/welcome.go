@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+
 	"github.com/bwmarrin/discordgo"
 	"github.com/netwarlan/ned/internal/config"
 )
@@ -45,39 +47,31 @@ func (h *WelcomeHandler) TournamentSubcommand() *discordgo.ApplicationCommandOpt
 }
 
 // HandleWelcome posts the welcome message.
-func (h *WelcomeHandler) HandleWelcome(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (h *WelcomeHandler) HandleWelcome(_ context.Context, in *Interaction) {
 	msg := h.cfg.BuildWelcomeMessage()
 	if msg == "" {
-		respondDeferred(s, i, true)
-		followUpError(s, i, "No welcome message configured. Add a `welcome` section to config.yaml.", nil)
+		in.respondDeferred(true)
+		in.followUpError("No welcome message configured. Add a `welcome` section to config.yaml.", nil)
 		return
 	}
 
-	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{Content: msg},
-	}); err != nil {
-		respondDeferred(s, i, true)
-		followUpError(s, i, "Failed to send welcome message", err)
+	if err := in.Reply.Respond(Message{Content: msg}); err != nil {
+		in.respondDeferred(true)
+		in.followUpError("Failed to send welcome message", err)
 	}
 }
 
 // HandleTournament posts the CS2 tournament connection info.
-func (h *WelcomeHandler) HandleTournament(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
+func (h *WelcomeHandler) HandleTournament(_ context.Context, in *Interaction) {
 	count := h.cfg.CS2Matches.Pro.MaxInstances
-	for _, opt := range sub.Options {
-		if opt.Name == "matches" {
-			count = int(opt.IntValue())
-		}
+	if opt := option(in.Command, "matches"); opt != nil {
+		count = int(opt.IntValue())
 	}
 
 	msg := h.cfg.BuildTournamentMessage(count)
 
-	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{Content: msg},
-	}); err != nil {
-		respondDeferred(s, i, true)
-		followUpError(s, i, "Failed to send tournament message", err)
+	if err := in.Reply.Respond(Message{Content: msg}); err != nil {
+		in.respondDeferred(true)
+		in.followUpError("Failed to send tournament message", err)
 	}
 }
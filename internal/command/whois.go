@@ -0,0 +1,159 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/sessions"
+)
+
+// maxPlayerMatches caps the "did you mean" list for ambiguous names.
+const maxPlayerMatches = 15
+
+// SessionsHandler handles /ned whois and /ned seen.
+type SessionsHandler struct {
+	cfg     *config.Config
+	tracker *sessions.Tracker // nil when session tracking is disabled
+}
+
+func NewSessionsHandler(cfg *config.Config, tracker *sessions.Tracker) *SessionsHandler {
+	return &SessionsHandler{cfg: cfg, tracker: tracker}
+}
+
+// Subcommands returns the "whois" and "seen" subcommand options.
+func (h *SessionsHandler) Subcommands() []*discordgo.ApplicationCommandOption {
+	playerOpt := func() []*discordgo.ApplicationCommandOption {
+		return []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "player",
+				Description: "Player name (or part of it)",
+				Required:    true,
+			},
+		}
+	}
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "whois",
+			Description: "Show where a player is now and where they've played",
+			Options:     playerOpt(),
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "seen",
+			Description: "Show when and where a player was last seen",
+			Options:     playerOpt(),
+		},
+	}
+}
+
+// HandleWhois executes /ned whois <player>.
+func (h *SessionsHandler) HandleWhois(_ context.Context, in *Interaction) {
+	player, ok := h.resolvePlayer(in)
+	if !ok {
+		return
+	}
+	history := h.tracker.Sessions(player)
+
+	var current []string
+	type total struct {
+		server   string
+		duration time.Duration
+		sessions int
+	}
+	totals := make(map[string]*total)
+	for _, sess := range history {
+		if sess.Active {
+			current = append(current, fmt.Sprintf("**%s** — connected <t:%d:R>, score %d",
+				h.cfg.DisplayName(sess.Server), sess.Start.Unix(), sess.Score))
+		}
+		t, ok := totals[sess.Server]
+		if !ok {
+			t = &total{server: sess.Server}
+			totals[sess.Server] = t
+		}
+		t.duration += sess.Duration()
+		t.sessions++
+	}
+
+	nowValue := "Not on any server right now."
+	if len(current) > 0 {
+		nowValue = strings.Join(current, "\n")
+	}
+
+	sorted := make([]*total, 0, len(totals))
+	for _, t := range totals {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].duration > sorted[j].duration })
+	var played []string
+	for _, t := range sorted {
+		played = append(played, fmt.Sprintf("`%-20s` | %s | %d session(s)",
+			h.cfg.DisplayName(t.server), t.duration.Round(time.Minute), t.sessions))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: player,
+		Color: 0x00bfff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Now", Value: truncate(nowValue, 1000)},
+			{Name: "Played", Value: truncate(strings.Join(played, "\n"), 1000)},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	in.respondEmbed(embed)
+}
+
+// HandleSeen executes /ned seen <player>.
+func (h *SessionsHandler) HandleSeen(_ context.Context, in *Interaction) {
+	player, ok := h.resolvePlayer(in)
+	if !ok {
+		return
+	}
+	history := h.tracker.Sessions(player)
+
+	for _, sess := range history {
+		if sess.Active {
+			in.respondNow(fmt.Sprintf("`%s` is on **%s** right now (connected <t:%d:R>).",
+				player, h.cfg.DisplayName(sess.Server), sess.Start.Unix()), false)
+			return
+		}
+	}
+	last := history[0]
+	in.respondNow(fmt.Sprintf("`%s` was last seen on **%s** <t:%d:R>.",
+		player, h.cfg.DisplayName(last.Server), last.LastSeen.Unix()), false)
+}
+
+// resolvePlayer maps the player option to exactly one tracked player name,
+// responding with an error or a list of candidates when it cannot.
+func (h *SessionsHandler) resolvePlayer(in *Interaction) (string, bool) {
+	if h.tracker == nil {
+		in.respondError("Player session tracking is disabled. Set `sessions.path` in the config to enable it.")
+		return "", false
+	}
+
+	query := stringOption(in.Command, "player")
+
+	matches := h.tracker.Match(query)
+	switch {
+	case len(matches) == 0:
+		in.respondNow(fmt.Sprintf("No player matching `%s` has been seen.", query), true)
+		return "", false
+	case len(matches) > 1:
+		more := ""
+		if len(matches) > maxPlayerMatches {
+			more = fmt.Sprintf("\n… and %d more", len(matches)-maxPlayerMatches)
+			matches = matches[:maxPlayerMatches]
+		}
+		in.respondNow(fmt.Sprintf("Several players match `%s`:\n`%s`%s",
+			query, strings.Join(matches, "`, `"), more), true)
+		return "", false
+	}
+	return matches[0], true
+}
@@ -2,44 +2,173 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"net"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/netwarlan/ned/internal/secret"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Discord     DiscordConfig         `yaml:"discord"`
-	ScriptsDir  EnvValue              `yaml:"scripts_dir"`
-	Environment string                `yaml:"environment"`
-	Servers     map[string]Server     `yaml:"servers"`
-	CS2Matches  CS2MatchConfig        `yaml:"cs2_matches"`
-	Welcome     WelcomeConfig         `yaml:"welcome"`
+	Discord      DiscordConfig                `yaml:"discord"`
+	ScriptsDir   EnvValue                     `yaml:"scripts_dir"`
+	Environment  string                       `yaml:"environment"`
+	Environments map[string]EnvironmentConfig `yaml:"environments"`
+	Servers      map[string]Server            `yaml:"servers"`
+	CS2Matches   CS2MatchConfig               `yaml:"cs2_matches"`
+	Welcome      WelcomeConfig                `yaml:"welcome"`
+	Roles        map[string][]string          `yaml:"roles"`
+	RCONPolicy   RCONPolicyConfig             `yaml:"rcon_policy"`
+	Audit        AuditConfig                  `yaml:"audit"`
+	Secrets      SecretsConfig                `yaml:"secrets"`
+	Logging      LoggingConfig                `yaml:"logging"`
+	Metrics      MetricsConfig                `yaml:"metrics"`
+	History      HistoryConfig                `yaml:"history"`
+	Sessions     SessionsConfig               `yaml:"sessions"`
+	API          APIConfig                    `yaml:"api"`
+	Dashboard    DashboardConfig              `yaml:"dashboard"`
+	Docker       DockerConfig                 `yaml:"docker"`
+	Updates      UpdatesConfig                `yaml:"updates"`
+
+	// Profiles are named sets of servers to run together, e.g. one per
+	// event day. Entries are server keys or globs such as "cs2-*".
+	Profiles map[string][]string `yaml:"profiles"`
+
+	// PollInterval is how often servers are queried for metrics and history.
+	PollInterval time.Duration `yaml:"poll_interval"`
 
 	// Resolved at load time from Environment
 	ResolvedScriptsDir string `yaml:"-"`
+
+	// disabled holds the servers left out of the active environment.
+	disabled map[string]bool
+
+	// Opened at load time when secrets.file is set
+	SecretStore *secret.Store `yaml:"-"`
+
+	// doc is the parsed file, used to report problems with line numbers.
+	doc *yaml.Node
+
+	// local is set by Options.Local: credentials only the bot's Discord session
+	// and listeners use are neither resolved nor required.
+	local bool
+
+	// secretRefs holds the unresolved value of each credential field, keyed
+	// by config path, so rotated secrets can be written back.
+	secretRefs map[string]string
+
+	// rotatedMu guards rotated, the RCON passwords changed at runtime. They
+	// take precedence over the loaded values.
+	rotatedMu sync.RWMutex
+	rotated   map[string]string
 }
 
 // EnvValue holds per-environment values. Can be specified as a simple string
-// (used for both environments) or as event/local sub-keys.
+// (used for every environment) or as a map keyed by environment name.
 type EnvValue struct {
-	Event string `yaml:"event"`
-	Local string `yaml:"local"`
+	All   string
+	ByEnv map[string]string
 }
 
 func (e *EnvValue) UnmarshalYAML(value *yaml.Node) error {
-	// Try as a simple string first
-	var s string
-	if value.Decode(&s) == nil {
-		e.Event = s
-		e.Local = s
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&e.All)
+	}
+	return value.Decode(&e.ByEnv)
+}
+
+// For returns the value for the named environment.
+func (e EnvValue) For(env string) string {
+	if v, ok := e.ByEnv[env]; ok {
+		return v
+	}
+	return e.All
+}
+
+// defaultEnvironments are the environments available when the config does
+// not declare any under environments.
+var defaultEnvironments = []string{"event", "local"}
+
+// EnvironmentConfig holds the settings of one named environment.
+type EnvironmentConfig struct {
+	ScriptsDir string `yaml:"scripts_dir"` // overrides scripts_dir
+	Network    string `yaml:"network"`     // NetworkMACVLAN or NetworkPorts; see Config.Network
+}
+
+// Environment networks. Under MAC VLAN every server container has its own
+// IP, so two servers sharing one cannot run at once. With port mapping
+// servers share the host's IP and only need distinct ports.
+const (
+	NetworkMACVLAN = "macvlan"
+	NetworkPorts   = "ports"
+)
+
+// defaultNetworks are the networks of defaultEnvironments, also used when
+// an environment of the same name is declared without one.
+var defaultNetworks = map[string]string{"event": NetworkMACVLAN, "local": NetworkPorts}
+
+// Network returns the network of the active environment: the one it
+// declares, else its default network, else NetworkPorts.
+func (c *Config) Network() string {
+	if n := c.Environments[c.Environment].Network; n != "" {
+		return n
+	}
+	if n := defaultNetworks[c.Environment]; n != "" {
+		return n
+	}
+	return NetworkPorts
+}
+
+// AddressPeers returns the sorted keys of the other servers that cannot run
+// alongside key because they share its address: its IP under MAC VLAN, or
+// its IP and one of its ports with port mapping.
+func (c *Config) AddressPeers(key string) []string {
+	srv, ok := c.Servers[key]
+	if !ok || srv.IP == "" {
 		return nil
 	}
-	// Otherwise decode as struct with event/local keys
-	type raw EnvValue
-	return value.Decode((*raw)(e))
+	var peers []string
+	for other, o := range c.Servers {
+		if other == key || o.IP != srv.IP {
+			continue
+		}
+		if c.Network() == NetworkMACVLAN || sharesPort(srv, o) {
+			peers = append(peers, other)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// StartConflicts returns the sorted keys of the servers that must not be
+// running when key starts: its AddressPeers and the servers it conflicts
+// with.
+func (c *Config) StartConflicts(key string) []string {
+	peers := c.AddressPeers(key)
+	for other := range c.Servers {
+		if other != key && c.Conflicts(key, other) && !slices.Contains(peers, other) {
+			peers = append(peers, other)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// sharesPort reports whether a and b use a port in common.
+func sharesPort(a, b Server) bool {
+	for _, p := range []int{a.Port, a.QueryPort, a.RCONPort} {
+		if p > 0 && slices.Contains([]int{b.Port, b.QueryPort, b.RCONPort}, p) {
+			return true
+		}
+	}
+	return false
 }
 
 // WelcomeConfig defines the preformatted welcome message structure.
@@ -66,6 +195,95 @@ type WelcomeServerEntry struct {
 	NoURL      bool   `yaml:"no_url"`      // skip the connect.netwar.org URL line
 }
 
+// RCONPolicyConfig restricts which RCON commands each Ned role may send.
+// Default rules apply to every server; Servers entries override them for
+// server keys matching a glob (e.g. "rust" or "match-pro-*").
+// An empty policy allows every command.
+type RCONPolicyConfig struct {
+	Default map[string]RCONRule            `yaml:"default"` // role → rule
+	Servers map[string]map[string]RCONRule `yaml:"servers"` // server glob → role → rule
+}
+
+// RCONRule is a pair of regex lists. A command is allowed when it matches at
+// least one allow pattern and no deny pattern.
+type RCONRule struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// SecretsConfig locates the encrypted secrets file used by "secret:name"
+// references. The key is read from KeyFile, or from NED_SECRETS_KEY.
+type SecretsConfig struct {
+	File    string `yaml:"file"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// LoggingConfig selects the log output format and minimum level.
+type LoggingConfig struct {
+	Format string `yaml:"format"` // "text" (default) or "json"
+	Level  string `yaml:"level"`  // "debug", "info" (default), "warn", "error"
+}
+
+// MetricsConfig enables the Prometheus /metrics listener.
+type MetricsConfig struct {
+	Listen string `yaml:"listen"` // e.g. ":9100"; empty disables metrics
+}
+
+// HistoryConfig enables durable player count history for /ned stats.
+type HistoryConfig struct {
+	Path      string        `yaml:"path"`      // JSON lines file; empty disables history
+	Retention time.Duration `yaml:"retention"` // samples older than this are dropped; 0 keeps all
+}
+
+// SessionsConfig enables player session tracking for /ned whois and /ned seen.
+type SessionsConfig struct {
+	Path string `yaml:"path"` // JSON state file; empty disables tracking
+}
+
+// APIConfig enables the authenticated HTTP API.
+type APIConfig struct {
+	Listen string     `yaml:"listen"` // e.g. ":8080"; empty disables the API
+	Tokens []APIToken `yaml:"tokens"`
+}
+
+// APIToken is a bearer token accepted by the HTTP API. Requests made with it
+// act as a caller named Name holding Roles (keys of config.roles), so the
+// RCON policy applies to them like it does to Discord users.
+type APIToken struct {
+	Name  string   `yaml:"name"`
+	Token string   `yaml:"token"` // literal or secret reference
+	Roles []string `yaml:"roles"`
+}
+
+// DashboardConfig enables the staff web dashboard. Staff sign in with
+// Discord OAuth2; their guild roles map to Ned roles exactly as they do for
+// slash commands.
+type DashboardConfig struct {
+	Listen       string        `yaml:"listen"`        // e.g. ":8081"; empty disables the dashboard
+	URL          string        `yaml:"url"`           // public base URL, used for the OAuth2 redirect
+	ClientID     string        `yaml:"client_id"`     // Discord application client ID
+	ClientSecret string        `yaml:"client_secret"` // literal or secret reference
+	Roles        []string      `yaml:"roles"`         // Ned roles allowed to sign in; empty allows any
+	SessionTTL   time.Duration `yaml:"session_ttl"`   // how long a sign-in lasts; default 12h
+}
+
+// DockerConfig locates the Docker Engine used by servers with executor
+// "docker".
+type DockerConfig struct {
+	Socket string `yaml:"socket"` // unix socket path; default /var/run/docker.sock
+}
+
+// UpdatesConfig controls /ned update.
+type UpdatesConfig struct {
+	Timeout   time.Duration `yaml:"timeout"`    // how long a script update may run; default 30m
+	WarnDelay time.Duration `yaml:"warn_delay"` // between warning players and stopping their server; default 30s
+}
+
+// AuditConfig controls where audit entries are written.
+type AuditConfig struct {
+	Path string `yaml:"path"` // JSON lines file; empty logs entries instead
+}
+
 type DiscordConfig struct {
 	Token   string `yaml:"token"`
 	GuildID string `yaml:"guild_id"`
@@ -77,10 +295,34 @@ type Server struct {
 	Protocol     string `yaml:"protocol"`
 	RCONPassword string `yaml:"rcon_password"`
 	Category     string `yaml:"category"`
-
-	// Environment-specific connection details
-	Event ServerEnv `yaml:"event"`
-	Local ServerEnv `yaml:"local"`
+	Enabled      *bool  `yaml:"enabled"` // nil means enabled
+
+	// Executor selects how the server is started and stopped: "shell" (the
+	// default) runs Script, "docker" manages the containers of the compose
+	// project ComposeProject, which defaults to the server key.
+	Executor       string `yaml:"executor"`
+	ComposeProject string `yaml:"compose_project"`
+
+	// ShutdownGrace is how long /ned stop waits for players to leave. They
+	// are warned over RCON, and the server stops early once it empties or
+	// the map ends. Zero stops immediately.
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"`
+
+	// DependsOn lists servers that must be running before this one starts,
+	// and so are stopped after it. ConflictsWith lists servers that cannot
+	// run alongside it, e.g. because they share its IP; the conflict holds
+	// in both directions. Both are used by startup profiles.
+	DependsOn     []string `yaml:"depends_on"`
+	ConflictsWith []string `yaml:"conflicts_with"`
+
+	// LogsVerb is the script command that prints recent output for
+	// /ned logs, e.g. "logs"; empty when the script has none. Docker
+	// servers read their container logs instead.
+	LogsVerb string `yaml:"logs_verb"`
+
+	// Environment-specific connection details and overrides, keyed by
+	// environment name, e.g. "event:" and "local:" blocks
+	Environments map[string]ServerEnv `yaml:",inline"`
 
 	// Resolved at load time from the active environment
 	IP        string `yaml:"-"`
@@ -89,12 +331,33 @@ type Server struct {
 	RCONPort  int    `yaml:"-"`
 }
 
-// ServerEnv holds the environment-specific connection fields for a server.
+// Server executors.
+const (
+	ExecutorShell  = "shell"
+	ExecutorDocker = "docker"
+)
+
+// ServerEnv holds the environment-specific connection fields for a server,
+// and optionally overrides any of its other fields in that environment.
 type ServerEnv struct {
 	IP        string `yaml:"ip"`
 	Port      int    `yaml:"port"`
 	QueryPort int    `yaml:"query_port"`
 	RCONPort  int    `yaml:"rcon_port"`
+
+	DisplayName  string `yaml:"display_name"`
+	Script       string `yaml:"script"`
+	Protocol     string `yaml:"protocol"`
+	RCONPassword string `yaml:"rcon_password"`
+	Category     string `yaml:"category"`
+	Enabled      *bool  `yaml:"enabled"`
+
+	Executor       string         `yaml:"executor"`
+	ComposeProject string         `yaml:"compose_project"`
+	LogsVerb       string         `yaml:"logs_verb"`
+	ShutdownGrace  *time.Duration `yaml:"shutdown_grace"` // nil keeps the default; 0 disables it
+	DependsOn      []string       `yaml:"depends_on"`     // nil keeps the default; [] clears it
+	ConflictsWith  []string       `yaml:"conflicts_with"` // nil keeps the default; [] clears it
 }
 
 type CS2MatchConfig struct {
@@ -106,90 +369,242 @@ type CS2MatchConfig struct {
 	Pro          MatchTierConfig `yaml:"pro"`
 }
 
+// MatchTierConfig sizes a tier of match instances. Instance addresses come
+// from IPs when listed there, otherwise from IPRange or IPBase; see
+// InstanceIP.
 type MatchTierConfig struct {
-	MaxInstances  int    `yaml:"max_instances"`
-	IPBase        string `yaml:"ip_base"`
-	CPUBase       int    `yaml:"cpu_base"`
-	DisplayPrefix string `yaml:"display_prefix"`
+	MaxInstances  int      `yaml:"max_instances"`
+	IPBase        string   `yaml:"ip_base"`  // instance n gets ip_base + n
+	IPRange       string   `yaml:"ip_range"` // CIDR ("10.10.10.128/27") or "first-last"
+	IPs           []string `yaml:"ips"`      // per-instance overrides; entry i is instance i+1, "" to allocate
+	CPUBase       int      `yaml:"cpu_base"`
+	DisplayPrefix string   `yaml:"display_prefix"`
 }
 
 // Load reads and validates the config file. Environment variables
-// referenced as ${VAR_NAME} in string values are expanded.
+// referenced as ${VAR_NAME} in string values are expanded, and credential
+// fields may use secret references (file:, env:, secret:).
 func Load(path string) (*Config, error) {
+	return LoadWith(path, Options{})
+}
+
+// Options adjust how a config file is loaded.
+type Options struct {
+	// Environment selects the active environment instead of the file's
+	// environment key, e.g. from --env.
+	Environment string
+	// Local is for running commands on the host without the bot, e.g. while
+	// Discord is down. The Discord token, guild, API tokens and dashboard
+	// client secret are not resolved or required.
+	Local bool
+}
+
+// LoadWith is Load with options.
+func LoadWith(path string, opts Options) (*Config, error) {
+	cfg, problems, err := parse(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if errs := errorsOnly(problems); len(errs) > 0 {
+		return nil, fmt.Errorf("validating config: %w", &ValidationError{Problems: errs})
+	}
+	return cfg, nil
+}
+
+// Check reads the config file at path and reports every problem in it at
+// once, including warnings Load tolerates, such as scripts missing from
+// scripts_dir. The error is only for files that cannot be read or parsed.
+func Check(path string, opts Options) ([]Problem, error) {
+	_, problems, err := parse(path, opts)
+	return problems, err
+}
+
+// parse reads, resolves and validates the config file at path.
+func parse(path string, opts Options) (*Config, []Problem, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("reading config: %w", err)
+		return nil, nil, fmt.Errorf("reading config: %w", err)
 	}
 
 	expanded := os.ExpandEnv(string(data))
 
-	var cfg Config
-	if err := yaml.Unmarshal([]byte(expanded), &cfg); err != nil {
-		return nil, fmt.Errorf("parsing config: %w", err)
+	// The node tree is kept to point problems at their line.
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(expanded), &doc); err != nil {
+		return nil, nil, fmt.Errorf("parsing config: %w", err)
+	}
+	cfg := Config{local: opts.Local, doc: &doc}
+	if err := doc.Decode(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if opts.Environment != "" {
+		cfg.Environment = opts.Environment
 	}
 
+	// Overrides are applied first, so that the secrets they name are the
+	// ones resolved.
 	cfg.resolveEnvironment()
+	problems := cfg.resolveSecrets()
+	cfg.applyDefaults()
+	problems = append(problems, cfg.problems()...)
+	return &cfg, cfg.locate(problems), nil
+}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("validating config: %w", err)
+// RolesFor maps Discord role IDs to the Ned role names configured under roles.
+func (c *Config) RolesFor(discordRoleIDs []string) []string {
+	var names []string
+	for name, ids := range c.Roles {
+		for _, id := range ids {
+			if slices.Contains(discordRoleIDs, id) {
+				names = append(names, name)
+				break
+			}
+		}
 	}
-
-	return &cfg, nil
+	sort.Strings(names)
+	return names
 }
 
-func (c *Config) Validate() error {
-	if c.Discord.Token == "" {
-		return fmt.Errorf("discord.token is required")
+// applyDefaults fills in optional settings that were left unset.
+func (c *Config) applyDefaults() {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 30 * time.Second
 	}
-	if c.Discord.GuildID == "" {
-		return fmt.Errorf("discord.guild_id is required")
+	if c.Dashboard.SessionTTL <= 0 {
+		c.Dashboard.SessionTTL = 12 * time.Hour
 	}
-	if c.ResolvedScriptsDir == "" {
-		return fmt.Errorf("scripts_dir is required (for environment %q)", c.Environment)
+	if c.Updates.Timeout <= 0 {
+		c.Updates.Timeout = 30 * time.Minute
 	}
-	if c.Environment != "event" && c.Environment != "local" {
-		return fmt.Errorf("environment must be \"event\" or \"local\", got %q", c.Environment)
+	if c.Updates.WarnDelay <= 0 {
+		c.Updates.WarnDelay = 30 * time.Second
 	}
-	for name, srv := range c.Servers {
-		if srv.Script == "" {
-			return fmt.Errorf("server %q: script is required", name)
+	if c.Docker.Socket == "" {
+		c.Docker.Socket = "/var/run/docker.sock"
+	}
+	for key, srv := range c.Servers {
+		if srv.Executor == ExecutorDocker && srv.ComposeProject == "" {
+			srv.ComposeProject = key
+			c.Servers[key] = srv
 		}
-		if srv.Protocol != "source" && srv.Protocol != "none" {
-			return fmt.Errorf("server %q: protocol must be \"source\" or \"none\", got %q", name, srv.Protocol)
+	}
+}
+
+// resolveSecrets replaces secret references in credential fields with their
+// plaintext values. New credential fields must be resolved here too. Fields
+// that fail to resolve keep their reference and are reported as problems.
+func (c *Config) resolveSecrets() []Problem {
+	var problems []Problem
+	if c.Secrets.File != "" {
+		store, err := loadStore(c.Secrets.File, c.Secrets.KeyFile)
+		if err != nil {
+			problems = append(problems, Problem{Field: "secrets.file", Msg: "loading secrets: " + err.Error()})
 		}
+		c.SecretStore = store
 	}
-	if c.CS2Matches.Script == "" {
-		return fmt.Errorf("cs2_matches.script is required")
+
+	c.secretRefs = make(map[string]string)
+	resolve := func(field string, ptr *string) {
+		c.secretRefs[field] = *ptr
+		value, err := secret.Resolve(*ptr, c.SecretStore)
+		if err != nil {
+			problems = append(problems, Problem{Field: field, Msg: "resolving secret: " + err.Error()})
+			return
+		}
+		if value != "" && len(value) < secret.MinLen {
+			// Too short to redact, so it would show up in logs and replies.
+			problems = append(problems, Problem{Field: field, Msg: fmt.Sprintf("must be at least %d characters", secret.MinLen)})
+		}
+		*ptr = value
 	}
-	return nil
+
+	resolve("cs2_matches.rcon_password", &c.CS2Matches.RCONPassword)
+	for _, key := range slices.Sorted(maps.Keys(c.Servers)) {
+		srv := c.Servers[key]
+		resolve(rconPasswordField(key), &srv.RCONPassword)
+		c.Servers[key] = srv
+	}
+	if c.local {
+		return problems
+	}
+
+	resolve("discord.token", &c.Discord.Token)
+	for i := range c.API.Tokens {
+		resolve(fmt.Sprintf("api.tokens[%d].token", i), &c.API.Tokens[i].Token)
+	}
+	resolve("dashboard.client_secret", &c.Dashboard.ClientSecret)
+	return problems
+}
+
+func loadStore(file, keyFile string) (*secret.Store, error) {
+	key, err := secret.LoadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return secret.OpenStore(file, key)
 }
 
-// resolveEnvironment populates resolved fields (IP, Port, etc.) from
-// the active environment's config block (event or local).
+// resolveEnvironment populates resolved fields (IP, Port, etc.) from the
+// active environment's config blocks and applies its per-server overrides.
+// Servers disabled in the environment are removed.
 func (c *Config) resolveEnvironment() {
-	switch c.Environment {
-	case "local":
-		c.ResolvedScriptsDir = c.ScriptsDir.Local
-	default:
-		c.ResolvedScriptsDir = c.ScriptsDir.Event
+	c.ResolvedScriptsDir = c.ScriptsDir.For(c.Environment)
+	if dir := c.Environments[c.Environment].ScriptsDir; dir != "" {
+		c.ResolvedScriptsDir = dir
 	}
 
+	c.disabled = make(map[string]bool)
 	for key, srv := range c.Servers {
-		var env ServerEnv
-		switch c.Environment {
-		case "local":
-			env = srv.Local
-		default:
-			env = srv.Event
-		}
+		env := srv.Environments[c.Environment]
 		srv.IP = env.IP
 		srv.Port = env.Port
 		srv.QueryPort = env.QueryPort
 		srv.RCONPort = env.RCONPort
+
+		override(&srv.DisplayName, env.DisplayName)
+		override(&srv.Script, env.Script)
+		override(&srv.Protocol, env.Protocol)
+		override(&srv.RCONPassword, env.RCONPassword)
+		override(&srv.Category, env.Category)
+		override(&srv.Executor, env.Executor)
+		override(&srv.ComposeProject, env.ComposeProject)
+		override(&srv.LogsVerb, env.LogsVerb)
+		if env.Enabled != nil {
+			srv.Enabled = env.Enabled
+		}
+		if env.ShutdownGrace != nil {
+			srv.ShutdownGrace = *env.ShutdownGrace
+		}
+		if env.DependsOn != nil {
+			srv.DependsOn = env.DependsOn
+		}
+		if env.ConflictsWith != nil {
+			srv.ConflictsWith = env.ConflictsWith
+		}
+
+		if srv.Enabled != nil && !*srv.Enabled {
+			delete(c.Servers, key)
+			c.disabled[key] = true
+			continue
+		}
 		c.Servers[key] = srv
 	}
 }
 
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+// EnvironmentNames returns the environments the config declares, sorted.
+func (c *Config) EnvironmentNames() []string {
+	if len(c.Environments) == 0 {
+		return defaultEnvironments
+	}
+	return slices.Sorted(maps.Keys(c.Environments))
+}
+
 // QueryableServers returns servers with protocol "source" that support A2S queries.
 func (c *Config) QueryableServers() map[string]Server {
 	result := make(map[string]Server)
@@ -202,9 +617,11 @@ func (c *Config) QueryableServers() map[string]Server {
 }
 
 // RCONCapableServers returns servers that have an RCON port and password configured.
+// RCONPassword reflects any runtime rotation.
 func (c *Config) RCONCapableServers() map[string]Server {
 	result := make(map[string]Server)
 	for name, srv := range c.Servers {
+		srv.RCONPassword = c.RCONPassword(name)
 		if srv.RCONPort > 0 && srv.RCONPassword != "" {
 			result[name] = srv
 		}
@@ -212,15 +629,58 @@ func (c *Config) RCONCapableServers() map[string]Server {
 	return result
 }
 
-// InstanceIP computes the IP address for a CS2 match instance.
-// For instance number n (1-based), it adds n to the base IP's last octet.
-func (t *MatchTierConfig) InstanceIP(n int) string {
-	ip := net.ParseIP(t.IPBase).To4()
-	if ip == nil {
-		return ""
+// RCONPassword returns the current RCON password for a server key or match
+// instance, preferring a password rotated at runtime over the loaded one.
+func (c *Config) RCONPassword(key string) string {
+	c.rotatedMu.RLock()
+	pw, ok := c.rotated[key]
+	c.rotatedMu.RUnlock()
+	if ok {
+		return pw
+	}
+	if srv, ok := c.Servers[key]; ok {
+		return srv.RCONPassword
 	}
-	ip[3] += byte(n)
-	return ip.String()
+	if strings.HasPrefix(key, "match-") {
+		return c.CS2Matches.RCONPassword
+	}
+	return ""
+}
+
+// SetRCONPassword records a password changed at runtime for a server key or
+// match instance. It is visible to every RCON lookup immediately.
+func (c *Config) SetRCONPassword(key, password string) {
+	secret.Register(password)
+	c.rotatedMu.Lock()
+	defer c.rotatedMu.Unlock()
+	if c.rotated == nil {
+		c.rotated = make(map[string]string)
+	}
+	c.rotated[key] = password
+}
+
+// RCONPasswordRef returns the unresolved rcon_password value behind a server
+// key or match instance, e.g. "secret:cs2_rcon". Match instances share
+// cs2_matches.rcon_password.
+func (c *Config) RCONPasswordRef(key string) string {
+	return c.secretRefs[rconPasswordField(key)]
+}
+
+// PersistRCONPassword writes password back to the secret reference behind
+// key. Only file: and secret: references can be written.
+func (c *Config) PersistRCONPassword(key, password string) error {
+	field := rconPasswordField(key)
+	if err := secret.Persist(c.secretRefs[field], password, c.SecretStore); err != nil {
+		return fmt.Errorf("persisting %s: %w", field, err)
+	}
+	return nil
+}
+
+func rconPasswordField(key string) string {
+	if strings.HasPrefix(key, "match-") {
+		return "cs2_matches.rcon_password"
+	}
+	return "servers." + key + ".rcon_password"
 }
 
 // ServerChoices returns a sorted list of server keys for Discord autocomplete.
@@ -249,10 +709,10 @@ func (c *Config) AllCS2RCONTargets() map[string]RCONTarget {
 	targets := make(map[string]RCONTarget)
 
 	for name, srv := range c.Servers {
-		if srv.Category == "cs2" && srv.RCONPort > 0 && srv.RCONPassword != "" {
+		if password := c.RCONPassword(name); srv.Category == "cs2" && srv.RCONPort > 0 && password != "" {
 			targets[name] = RCONTarget{
 				Address:  net.JoinHostPort(srv.IP, strconv.Itoa(srv.RCONPort)),
-				Password: srv.RCONPassword,
+				Password: password,
 			}
 		}
 	}
@@ -261,7 +721,7 @@ func (c *Config) AllCS2RCONTargets() map[string]RCONTarget {
 		name := fmt.Sprintf("match-pro-%d", i)
 		targets[name] = RCONTarget{
 			Address:  net.JoinHostPort(c.CS2Matches.Pro.InstanceIP(i), strconv.Itoa(c.CS2Matches.RCONPort)),
-			Password: c.CS2Matches.RCONPassword,
+			Password: c.RCONPassword(name),
 		}
 	}
 
@@ -316,10 +776,15 @@ func (c *Config) BuildWelcomeMessage() string {
 			continue
 		}
 
-		for j, entry := range section.Servers {
-			if j > 0 {
+		written := 0
+		for _, entry := range section.Servers {
+			if c.disabled[entry.Key] {
+				continue
+			}
+			if written > 0 {
 				sb.WriteString("\n")
 			}
+			written++
 
 			ip, port := entry.IP, entry.Port
 			if entry.Key != "" {
@@ -336,12 +801,12 @@ func (c *Config) BuildWelcomeMessage() string {
 
 			if entry.Label != "" {
 				if !entry.NoURL && c.Welcome.ConnectBaseURL != "" {
-					sb.WriteString(fmt.Sprintf("%s : %s/?%s:%d\n", entry.Label, c.Welcome.ConnectBaseURL, ip, port))
+					sb.WriteString(fmt.Sprintf("%s : %s/?%s\n", entry.Label, c.Welcome.ConnectBaseURL, net.JoinHostPort(ip, strconv.Itoa(port))))
 				} else {
 					sb.WriteString(fmt.Sprintf("%s :\n", entry.Label))
 				}
 			} else if !entry.NoURL && c.Welcome.ConnectBaseURL != "" {
-				sb.WriteString(fmt.Sprintf("%s/?%s:%d\n", c.Welcome.ConnectBaseURL, ip, port))
+				sb.WriteString(fmt.Sprintf("%s/?%s\n", c.Welcome.ConnectBaseURL, net.JoinHostPort(ip, strconv.Itoa(port))))
 			}
 
 			sb.WriteString(fmt.Sprintf("In game: `%s %s`\n", connectCmd, ip))
@@ -368,9 +833,9 @@ func (c *Config) BuildTournamentMessage(count int) string {
 			sb.WriteString("\n")
 		}
 		ip := c.CS2Matches.Pro.InstanceIP(i)
-		port := c.CS2Matches.RCONPort
+		port := strconv.Itoa(c.CS2Matches.RCONPort)
 		if c.Welcome.ConnectBaseURL != "" {
-			sb.WriteString(fmt.Sprintf("MATCH %d : %s/?%s:%d\n", i, c.Welcome.ConnectBaseURL, ip, port))
+			sb.WriteString(fmt.Sprintf("MATCH %d : %s/?%s\n", i, c.Welcome.ConnectBaseURL, net.JoinHostPort(ip, port)))
 		} else {
 			sb.WriteString(fmt.Sprintf("MATCH %d :\n", i))
 		}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -90,7 +96,7 @@ environment: "event"
 servers: {}
 cs2_matches:
   script: "cs2/match/match.sh"
-  rcon_password: "pw"
+  rcon_password: "match-pw"
   rcon_port: 27015
   protocol: "source"
 `
@@ -112,7 +118,7 @@ cs2_matches:
 func TestLoad_PerEnvironmentScriptsDir(t *testing.T) {
 	content := `
 discord:
-  token: "tok"
+  token: "token"
   guild_id: "123456"
 scripts_dir:
   event: "/home/docker/netwar46.0"
@@ -121,7 +127,7 @@ environment: "local"
 servers: {}
 cs2_matches:
   script: "cs2/cs2.sh"
-  rcon_password: "pw"
+  rcon_password: "match-pw"
   rcon_port: 27015
   protocol: "source"
 `
@@ -140,6 +146,130 @@ cs2_matches:
 	}
 }
 
+func TestLoad_NamedEnvironments(t *testing.T) {
+	content := `
+discord:
+  token: "token"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+environments:
+  event: {}
+  local: {}
+  staging:
+    scripts_dir: "/srv/staging-scripts"
+servers:
+  tf2:
+    display_name: "TF2"
+    script: "tf2/tf2.sh"
+    protocol: "source"
+    category: "game"
+    rcon_password: "event-pw"
+    logs_verb: "logs"
+    shutdown_grace: 5m
+    depends_on: ["rust"]
+    event:
+      ip: "10.10.10.122"
+      port: 27015
+    local:
+      ip: "127.0.0.1"
+      port: 27015
+      executor: "docker"
+      compose_project: "tf2-dev"
+      logs_verb: "tail"
+    staging:
+      ip: "192.168.50.10"
+      port: 27016
+      script: "tf2/tf2-staging.sh"
+      rcon_password: "staging-pw"
+      shutdown_grace: 0s
+      depends_on: []
+      conflicts_with: ["minecraft"]
+  rust:
+    script: "rust/rust.sh"
+    protocol: "none"
+    category: "game"
+    staging:
+      enabled: false
+  minecraft:
+    script: "minecraft/minecraft.sh"
+    protocol: "none"
+    category: "game"
+    enabled: false
+    local:
+      enabled: true
+cs2_matches:
+  script: "cs2/cs2.sh"
+welcome:
+  sections:
+    - title: "Servers"
+      servers:
+        - key: "tf2"
+        - key: "rust"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadWith(path, Options{Environment: "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Environment != "staging" {
+		t.Errorf("environment = %q, want the --env override", cfg.Environment)
+	}
+	if cfg.ResolvedScriptsDir != "/srv/staging-scripts" {
+		t.Errorf("scripts_dir = %q, want %q", cfg.ResolvedScriptsDir, "/srv/staging-scripts")
+	}
+	tf2 := cfg.Servers["tf2"]
+	if tf2.IP != "192.168.50.10" || tf2.Port != 27016 || tf2.Script != "tf2/tf2-staging.sh" || tf2.RCONPassword != "staging-pw" {
+		t.Errorf("tf2 = %+v, want the staging overrides", tf2)
+	}
+	if tf2.DisplayName != "TF2" || tf2.LogsVerb != "logs" || tf2.Executor != "" {
+		t.Errorf("tf2 = %+v, want the defaults kept", tf2)
+	}
+	if tf2.ShutdownGrace != 0 || len(tf2.DependsOn) != 0 || !slices.Equal(tf2.ConflictsWith, []string{"minecraft"}) {
+		t.Errorf("tf2 grace %s, depends_on %q, conflicts_with %q, want the staging overrides", tf2.ShutdownGrace, tf2.DependsOn, tf2.ConflictsWith)
+	}
+	if _, ok := cfg.Servers["rust"]; ok {
+		t.Error("rust is disabled in staging but was loaded")
+	}
+	if _, ok := cfg.Servers["minecraft"]; ok {
+		t.Error("minecraft is disabled by default but was loaded")
+	}
+	if msg := cfg.BuildWelcomeMessage(); strings.Contains(msg, "\n\n") {
+		t.Errorf("welcome message has a gap for the disabled server:\n%s", msg)
+	}
+
+	cfg, err = LoadWith(path, Options{Environment: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Servers["minecraft"]; !ok {
+		t.Error("minecraft is enabled in local but was not loaded")
+	}
+	tf2 = cfg.Servers["tf2"]
+	if tf2.RCONPassword != "event-pw" || tf2.ShutdownGrace != 5*time.Minute || !slices.Equal(tf2.DependsOn, []string{"rust"}) {
+		t.Errorf("tf2 = %+v, want the defaults outside staging", tf2)
+	}
+	if tf2.Executor != ExecutorDocker || tf2.ComposeProject != "tf2-dev" || tf2.LogsVerb != "tail" {
+		t.Errorf("tf2 executor %q, compose_project %q, logs_verb %q, want the local overrides", tf2.Executor, tf2.ComposeProject, tf2.LogsVerb)
+	}
+
+	if _, err := LoadWith(path, Options{Environment: "production"}); err == nil || !strings.Contains(err.Error(), "must be one of event, local, staging") {
+		t.Errorf("err = %v, want an unknown environment error", err)
+	}
+
+	undeclared := strings.Replace(content, "    staging:\n      enabled: false", "    prod:\n      enabled: false", 1)
+	if err := os.WriteFile(path, []byte(undeclared), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), `servers.rust.prod: unknown environment "prod"`) {
+		t.Errorf("err = %v, want an unknown environment block error", err)
+	}
+}
+
 func TestValidate_MissingToken(t *testing.T) {
 	cfg := &Config{
 		Discord:            DiscordConfig{GuildID: "123"},
@@ -152,6 +282,48 @@ func TestValidate_MissingToken(t *testing.T) {
 	}
 }
 
+func TestLoadWith_LocalSkipsBotCredentials(t *testing.T) {
+	t.Setenv("NED_TEST_RCON", "rconpw")
+	content := `
+discord:
+  token: "env:NED_TEST_UNSET_TOKEN"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  tf2:
+    display_name: "TF2"
+    script: "tf2/tf2.sh"
+    protocol: "source"
+    category: "game"
+    rcon_password: "env:NED_TEST_RCON"
+    event:
+      ip: "10.10.10.122"
+      query_port: 27015
+cs2_matches:
+  script: "cs2/cs2.sh"
+api:
+  listen: ":8080"
+  tokens:
+    - name: "web"
+      token: "env:NED_TEST_UNSET_API"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("Load: expected error for the unset Discord token")
+	}
+	cfg, err := LoadWith(path, Options{Local: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Servers["tf2"].RCONPassword; got != "rconpw" {
+		t.Errorf("rcon_password = %q, want it resolved", got)
+	}
+}
+
 func TestValidate_InvalidEnvironment(t *testing.T) {
 	cfg := &Config{
 		Discord:            DiscordConfig{Token: "tok", GuildID: "123"},
@@ -164,6 +336,274 @@ func TestValidate_InvalidEnvironment(t *testing.T) {
 	}
 }
 
+func TestLoad_DockerExecutor(t *testing.T) {
+	content := `
+discord:
+  token: "token"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  tf2:
+    executor: "docker"
+    protocol: "none"
+    category: "game"
+  rust:
+    executor: "docker"
+    compose_project: "rust-event"
+    protocol: "none"
+    category: "game"
+cs2_matches:
+  script: "cs2/cs2.sh"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Servers["tf2"].ComposeProject; got != "tf2" {
+		t.Errorf("tf2 compose_project = %q, want the server key", got)
+	}
+	if got := cfg.Servers["rust"].ComposeProject; got != "rust-event" {
+		t.Errorf("rust compose_project = %q, want %q", got, "rust-event")
+	}
+	if cfg.Docker.Socket != "/var/run/docker.sock" {
+		t.Errorf("docker.socket = %q, want the default", cfg.Docker.Socket)
+	}
+
+	bad := strings.Replace(content, `executor: "docker"`, `executor: "podman"`, 1)
+	if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), `servers.tf2.executor: must be "shell" or "docker", got "podman"`) {
+		t.Errorf("err = %v, want an executor error", err)
+	}
+}
+
+func TestLoad_ShutdownGrace(t *testing.T) {
+	content := `
+discord:
+  token: "token"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  tf2:
+    script: "tf2/tf2.sh"
+    protocol: "source"
+    category: "game"
+    shutdown_grace: 5m
+    event:
+      ip: "10.0.0.1"
+      query_port: 27015
+cs2_matches:
+  script: "cs2/cs2.sh"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Servers["tf2"].ShutdownGrace; got != 5*time.Minute {
+		t.Errorf("shutdown_grace = %s, want 5m", got)
+	}
+
+	bad := strings.Replace(content, "shutdown_grace: 5m", "shutdown_grace: -1m", 1)
+	if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "servers.tf2.shutdown_grace: must not be negative") {
+		t.Errorf("err = %v, want a shutdown_grace error", err)
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	content := `
+discord:
+  token: "token"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  connect:
+    script: "connect.sh"
+    protocol: "none"
+    category: "infra"
+  monitoring:
+    script: "monitoring.sh"
+    protocol: "none"
+    category: "infra"
+  tf2:
+    script: "tf2.sh"
+    protocol: "none"
+    category: "game"
+    depends_on: [connect]
+  tf2-mvm:
+    script: "mvm.sh"
+    protocol: "none"
+    category: "game"
+    depends_on: [tf2]
+    conflicts_with: [palworld]
+  palworld:
+    script: "palworld.sh"
+    protocol: "none"
+    category: "game"
+  cs2-1:
+    script: "cs2.sh"
+    protocol: "none"
+    category: "cs2"
+  cs2-2:
+    script: "cs2.sh"
+    protocol: "none"
+    category: "cs2"
+profiles:
+  day1: [monitoring, "cs2-*", tf2-mvm]
+  day2: [palworld]
+cs2_matches:
+  script: "cs2/cs2.sh"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, ok := cfg.ProfileServers("day1")
+	if want := []string{"connect", "cs2-1", "cs2-2", "monitoring", "tf2", "tf2-mvm"}; !ok || !slices.Equal(keys, want) {
+		t.Errorf("day1 = %q, want %q", keys, want)
+	}
+	order := cfg.StartOrder(keys)
+	want := [][]string{{"connect", "cs2-1", "cs2-2", "monitoring"}, {"tf2"}, {"tf2-mvm"}}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("start order = %q, want %q", order, want)
+	}
+	if !cfg.Conflicts("palworld", "tf2-mvm") {
+		t.Error("conflicts_with does not hold in both directions")
+	}
+
+	bad := strings.Replace(content, "depends_on: [connect]", "depends_on: [tf2-mvm]", 1)
+	bad = strings.Replace(bad, "day2: [palworld]", "day2: [palworld, tf2-mvm, rust]", 1)
+	if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(path)
+	for _, msg := range []string{
+		"servers.tf2.depends_on: dependency cycle: tf2 → tf2-mvm → tf2",
+		"profiles.day2: runs palworld and tf2-mvm, which conflict",
+		`profiles.day2[2]: "rust" matches no server`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("err = %v, want %q", err, msg)
+		}
+	}
+}
+
+func TestCheck_SharedIPs(t *testing.T) {
+	content := `discord:
+  token: "tok"
+  guild_id: "123"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  tf2-mvm:
+    script: "tf2.sh"
+    protocol: "none"
+    category: "game"
+    event:
+      ip: "10.10.10.123"
+      port: 27015
+    local:
+      ip: "gameservers"
+      port: 27019
+  palworld:
+    script: "palworld.sh"
+    protocol: "none"
+    category: "game"
+    event:
+      ip: "10.10.10.123"
+      port: 8211
+    local:
+      ip: "gameservers"
+      port: 8211
+cs2_matches:
+  script: "cs2/cs2.sh"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sharedIP := func(opts Options) *Problem {
+		t.Helper()
+		problems, err := Check(path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range problems {
+			if strings.HasSuffix(p.Field, ".ip") {
+				return &p
+			}
+		}
+		return nil
+	}
+
+	p := sharedIP(Options{})
+	if p == nil || !p.Warning || p.Field != "servers.tf2-mvm.event.ip" || p.Line != 12 {
+		t.Errorf("event: problem = %+v, want a warning on tf2-mvm's event ip", p)
+	}
+	// The local environment maps ports, so a shared host is expected.
+	if p := sharedIP(Options{Environment: "local"}); p != nil {
+		t.Errorf("local: problem = %+v, want none", p)
+	}
+
+	declared := strings.Replace(content, `    script: "tf2.sh"`, "    script: \"tf2.sh\"\n    conflicts_with: [palworld]", 1)
+	if err := os.WriteFile(path, []byte(declared), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p := sharedIP(Options{}); p != nil {
+		t.Errorf("with conflicts_with: problem = %+v, want none", p)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	declared := map[string]EnvironmentConfig{
+		"event":   {ScriptsDir: "/opt/scripts"},
+		"local":   {},
+		"staging": {Network: NetworkMACVLAN},
+		"lab":     {},
+	}
+	tests := []struct {
+		envs map[string]EnvironmentConfig
+		env  string
+		want string
+	}{
+		{nil, "event", NetworkMACVLAN},
+		{nil, "local", NetworkPorts},
+		{declared, "event", NetworkMACVLAN}, // declared without a network
+		{declared, "local", NetworkPorts},
+		{declared, "staging", NetworkMACVLAN},
+		{declared, "lab", NetworkPorts},
+		{map[string]EnvironmentConfig{"event": {Network: NetworkPorts}}, "event", NetworkPorts},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Environments: tt.envs, Environment: tt.env}
+		if got := cfg.Network(); got != tt.want {
+			t.Errorf("%s (declared %v): Network() = %q, want %q", tt.env, tt.envs != nil, got, tt.want)
+		}
+	}
+}
+
 func TestMatchTierConfig_InstanceIP(t *testing.T) {
 	tier := MatchTierConfig{IPBase: "10.10.10.140"}
 
@@ -183,6 +623,71 @@ func TestMatchTierConfig_InstanceIP(t *testing.T) {
 	}
 }
 
+func TestMatchTierConfig_InstanceIPAllocation(t *testing.T) {
+	tests := []struct {
+		name string
+		tier MatchTierConfig
+		n    int
+		want string
+	}{
+		{"base overflow", MatchTierConfig{IPBase: "10.10.10.250"}, 5, ""},
+		{"base last fit", MatchTierConfig{IPBase: "10.10.10.250"}, 4, "10.10.10.254"},
+		{"cidr first host", MatchTierConfig{IPRange: "10.10.10.128/28"}, 1, "10.10.10.129"},
+		{"cidr last host", MatchTierConfig{IPRange: "10.10.10.128/28"}, 14, "10.10.10.142"},
+		{"cidr broadcast", MatchTierConfig{IPRange: "10.10.10.128/28"}, 15, ""},
+		{"range", MatchTierConfig{IPRange: "10.10.10.141-10.10.10.150"}, 10, "10.10.10.150"},
+		{"range exhausted", MatchTierConfig{IPRange: "10.10.10.141-10.10.10.150"}, 11, ""},
+		{"ipv6 cidr", MatchTierConfig{IPRange: "fd00:10::/120"}, 3, "fd00:10::3"},
+		{"ipv6 base", MatchTierConfig{IPBase: "fd00:10::ff"}, 1, "fd00:10::100"},
+		{"override", MatchTierConfig{IPBase: "10.10.10.140", IPs: []string{"", "10.10.20.7"}}, 2, "10.10.20.7"},
+		{"override gap", MatchTierConfig{IPBase: "10.10.10.140", IPs: []string{"", "10.10.20.7"}}, 1, "10.10.10.141"},
+		{"no source", MatchTierConfig{}, 1, ""},
+		{"both sources", MatchTierConfig{IPBase: "10.10.10.140", IPRange: "10.10.10.128/28"}, 1, ""},
+		{"instance zero", MatchTierConfig{IPBase: "10.10.10.140", IPs: []string{"10.10.20.7"}}, 0, ""},
+		{"negative instance", MatchTierConfig{IPRange: "10.10.10.128/28", IPs: []string{"10.10.20.7"}}, -1, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.tier.InstanceIP(tt.n); got != tt.want {
+			t.Errorf("%s: InstanceIP(%d) = %q, want %q", tt.name, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_InstanceIPs(t *testing.T) {
+	tests := []struct {
+		name  string
+		pro   MatchTierConfig
+		field string // "" for valid
+	}{
+		{"valid", MatchTierConfig{MaxInstances: 10, IPBase: "10.10.10.140"}, ""},
+		{"wraps past .254", MatchTierConfig{MaxInstances: 10, IPBase: "10.10.10.250"}, "cs2_matches.pro.ip_base"},
+		{"collides with server", MatchTierConfig{MaxInstances: 10, IPRange: "10.10.10.120/28"}, "cs2_matches.pro.ip_range"},
+		{"duplicate override", MatchTierConfig{MaxInstances: 2, IPBase: "10.10.10.140", IPs: []string{"10.10.10.142"}}, "cs2_matches.pro.ip_base"},
+		{"bad override", MatchTierConfig{MaxInstances: 2, IPBase: "10.10.10.140", IPs: []string{"nope"}}, "cs2_matches.pro.ips[0]"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{
+			Discord:            DiscordConfig{Token: "tok", GuildID: "123"},
+			ResolvedScriptsDir: "/scripts",
+			Environment:        "event",
+			Servers: map[string]Server{
+				"tf2": {Script: "tf2.sh", Protocol: "source", Category: "game", IP: "10.10.10.122", QueryPort: 27015},
+			},
+			CS2Matches: CS2MatchConfig{Script: "match.sh", Pro: tt.pro},
+		}
+		err := cfg.Validate()
+		var verr *ValidationError
+		switch {
+		case tt.field == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.field != "" && !errors.As(err, &verr):
+			t.Errorf("%s: err = %v, want a ValidationError", tt.name, err)
+		case tt.field != "" && verr.Problems[0].Field != tt.field:
+			t.Errorf("%s: reported %v, want a problem with %s", tt.name, err, tt.field)
+		}
+	}
+}
+
 func TestQueryableServers(t *testing.T) {
 	cfg := &Config{
 		Servers: map[string]Server{
@@ -238,7 +743,7 @@ func TestAllCS2RCONTargets(t *testing.T) {
 func TestEnvironmentResolution_Event(t *testing.T) {
 	content := `
 discord:
-  token: "tok"
+  token: "token"
   guild_id: "123456"
 scripts_dir:
   event: "/home/docker/netwar46.0"
@@ -279,7 +784,7 @@ servers:
       rcon_port: 27016
 cs2_matches:
   script: "cs2/cs2.sh"
-  rcon_password: "pw"
+  rcon_password: "match-pw"
   rcon_port: 27015
   protocol: "source"
 `
@@ -310,7 +815,7 @@ cs2_matches:
 func TestEnvironmentResolution_Local(t *testing.T) {
 	content := `
 discord:
-  token: "tok"
+  token: "token"
   guild_id: "123456"
 scripts_dir:
   event: "/home/docker/netwar46.0"
@@ -362,7 +867,7 @@ servers:
       port: 25565
 cs2_matches:
   script: "cs2/cs2.sh"
-  rcon_password: "pw"
+  rcon_password: "match-pw"
   rcon_port: 27015
   protocol: "source"
 `
@@ -427,3 +932,362 @@ func TestDisplayName(t *testing.T) {
 		}
 	}
 }
+
+func TestValidate_InvalidRCONPolicyPattern(t *testing.T) {
+	cfg := &Config{
+		Discord:            DiscordConfig{Token: "tok", GuildID: "123"},
+		ResolvedScriptsDir: "/scripts",
+		Environment:        "event",
+		CS2Matches:         CS2MatchConfig{Script: "match.sh"},
+		RCONPolicy: RCONPolicyConfig{
+			Default: map[string]RCONRule{"volunteer": {Allow: []string{"^say("}}},
+		},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for invalid rcon_policy pattern")
+	}
+}
+
+func TestValidate_APITokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     APIConfig
+		wantErr bool
+	}{
+		{"disabled", APIConfig{}, false},
+		{"valid", APIConfig{Listen: ":8080", Tokens: []APIToken{{Name: "web", Token: "0123456789abcdef"}}}, false},
+		{"listen without tokens", APIConfig{Listen: ":8080"}, true},
+		{"short token", APIConfig{Listen: ":8080", Tokens: []APIToken{{Name: "web", Token: "short"}}}, true},
+		{"duplicate name", APIConfig{Listen: ":8080", Tokens: []APIToken{
+			{Name: "web", Token: "0123456789abcdef"},
+			{Name: "web", Token: "fedcba9876543210"},
+		}}, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{
+			Discord:            DiscordConfig{Token: "tok", GuildID: "123"},
+			ResolvedScriptsDir: "/scripts",
+			Environment:        "event",
+			CS2Matches:         CS2MatchConfig{Script: "match.sh"},
+			API:                tt.api,
+		}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate_Dashboard(t *testing.T) {
+	valid := DashboardConfig{Listen: ":8081", URL: "https://ned.example.com", ClientID: "123", ClientSecret: "s3cret"}
+	tests := []struct {
+		name    string
+		mutate  func(d *DashboardConfig)
+		roles   map[string][]string
+		wantErr bool
+	}{
+		{"valid", func(*DashboardConfig) {}, map[string][]string{"admin": {"1"}}, false},
+		{"disabled", func(d *DashboardConfig) { *d = DashboardConfig{} }, nil, false},
+		{"relative url", func(d *DashboardConfig) { d.URL = "/ned" }, map[string][]string{"admin": {"1"}}, true},
+		{"missing secret", func(d *DashboardConfig) { d.ClientSecret = "" }, map[string][]string{"admin": {"1"}}, true},
+		{"no roles configured", func(*DashboardConfig) {}, nil, true},
+		{"unknown allowed role", func(d *DashboardConfig) { d.Roles = []string{"nope"} }, map[string][]string{"admin": {"1"}}, true},
+	}
+	for _, tt := range tests {
+		d := valid
+		tt.mutate(&d)
+		cfg := &Config{
+			Discord:            DiscordConfig{Token: "tok", GuildID: "123"},
+			ResolvedScriptsDir: "/scripts",
+			Environment:        "event",
+			CS2Matches:         CS2MatchConfig{Script: "match.sh"},
+			Roles:              tt.roles,
+			Dashboard:          d,
+		}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRolesFor(t *testing.T) {
+	cfg := &Config{
+		Roles: map[string][]string{
+			"admin":     {"111"},
+			"volunteer": {"222", "333"},
+		},
+	}
+	got := cfg.RolesFor([]string{"333", "999"})
+	if len(got) != 1 || got[0] != "volunteer" {
+		t.Errorf("RolesFor = %v, want [volunteer]", got)
+	}
+}
+
+func TestLoad_SecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	pwFile := filepath.Join(dir, "rcon")
+	if err := os.WriteFile(pwFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_NED_TOKEN", "env-token")
+	t.Setenv("TEST_NED_MATCH_RCON", "match-secret")
+
+	content := `
+discord:
+  token: "env:TEST_NED_TOKEN"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  cs2-casual:
+    display_name: "CS2 Casual"
+    script: "cs2/casual/cs2.sh"
+    protocol: "source"
+    rcon_password: "file:` + pwFile + `"
+    category: "cs2"
+    event:
+      ip: "10.10.10.131"
+      port: 27015
+      rcon_port: 27015
+cs2_matches:
+  script: "cs2/cs2.sh"
+  rcon_password: "env:TEST_NED_MATCH_RCON"
+  rcon_port: 27015
+  protocol: "source"
+`
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Discord.Token != "env-token" {
+		t.Errorf("token = %q, want %q", cfg.Discord.Token, "env-token")
+	}
+	if cfg.Servers["cs2-casual"].RCONPassword != "from-file" {
+		t.Errorf("cs2-casual rcon_password = %q, want %q", cfg.Servers["cs2-casual"].RCONPassword, "from-file")
+	}
+	if cfg.CS2Matches.RCONPassword != "match-secret" {
+		t.Errorf("cs2_matches rcon_password = %q, want %q", cfg.CS2Matches.RCONPassword, "match-secret")
+	}
+}
+
+func TestLoad_MissingSecretEnv(t *testing.T) {
+	content := `
+discord:
+  token: "env:TEST_NED_UNSET_TOKEN"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers: {}
+cs2_matches:
+  script: "cs2/cs2.sh"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for unset secret environment variable")
+	}
+}
+
+func TestLoad_ShortSecret(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rcon"), []byte("abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content := fmt.Sprintf(`
+discord:
+  token: "token"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  tf2:
+    script: "tf2/tf2.sh"
+    protocol: "none"
+    category: "game"
+    rcon_password: "file:%s"
+cs2_matches:
+  script: "cs2/cs2.sh"
+`, filepath.Join(dir, "rcon"))
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Redact cannot hide a secret this short, so it is refused outright.
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "servers.tf2.rcon_password: must be at least 4 characters") {
+		t.Errorf("err = %v, want a short secret error", err)
+	}
+}
+
+func TestRotatedRCONPassword(t *testing.T) {
+	dir := t.TempDir()
+	pwFile := filepath.Join(dir, "cs2_rcon")
+	if err := os.WriteFile(pwFile, []byte("old-password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content := `
+discord:
+  token: "token"
+  guild_id: "123456"
+scripts_dir: "/scripts"
+environment: "event"
+servers:
+  cs2-casual:
+    display_name: "CS2 Casual"
+    script: "cs2/casual/cs2.sh"
+    protocol: "source"
+    rcon_password: "file:` + pwFile + `"
+    category: "cs2"
+    event:
+      ip: "10.10.10.131"
+      port: 27015
+      rcon_port: 27015
+cs2_matches:
+  script: "cs2/cs2.sh"
+  rcon_password: "match-password"
+  rcon_port: 27015
+  protocol: "source"
+  pro:
+    max_instances: 1
+    ip_base: "10.10.10.140"
+`
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.SetRCONPassword("cs2-casual", "new-password")
+	if got := cfg.AllCS2RCONTargets()["cs2-casual"].Password; got != "new-password" {
+		t.Errorf("AllCS2RCONTargets password = %q, want %q", got, "new-password")
+	}
+	if got := cfg.RCONCapableServers()["cs2-casual"].RCONPassword; got != "new-password" {
+		t.Errorf("RCONCapableServers password = %q, want %q", got, "new-password")
+	}
+
+	if err := cfg.PersistRCONPassword("cs2-casual", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(pwFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new-password\n" {
+		t.Errorf("persisted password = %q, want %q", data, "new-password\n")
+	}
+
+	// Literal passwords cannot be written back.
+	if err := cfg.PersistRCONPassword("match-pro-1", "x"); err == nil {
+		t.Error("expected error persisting a plaintext password")
+	}
+}
+
+func TestCheck_ReportsEveryProblem(t *testing.T) {
+	content := `discord:
+  token: "token"
+  guild_id: "123"
+scripts_dir: "/nonexistent/scripts"
+environment: "event"
+servers:
+  tf2:
+    display_name: "TF2"
+    script: "tf2/tf2.sh"
+    protocol: "source"
+    category: "games"
+    rcon_password: ""
+    event:
+      ip: "10.10.10.300"
+      port: 27015
+      query_port: 27015
+      rcon_port: 27015
+  tf2-mvm:
+    display_name: "TF2 MvM"
+    script: "tf2/mvm.sh"
+    protocol: "source"
+    category: "game"
+    event:
+      ip: "10.10.10.122"
+      port: 27015
+      query_port: 27015
+  cs2:
+    display_name: "CS2"
+    script: "cs2/cs2.sh"
+    protocol: "source"
+    category: "cs2"
+    event:
+      ip: "10.10.10.122"
+      port: 27015
+      query_port: 27015
+cs2_matches:
+  script: "cs2/match.sh"
+  rcon_password: "match-pw"
+  rcon_port: 27015
+  query_port: 27015
+  pro:
+    max_instances: 20
+    ip_base: "10.10.10.240"
+welcome:
+  sections:
+    - title: "TF2"
+      servers:
+        - key: "tf2"
+        - key: "tf2-casual"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Check(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		field   string
+		line    int
+		warning bool
+	}
+	wants := []want{
+		{"scripts_dir", 4, true},
+		{"servers.tf2-mvm.event", 23, false}, // same ip:port as cs2
+		{"servers.tf2.category", 11, false},
+		{"servers.tf2.rcon_password", 12, true},
+		{"servers.tf2.event.ip", 14, false},
+		{"cs2_matches.pro.ip_base", 43, false},
+		{"welcome.sections[0].servers[1].key", 49, false},
+	}
+	if len(problems) != len(wants) {
+		t.Errorf("got %d problems, want %d:", len(problems), len(wants))
+		for _, p := range problems {
+			t.Log(p)
+		}
+	}
+	for _, w := range wants {
+		found := false
+		for _, p := range problems {
+			if p.Field == w.field {
+				found = true
+				if p.Line != w.line || p.Warning != w.warning {
+					t.Errorf("%s: line %d warning %v, want line %d warning %v", w.field, p.Line, p.Warning, w.line, w.warning)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no problem reported for %s", w.field)
+		}
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("Load: expected an error")
+	}
+}
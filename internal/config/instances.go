@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// InstanceIP returns the IP address of match instance n (1-based). An entry
+// in IPs wins; otherwise n is allocated from IPRange, counting from the first
+// host address, or is IPBase + n. It returns "" when n has no valid address,
+// which Validate reports for every configured instance.
+func (t *MatchTierConfig) InstanceIP(n int) string {
+	addr, _, err := t.instanceAddr(n)
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// instanceAddr allocates instance n's address. On error, field names the
+// setting (relative to the tier) that could not supply it.
+func (t *MatchTierConfig) instanceAddr(n int) (addr netip.Addr, field string, err error) {
+	if n < 1 {
+		return netip.Addr{}, "", fmt.Errorf("%d is not a match instance number", n)
+	}
+	if n <= len(t.IPs) && t.IPs[n-1] != "" {
+		field = fmt.Sprintf("ips[%d]", n-1)
+		addr, err := netip.ParseAddr(t.IPs[n-1])
+		if err != nil {
+			return netip.Addr{}, field, fmt.Errorf("%q is not an IP address", t.IPs[n-1])
+		}
+		return addr.Unmap(), field, nil
+	}
+
+	switch {
+	case t.IPRange != "" && t.IPBase != "":
+		return netip.Addr{}, "ip_range", fmt.Errorf("set ip_range or ip_base, not both")
+	case t.IPRange != "":
+		addr, err := rangeAddr(t.IPRange, n)
+		return addr, "ip_range", err
+	case t.IPBase != "":
+		addr, err := baseAddr(t.IPBase, n)
+		return addr, "ip_base", err
+	default:
+		return netip.Addr{}, "ips", fmt.Errorf("match instance %d has no address; set ip_range, ip_base or ips", n)
+	}
+}
+
+// rangeAddr returns the nth host address of a CIDR prefix or an inclusive
+// "first-last" range. The network and IPv4 broadcast addresses are skipped.
+func rangeAddr(r string, n int) (netip.Addr, error) {
+	if first, last, ok := strings.Cut(r, "-"); ok {
+		lo, err1 := netip.ParseAddr(strings.TrimSpace(first))
+		hi, err2 := netip.ParseAddr(strings.TrimSpace(last))
+		if err1 != nil || err2 != nil || lo.Is4() != hi.Is4() || hi.Less(lo) {
+			return netip.Addr{}, fmt.Errorf("%q is not a range of addresses like 10.10.10.141-10.10.10.150", r)
+		}
+		addr := advance(lo, n-1)
+		if !addr.IsValid() || hi.Less(addr) {
+			return netip.Addr{}, fmt.Errorf("match instance %d does not fit in %s", n, r)
+		}
+		return addr, nil
+	}
+
+	prefix, err := netip.ParsePrefix(r)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%q is neither a CIDR prefix nor a first-last range", r)
+	}
+	prefix = prefix.Masked()
+	addr := advance(prefix.Addr(), n)
+	broadcast := addr.Is4() && prefix.Bits() < 31 && !prefix.Contains(addr.Next())
+	if !addr.IsValid() || !prefix.Contains(addr) || broadcast {
+		return netip.Addr{}, fmt.Errorf("match instance %d does not fit in %s", n, r)
+	}
+	return addr, nil
+}
+
+// baseAddr returns base + n. IPv4 addresses may not leave base's /24, so
+// that instances never wrap around onto other hosts.
+func baseAddr(base string, n int) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(base)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%q is not an IP address", base)
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		if room := 254 - int(addr.As4()[3]); n > room {
+			return netip.Addr{}, fmt.Errorf("match instance %d overflows the last octet of %s; at most %d fit", n, base, max(room, 0))
+		}
+	}
+	next := advance(addr, n)
+	if !next.IsValid() {
+		return netip.Addr{}, fmt.Errorf("match instance %d overflows %s", n, base)
+	}
+	return next, nil
+}
+
+// advance returns addr + n, or the zero Addr past the end of the family.
+func advance(addr netip.Addr, n int) netip.Addr {
+	for ; n > 0 && addr.IsValid(); n-- {
+		addr = addr.Next()
+	}
+	return addr
+}
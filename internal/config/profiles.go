@@ -0,0 +1,99 @@
+package config
+
+import (
+	"maps"
+	"path"
+	"slices"
+)
+
+// ProfileNames returns the startup profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(c.Profiles))
+}
+
+// ProfileServers returns the sorted keys of the servers in a startup
+// profile, along with every server they depend on. Entries that only name
+// servers disabled in the active environment are skipped. ok is false for
+// an unknown profile.
+func (c *Config) ProfileServers(name string) (keys []string, ok bool) {
+	entries, ok := c.Profiles[name]
+	if !ok {
+		return nil, false
+	}
+
+	want := map[string]bool{}
+	var add func(key string)
+	add = func(key string) {
+		if _, ok := c.Servers[key]; !ok || want[key] {
+			return
+		}
+		want[key] = true
+		for _, dep := range c.Servers[key].DependsOn {
+			add(dep)
+		}
+	}
+	for _, entry := range entries {
+		for _, key := range c.matchServers(entry) {
+			add(key)
+		}
+	}
+	return slices.Sorted(maps.Keys(want)), true
+}
+
+// matchServers returns the sorted keys of the servers matching a profile
+// entry, a server key or glob.
+func (c *Config) matchServers(pattern string) []string {
+	var keys []string
+	for key := range c.Servers {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Conflicts reports whether servers a and b cannot run together, as
+// declared by conflicts_with on either of them.
+func (c *Config) Conflicts(a, b string) bool {
+	return slices.Contains(c.Servers[a].ConflictsWith, b) || slices.Contains(c.Servers[b].ConflictsWith, a)
+}
+
+// StartOrder groups keys into waves, each of which may only start once the
+// waves before it are running: a server comes after everything it depends
+// on, directly or through servers not in keys. Reversed, the waves are a
+// stop order. Keys within a wave are sorted.
+func (c *Config) StartOrder(keys []string) [][]string {
+	depth := map[string]int{}
+	var depthOf func(key string, visiting map[string]bool) int
+	depthOf = func(key string, visiting map[string]bool) int {
+		if d, ok := depth[key]; ok {
+			return d
+		}
+		if visiting[key] {
+			return 0 // a cycle, which Validate reports
+		}
+		visiting[key] = true
+		d := 0
+		for _, dep := range c.Servers[key].DependsOn {
+			if _, ok := c.Servers[dep]; ok {
+				d = max(d, depthOf(dep, visiting)+1)
+			}
+		}
+		depth[key] = d
+		return d
+	}
+
+	byDepth := map[int][]string{}
+	for _, key := range keys {
+		d := depthOf(key, map[string]bool{})
+		byDepth[d] = append(byDepth[d], key)
+	}
+	var waves [][]string
+	for _, d := range slices.Sorted(maps.Keys(byDepth)) {
+		wave := byDepth[d]
+		slices.Sort(wave)
+		waves = append(waves, wave)
+	}
+	return waves
+}
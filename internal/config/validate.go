@@ -0,0 +1,610 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serverCategories are the categories the status board shows. Servers in
+// any other category would silently be left off it.
+var serverCategories = []string{"game", "cs2", "infra"}
+
+// Problem is one thing wrong with a config.
+type Problem struct {
+	Field string // config path, e.g. "servers.tf2.event.ip"
+	Line  int    // line in the config file; 0 when unknown
+	Msg   string
+	// Warning problems are reported by Check but do not stop Ned from
+	// starting, e.g. scripts missing from a scripts_dir mounted later.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	s := p.Msg
+	if p.Field != "" {
+		s = p.Field + ": " + s
+	}
+	if p.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", p.Line, s)
+	}
+	return s
+}
+
+// ValidationError lists every error found in a config.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].String()
+	}
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return fmt.Sprintf("%d problems: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+func errorsOnly(problems []Problem) []Problem {
+	var errs []Problem
+	for _, p := range problems {
+		if !p.Warning {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// Validate returns a *ValidationError listing every error in the config.
+// Warnings are left to Check.
+func (c *Config) Validate() error {
+	if errs := errorsOnly(c.locate(c.problems())); len(errs) > 0 {
+		return &ValidationError{Problems: errs}
+	}
+	return nil
+}
+
+// validator collects problems.
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) errorf(field, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Field: field, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(field, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Field: field, Msg: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// problems checks the resolved config.
+func (c *Config) problems() []Problem {
+	v := &validator{}
+	if !c.local {
+		if c.Discord.Token == "" {
+			v.errorf("discord.token", "required")
+		}
+		if c.Discord.GuildID == "" {
+			v.errorf("discord.guild_id", "required")
+		}
+	}
+	envs := c.EnvironmentNames()
+	if !slices.Contains(envs, c.Environment) {
+		v.errorf("environment", "must be one of %s, got %q", strings.Join(envs, ", "), c.Environment)
+	}
+	scriptsField := "scripts_dir"
+	if c.Environments[c.Environment].ScriptsDir != "" {
+		scriptsField = "environments." + c.Environment + ".scripts_dir"
+	}
+	scriptsOK := false
+	if c.ResolvedScriptsDir == "" {
+		v.errorf(scriptsField, "required (for environment %q)", c.Environment)
+	} else if fi, err := os.Stat(c.ResolvedScriptsDir); err != nil || !fi.IsDir() {
+		v.warnf(scriptsField, "%s is not a directory on this host", c.ResolvedScriptsDir)
+	} else {
+		scriptsOK = true
+	}
+
+	switch network := c.Environments[c.Environment].Network; network {
+	case "", NetworkMACVLAN, NetworkPorts:
+	default:
+		v.errorf("environments."+c.Environment+".network", "must be %q or %q, got %q", NetworkMACVLAN, NetworkPorts, network)
+	}
+
+	ports := addressBook{}
+	for _, key := range slices.Sorted(maps.Keys(c.Servers)) {
+		c.validateServer(v, key, c.Servers[key], scriptsOK, ports)
+	}
+	c.validateSharedIPs(v)
+	c.validateServerEnvironments(v, envs)
+	c.validateDependencies(v)
+	c.validateProfiles(v)
+	c.validateMatches(v, scriptsOK)
+	c.validateWelcome(v)
+	c.RCONPolicy.validate(v)
+	if !c.local {
+		c.API.validate(v)
+		c.validateDashboard(v)
+	}
+
+	switch strings.ToLower(c.Logging.Format) {
+	case "", "text", "json":
+	default:
+		v.errorf("logging.format", "must be \"text\" or \"json\", got %q", c.Logging.Format)
+	}
+	switch strings.ToLower(c.Logging.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		v.errorf("logging.level", "must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	return v.problems
+}
+
+// addressBook maps "ip:port" to the server that claimed it first.
+type addressBook map[string]string
+
+// claim records the ports of server, reporting any already claimed by
+// another at field. A server may reuse its own port, e.g. for RCON and
+// queries.
+func (b addressBook) claim(v *validator, field, server, ip string, ports ...int) {
+	mine := map[string]bool{}
+	for _, port := range ports {
+		if ip == "" || port <= 0 {
+			continue
+		}
+		addr := net.JoinHostPort(ip, strconv.Itoa(port))
+		if mine[addr] {
+			continue
+		}
+		mine[addr] = true
+		if other, ok := b[addr]; ok {
+			v.errorf(field, "%s is also used by %s", addr, other)
+			continue
+		}
+		b[addr] = server
+	}
+}
+
+func (c *Config) validateServer(v *validator, key string, srv Server, scriptsOK bool, ports addressBook) {
+	field := "servers." + key
+	switch srv.Executor {
+	case "", ExecutorShell:
+		if srv.Script == "" {
+			v.errorf(field+".script", "required")
+		} else if scriptsOK {
+			c.checkScript(v, field+".script", srv.Script)
+		}
+	case ExecutorDocker:
+	default:
+		v.errorf(field+".executor", "must be %q or %q, got %q", ExecutorShell, ExecutorDocker, srv.Executor)
+	}
+	if srv.Protocol != "source" && srv.Protocol != "none" {
+		v.errorf(field+".protocol", "must be \"source\" or \"none\", got %q", srv.Protocol)
+	}
+	if !slices.Contains(serverCategories, srv.Category) {
+		v.errorf(field+".category", "must be one of %s, got %q; other servers are left off the status board",
+			strings.Join(serverCategories, ", "), srv.Category)
+	}
+
+	env := field + "." + c.Environment
+	switch {
+	case srv.IP != "":
+		if !validHost(srv.IP) {
+			v.errorf(env+".ip", "%q is not an IP address or host name", srv.IP)
+		}
+	case srv.Protocol == "source" || srv.Port > 0 || srv.RCONPort > 0:
+		v.errorf(env+".ip", "required when the server has ports or is queried")
+	}
+	validPort(v, env+".port", srv.Port)
+	validPort(v, env+".query_port", srv.QueryPort)
+	validPort(v, env+".rcon_port", srv.RCONPort)
+	if srv.RCONPort > 0 && srv.RCONPassword == "" {
+		v.warnf(field+".rcon_password", "empty, so RCON on port %d is disabled", srv.RCONPort)
+	}
+	switch {
+	case srv.ShutdownGrace < 0:
+		v.errorf(field+".shutdown_grace", "must not be negative")
+	case srv.ShutdownGrace > 0 && (srv.Protocol != "source" || srv.QueryPort <= 0):
+		v.warnf(field+".shutdown_grace", "ignored, since players cannot be counted without a query_port")
+	}
+	ports.claim(v, env, key, srv.IP, srv.Port, srv.QueryPort, srv.RCONPort)
+}
+
+// validateSharedIPs warns about servers that share an IP under MAC VLAN,
+// where starting one breaks the other, unless they already declare the
+// conflict with conflicts_with. Ports shared outright are errors reported
+// by addressBook.
+func (c *Config) validateSharedIPs(v *validator) {
+	if c.Network() != NetworkMACVLAN {
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.Servers)) {
+		for _, peer := range c.AddressPeers(key) {
+			if peer > key && !c.Conflicts(key, peer) && !sharesPort(c.Servers[key], c.Servers[peer]) {
+				v.warnf("servers."+peer+"."+c.Environment+".ip", "%s is also used by %s, so only one of them can run at a time; add conflicts_with to say so",
+					c.Servers[key].IP, key)
+			}
+		}
+	}
+}
+
+// validateServerEnvironments reports per-environment server blocks for
+// environments the config does not declare, which are otherwise ignored.
+// Disabled servers are checked too, from the raw document.
+func (c *Config) validateServerEnvironments(v *validator, envs []string) {
+	if c.doc == nil || len(c.doc.Content) == 0 {
+		return
+	}
+	servers := mappingValue(c.doc.Content[0], "servers")
+	if servers == nil || servers.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(servers.Content); i += 2 {
+		key, srv := servers.Content[i].Value, servers.Content[i+1]
+		if srv.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(srv.Content); j += 2 {
+			name := srv.Content[j].Value
+			if srv.Content[j+1].Kind == yaml.MappingNode && !slices.Contains(envs, name) {
+				v.errorf("servers."+key+"."+name, "unknown environment %q; declared: %s", name, strings.Join(envs, ", "))
+			}
+		}
+	}
+}
+
+// validateDependencies checks depends_on and conflicts_with. A dependency
+// disabled in the active environment is only a warning, since the same
+// file serves every environment.
+func (c *Config) validateDependencies(v *validator) {
+	for _, key := range slices.Sorted(maps.Keys(c.Servers)) {
+		srv := c.Servers[key]
+		field := "servers." + key
+		for _, dep := range srv.DependsOn {
+			switch {
+			case dep == key:
+				v.errorf(field+".depends_on", "a server cannot depend on itself")
+			case c.disabled[dep]:
+				v.warnf(field+".depends_on", "%s is disabled in environment %q, so it is not started first", dep, c.Environment)
+			case !c.hasServer(dep):
+				v.errorf(field+".depends_on", "unknown server %q", dep)
+			case c.Conflicts(key, dep):
+				v.errorf(field+".depends_on", "%s also conflicts with %s", dep, key)
+			}
+		}
+		for _, other := range srv.ConflictsWith {
+			switch {
+			case other == key:
+				v.errorf(field+".conflicts_with", "a server cannot conflict with itself")
+			case !c.hasServer(other) && !c.disabled[other]:
+				v.errorf(field+".conflicts_with", "unknown server %q", other)
+			}
+		}
+	}
+
+	// Walk the dependency graph, reporting each cycle once.
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var walk func(key string, trail []string)
+	walk = func(key string, trail []string) {
+		switch state[key] {
+		case visiting:
+			cycle := append(slices.Clone(trail[slices.Index(trail, key):]), key)
+			v.errorf("servers."+key+".depends_on", "dependency cycle: %s", strings.Join(cycle, " → "))
+			return
+		case done:
+			return
+		}
+		state[key] = visiting
+		for _, dep := range c.Servers[key].DependsOn {
+			if dep != key && c.hasServer(dep) {
+				walk(dep, append(trail, key))
+			}
+		}
+		state[key] = done
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.Servers)) {
+		walk(key, nil)
+	}
+}
+
+// validateProfiles checks that every profile entry names a server and that
+// no profile needs two conflicting servers at once.
+func (c *Config) validateProfiles(v *validator) {
+	for _, name := range c.ProfileNames() {
+		field := "profiles." + name
+		for i, entry := range c.Profiles[name] {
+			if _, err := path.Match(entry, ""); err != nil {
+				v.errorf(fmt.Sprintf("%s[%d]", field, i), "invalid glob %q: %v", entry, err)
+				continue
+			}
+			if len(c.matchServers(entry)) > 0 {
+				continue
+			}
+			disabled := false
+			for key := range c.disabled {
+				if ok, _ := path.Match(entry, key); ok {
+					disabled = true
+				}
+			}
+			if !disabled {
+				v.errorf(fmt.Sprintf("%s[%d]", field, i), "%q matches no server", entry)
+			}
+		}
+
+		keys, _ := c.ProfileServers(name)
+		for i, a := range keys {
+			for _, b := range keys[i+1:] {
+				if c.Conflicts(a, b) {
+					v.errorf(field, "runs %s and %s, which conflict", a, b)
+				}
+			}
+		}
+	}
+}
+
+func (c *Config) hasServer(key string) bool {
+	_, ok := c.Servers[key]
+	return ok
+}
+
+func (c *Config) validateMatches(v *validator, scriptsOK bool) {
+	m := c.CS2Matches
+	if m.Script == "" {
+		v.errorf("cs2_matches.script", "required")
+	} else if scriptsOK {
+		c.checkScript(v, "cs2_matches.script", m.Script)
+	}
+	validPort(v, "cs2_matches.rcon_port", m.RCONPort)
+	validPort(v, "cs2_matches.query_port", m.QueryPort)
+	if m.RCONPort > 0 && m.RCONPassword == "" {
+		v.warnf("cs2_matches.rcon_password", "empty, so RCON to match instances is disabled")
+	}
+
+	c.validateInstanceIPs(v)
+}
+
+// validateInstanceIPs allocates every match instance's address and reports
+// allocation errors and addresses that collide with a server or another
+// instance. Server host names are not resolved.
+func (c *Config) validateInstanceIPs(v *validator) {
+	pro := &c.CS2Matches.Pro
+	if pro.MaxInstances < 0 {
+		v.errorf("cs2_matches.pro.max_instances", "must not be negative")
+		return
+	}
+
+	owners := map[netip.Addr]string{}
+	for _, key := range slices.Sorted(maps.Keys(c.Servers)) {
+		if addr, err := netip.ParseAddr(c.Servers[key].IP); err == nil {
+			if _, taken := owners[addr.Unmap()]; !taken {
+				owners[addr.Unmap()] = "servers." + key
+			}
+		}
+	}
+
+	failed := map[string]bool{}
+	for n := 1; n <= pro.MaxInstances; n++ {
+		addr, field, err := pro.instanceAddr(n)
+		field = "cs2_matches.pro." + field
+		if err != nil {
+			if !failed[field] {
+				v.errorf(field, "%v", err)
+			}
+			failed[field] = true
+			continue
+		}
+		instance := fmt.Sprintf("match-pro-%d", n)
+		if owner, taken := owners[addr]; taken {
+			v.errorf(field, "%s would get %s, which %s already uses", instance, addr, owner)
+			continue
+		}
+		owners[addr] = instance
+	}
+}
+
+func (c *Config) validateWelcome(v *validator) {
+	for i, section := range c.Welcome.Sections {
+		for j, entry := range section.Servers {
+			field := fmt.Sprintf("welcome.sections[%d].servers[%d]", i, j)
+			switch {
+			case entry.Key != "":
+				if _, ok := c.Servers[entry.Key]; !ok && !c.disabled[entry.Key] {
+					v.errorf(field+".key", "unknown server %q", entry.Key)
+				}
+			case entry.IP == "":
+				v.errorf(field, "key or ip is required")
+			}
+		}
+	}
+}
+
+// checkScript reports a script missing from the scripts directory.
+func (c *Config) checkScript(v *validator, field, script string) {
+	full := filepath.Join(c.ResolvedScriptsDir, script)
+	if fi, err := os.Stat(full); err != nil || fi.IsDir() {
+		v.warnf(field, "%s does not exist", full)
+	}
+}
+
+func validPort(v *validator, field string, port int) {
+	if port < 0 || port > 65535 {
+		v.errorf(field, "%d is not a valid port", port)
+	}
+}
+
+var (
+	hostLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	allDigits = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// validHost reports whether s is an IP address or a DNS host name.
+func validHost(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	labels := strings.Split(s, ".")
+	if len(s) > 253 || allDigits.MatchString(labels[len(labels)-1]) {
+		return false // e.g. a mistyped IP like 10.10.10.300
+	}
+	for _, label := range labels {
+		if !hostLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *RCONPolicyConfig) validate(v *validator) {
+	check := func(where string, rule RCONRule) {
+		for _, pattern := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				v.errorf("rcon_policy."+where, "invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	for _, role := range slices.Sorted(maps.Keys(p.Default)) {
+		check("default."+role, p.Default[role])
+	}
+	for _, glob := range slices.Sorted(maps.Keys(p.Servers)) {
+		if _, err := path.Match(glob, ""); err != nil {
+			v.errorf("rcon_policy.servers", "invalid glob %q: %v", glob, err)
+		}
+		roles := p.Servers[glob]
+		for _, role := range slices.Sorted(maps.Keys(roles)) {
+			check("servers."+glob+"."+role, roles[role])
+		}
+	}
+}
+
+func (a *APIConfig) validate(v *validator) {
+	if a.Listen != "" && len(a.Tokens) == 0 {
+		v.errorf("api.tokens", "at least one token is required when api.listen is set")
+	}
+	seen := make(map[string]bool)
+	for i, t := range a.Tokens {
+		field := fmt.Sprintf("api.tokens[%d]", i)
+		if t.Name == "" {
+			v.errorf(field+".name", "required")
+		} else if seen[t.Name] {
+			v.errorf(field+".name", "duplicate name %q", t.Name)
+		}
+		seen[t.Name] = true
+		if len(t.Token) < 16 {
+			v.errorf(field+".token", "must be at least 16 characters")
+		}
+	}
+}
+
+func (c *Config) validateDashboard(v *validator) {
+	d := c.Dashboard
+	if d.Listen == "" {
+		return
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.errorf("dashboard.url", "must be an absolute http(s) URL, got %q", d.URL)
+	}
+	if d.ClientID == "" {
+		v.errorf("dashboard.client_id", "required when dashboard.listen is set")
+	}
+	if d.ClientSecret == "" {
+		v.errorf("dashboard.client_secret", "required when dashboard.listen is set")
+	}
+	if len(c.Roles) == 0 {
+		v.errorf("roles", "must be configured for the dashboard, since only members holding a Ned role can sign in")
+	}
+	for _, role := range d.Roles {
+		if _, ok := c.Roles[role]; !ok {
+			v.errorf("dashboard.roles", "unknown role %q", role)
+		}
+	}
+}
+
+// locate fills in the line of each problem from the parsed file and sorts
+// them by line. Problems whose field is not in the file point at the
+// nearest enclosing key.
+func (c *Config) locate(problems []Problem) []Problem {
+	if c.doc != nil {
+		for i := range problems {
+			problems[i].Line = lineOf(c.doc, problems[i].Field)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		li, lj := problems[i].Line, problems[j].Line
+		return li != 0 && (lj == 0 || li < lj)
+	})
+	return problems
+}
+
+// fieldIndex matches a sequence index suffix, e.g. "sections[2]".
+var fieldIndex = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// lineOf returns the line of the deepest node along field, a dotted path
+// with optional [n] sequence indexes.
+func lineOf(doc *yaml.Node, field string) int {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := 0
+	for _, part := range strings.Split(field, ".") {
+		var indexes []int
+		for {
+			m := fieldIndex.FindStringSubmatch(part)
+			if m == nil {
+				break
+			}
+			n, _ := strconv.Atoi(m[2])
+			indexes = append([]int{n}, indexes...)
+			part = m[1]
+		}
+
+		next := mappingValue(node, part)
+		if next == nil {
+			return line
+		}
+		node, line = next, next.Line
+		for _, n := range indexes {
+			if node.Kind != yaml.SequenceNode || n >= len(node.Content) {
+				return line
+			}
+			node = node.Content[n]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+// mappingValue returns the value of key in a mapping node, or nil. The
+// value's line is moved to the key's when the value is a nested block.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			value := *node.Content[i+1]
+			value.Line = node.Content[i].Line
+			return &value
+		}
+	}
+	return nil
+}
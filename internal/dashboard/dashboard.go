@@ -0,0 +1,240 @@
+// Package dashboard serves the staff web dashboard: an embedded single-page
+// app that drives the HTTP API, signed in with Discord OAuth2 so guild roles
+// map to Ned roles exactly as they do for slash commands.
+package dashboard
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/api"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+//go:embed static
+var static embed.FS
+
+const (
+	sessionCookie = "ned_session"
+	stateCookie   = "ned_oauth_state"
+
+	// csrfHeader must carry the session's CSRF token on every request that
+	// is not a GET, since the session cookie alone authenticates.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// Server is the dashboard.
+type Server struct {
+	cfg     *config.Config
+	discord *discordClient
+	api     http.Handler
+	secure  bool // set the Secure flag on cookies
+	dryRun  bool // nothing is actually run; shown to signed-in staff
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is a signed-in staff member. Roles are captured at sign-in, so role
+// changes in Discord take effect on the next sign-in.
+type session struct {
+	caller  service.Caller
+	csrf    string
+	expires time.Time
+}
+
+// New creates the dashboard for svc.
+func New(svc *service.Service) *Server {
+	cfg := svc.Config()
+	s := &Server{
+		cfg:      cfg,
+		discord:  newDiscordClient(cfg),
+		secure:   strings.HasPrefix(cfg.Dashboard.URL, "https://"),
+		dryRun:   svc.DryRun(),
+		sessions: make(map[string]*session),
+	}
+	s.api = api.New(svc, s.authenticate).Handler()
+	return s
+}
+
+// Handler returns the dashboard's HTTP handler.
+func (s *Server) Handler() http.Handler {
+	assets, _ := fs.Sub(static, "static")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/login", s.login)
+	mux.HandleFunc("GET /auth/callback", s.callback)
+	mux.HandleFunc("GET /auth/me", s.me)
+	mux.HandleFunc("POST /auth/logout", s.logout)
+	mux.Handle("/api/", s.api)
+	mux.Handle("/", http.FileServerFS(assets))
+	return mux
+}
+
+// authenticate resolves the session cookie to its caller. It is the API's
+// Authenticator, so every API endpoint is available to signed-in staff.
+func (s *Server) authenticate(r *http.Request) (service.Caller, bool) {
+	sess := s.session(r)
+	if sess == nil {
+		return service.Caller{}, false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(sess.csrf)) != 1 {
+			return service.Caller{}, false
+		}
+	}
+	return sess.caller, true
+}
+
+// session returns the live session for the request's cookie, or nil.
+func (s *Server) session(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[cookie.Value]
+	if sess == nil || time.Now().After(sess.expires) {
+		delete(s.sessions, cookie.Value)
+		return nil
+	}
+	return sess
+}
+
+// login starts the OAuth2 authorization code flow.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	state := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name: stateCookie, Value: state, Path: "/auth",
+		MaxAge: 600, HttpOnly: true, Secure: s.secure, SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, s.discord.authorizeURL(state), http.StatusFound)
+}
+
+// callback completes the OAuth2 flow and signs the member in if they hold an
+// allowed Ned role.
+func (s *Server) callback(w http.ResponseWriter, r *http.Request) {
+	state, err := r.Cookie(stateCookie)
+	if err != nil || state.Value == "" || subtle.ConstantTimeCompare([]byte(state.Value), []byte(r.URL.Query().Get("state"))) != 1 {
+		http.Error(w, "Sign-in expired or was tampered with. Please try again.", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth", MaxAge: -1})
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Discord did not authorize the sign-in.", http.StatusForbidden)
+		return
+	}
+
+	member, err := s.discord.member(r.Context(), code)
+	if errors.Is(err, errNotMember) {
+		http.Error(w, "You are not a member of the event's Discord server.", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.Warn("dashboard sign-in failed", "err", err)
+		http.Error(w, "Could not verify your Discord membership. Please try again.", http.StatusBadGateway)
+		return
+	}
+
+	roles := s.cfg.RolesFor(member.Roles)
+	if !s.allowed(roles) {
+		slog.Warn("dashboard sign-in denied", "user", member.User.Username, "user_id", member.User.ID, "roles", roles)
+		http.Error(w, "You do not hold a Ned role that may use the dashboard.", http.StatusForbidden)
+		return
+	}
+
+	id := randomToken()
+	sess := &session{
+		caller:  service.Caller{Name: member.User.Username, ID: member.User.ID, Roles: roles},
+		csrf:    randomToken(),
+		expires: time.Now().Add(s.cfg.Dashboard.SessionTTL),
+	}
+	s.mu.Lock()
+	s.pruneLocked()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+
+	slog.Info("dashboard sign-in", "user", member.User.Username, "user_id", member.User.ID, "roles", roles)
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: id, Path: "/", Expires: sess.expires,
+		HttpOnly: true, Secure: s.secure, SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// allowed reports whether a member holding roles may sign in: any Ned role
+// will do unless dashboard.roles narrows it down.
+func (s *Server) allowed(roles []string) bool {
+	if len(s.cfg.Dashboard.Roles) == 0 {
+		return len(roles) > 0
+	}
+	for _, role := range roles {
+		if slices.Contains(s.cfg.Dashboard.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneLocked drops expired sessions. s.mu must be held.
+func (s *Server) pruneLocked() {
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// me returns the signed-in user, the CSRF token the app must send back, and
+// whether Ned is only rehearsing actions.
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if sess == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "not signed in"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"name":    sess.caller.Name,
+		"roles":   sess.caller.Roles,
+		"csrf":    sess.csrf,
+		"dry_run": s.dryRun,
+	})
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticate(r); !ok {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	cookie, _ := r.Cookie(sessionCookie)
+	s.mu.Lock()
+	delete(s.sessions, cookie.Value)
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func randomToken() string {
+	var b [24]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
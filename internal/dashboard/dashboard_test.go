@@ -0,0 +1,231 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/service"
+)
+
+type fakeExecutor struct {
+	ran chan string
+}
+
+func (f *fakeExecutor) Run(_ context.Context, scriptPath, command string, _ map[string]string) (*executor.Result, error) {
+	f.ran <- scriptPath + " " + command
+	return &executor.Result{Stdout: "ok"}, nil
+}
+
+type fakeQuerier struct{}
+
+func (fakeQuerier) QueryStatus(context.Context, string) (*query.ServerStatus, error) {
+	return &query.ServerStatus{Online: true, Map: "ctf_2fort", Players: 1, MaxPlayers: 24}, nil
+}
+
+func (fakeQuerier) QueryPlayers(context.Context, string) ([]query.PlayerInfo, error) {
+	return []query.PlayerInfo{{Name: "alice"}}, nil
+}
+
+type auditLog struct{ entries chan audit.Entry }
+
+func (a auditLog) Record(e audit.Entry) { a.entries <- e }
+
+// fakeDiscord serves the OAuth2 token exchange and guild member lookup. Each
+// code maps to a member's role IDs; codes starting with "stranger" belong to
+// users outside the guild.
+func fakeDiscord(t *testing.T) *httptest.Server {
+	t.Helper()
+	roles := map[string][]string{
+		"admin-code": {"111"},
+		"guest-code": {"999"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_secret") != "s3cret" || r.Form.Get("redirect_uri") != "https://ned.example.com/auth/callback" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token-" + r.Form.Get("code")})
+	})
+	mux.HandleFunc("GET /users/@me/guilds/123/member", func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer token-")
+		ids, ok := roles[code]
+		if !ok {
+			http.Error(w, `{"message":"Unknown Guild"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"user":  map[string]string{"id": "42", "username": strings.TrimSuffix(code, "-code")},
+			"roles": ids,
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestDashboard(t *testing.T) (http.Handler, *fakeExecutor, auditLog) {
+	t.Helper()
+	cfg := &config.Config{
+		Discord: config.DiscordConfig{GuildID: "123"},
+		Servers: map[string]config.Server{
+			"tf2": {DisplayName: "TF2", Script: "tf2/tf2.sh", Protocol: "source", Category: "game", IP: "10.0.0.1", Port: 27015, QueryPort: 27015},
+		},
+		Roles: map[string][]string{"admin": {"111"}},
+		Dashboard: config.DashboardConfig{
+			Listen: ":0", URL: "https://ned.example.com/", ClientID: "app", ClientSecret: "s3cret", SessionTTL: time.Hour,
+		},
+	}
+	exec := &fakeExecutor{ran: make(chan string, 4)}
+	log := auditLog{entries: make(chan audit.Entry, 4)}
+	svc := service.New(cfg, service.Deps{Executor: exec, Querier: fakeQuerier{}, Audit: log})
+
+	d := New(svc)
+	d.discord.apiBase = fakeDiscord(t).URL
+	return d.Handler(), exec, log
+}
+
+// signIn completes the OAuth2 callback for code and returns the cookies set.
+func signIn(t *testing.T, h http.Handler, code string) (*httptest.ResponseRecorder, []*http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/auth/callback?state=abc&code="+code, nil)
+	req.AddCookie(&http.Cookie{Name: stateCookie, Value: "abc"})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr, rr.Result().Cookies()
+}
+
+func do(h http.Handler, method, path string, cookies []*http.Cookie, csrf string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	if csrf != "" {
+		req.Header.Set(csrfHeader, csrf)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLogin_RedirectsToDiscord(t *testing.T) {
+	h, _, _ := newTestDashboard(t)
+	rr := do(h, "GET", "/auth/login", nil, "")
+	if rr.Code != http.StatusFound {
+		t.Fatalf("status = %d", rr.Code)
+	}
+	loc, _ := url.Parse(rr.Header().Get("Location"))
+	q := loc.Query()
+	if q.Get("client_id") != "app" || q.Get("redirect_uri") != "https://ned.example.com/auth/callback" || q.Get("scope") != oauthScopes {
+		t.Errorf("authorize URL = %s", loc)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookie || cookies[0].Value != q.Get("state") || !cookies[0].Secure {
+		t.Errorf("state cookie = %+v, state = %q", cookies, q.Get("state"))
+	}
+}
+
+func TestCallback_SignsInAndAppliesRoles(t *testing.T) {
+	h, exec, log := newTestDashboard(t)
+
+	rr, cookies := signIn(t, h, "admin-code")
+	if rr.Code != http.StatusFound {
+		t.Fatalf("callback status = %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = do(h, "GET", "/auth/me", cookies, "")
+	var me struct {
+		Name   string   `json:"name"`
+		Roles  []string `json:"roles"`
+		CSRF   string   `json:"csrf"`
+		DryRun bool     `json:"dry_run"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &me); err != nil {
+		t.Fatalf("me: %v (%s)", err, rr.Body)
+	}
+	if me.Name != "admin" || len(me.Roles) != 1 || me.Roles[0] != "admin" || me.CSRF == "" || me.DryRun {
+		t.Fatalf("me = %+v", me)
+	}
+
+	if rr := do(h, "GET", "/api/v1/servers", cookies, ""); rr.Code != http.StatusOK {
+		t.Errorf("board status = %d", rr.Code)
+	}
+	if rr := do(h, "POST", "/api/v1/servers/tf2/start", cookies, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("start without CSRF token: status = %d, want 401", rr.Code)
+	}
+	if rr := do(h, "POST", "/api/v1/servers/tf2/start", cookies, me.CSRF); rr.Code != http.StatusAccepted {
+		t.Fatalf("start: status = %d: %s", rr.Code, rr.Body)
+	}
+	if got := <-exec.ran; got != "tf2/tf2.sh up" {
+		t.Errorf("ran %q", got)
+	}
+	select {
+	case e := <-log.entries:
+		if e.User != "admin" || e.UserID != "42" || e.Action != "up" {
+			t.Errorf("audit entry = %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lifecycle action was not audited")
+	}
+
+	if rr := do(h, "POST", "/auth/logout", cookies, me.CSRF); rr.Code != http.StatusNoContent {
+		t.Fatalf("logout status = %d", rr.Code)
+	}
+	if rr := do(h, "GET", "/api/v1/servers", cookies, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("after logout: status = %d, want 401", rr.Code)
+	}
+}
+
+func TestCallback_Rejections(t *testing.T) {
+	h, _, _ := newTestDashboard(t)
+
+	tests := []struct {
+		name, code string
+		want       int
+	}{
+		{"no Ned role", "guest-code", http.StatusForbidden},
+		{"not in guild", "stranger-code", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rr, cookies := signIn(t, h, tt.code)
+		if rr.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.want)
+		}
+		for _, c := range cookies {
+			if c.Name == sessionCookie && c.Value != "" {
+				t.Errorf("%s: session cookie was set", tt.name)
+			}
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/auth/callback?state=forged&code=admin-code", nil)
+	req.AddCookie(&http.Cookie{Name: stateCookie, Value: "abc"})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("state mismatch: status = %d, want 400", rr.Code)
+	}
+}
+
+func TestStaticAssets(t *testing.T) {
+	h, _, _ := newTestDashboard(t)
+	for _, path := range []string{"/", "/app.js", "/style.css"} {
+		if rr := do(h, "GET", path, nil, ""); rr.Code != http.StatusOK {
+			t.Errorf("%s: status = %d", path, rr.Code)
+		}
+	}
+	if rr := do(h, "GET", "/api/v1/servers", nil, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("API without a session: status = %d, want 401", rr.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+)
+
+// Discord endpoints. Tests point these at a fake server.
+const (
+	discordAuthorizeURL = "https://discord.com/oauth2/authorize"
+	discordAPIURL       = "https://discord.com/api/v10"
+)
+
+// oauthScopes lets Ned read the member's roles in the configured guild.
+const oauthScopes = "identify guilds.members.read"
+
+// discordClient performs the OAuth2 code exchange and member lookup.
+type discordClient struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	guildID      string
+
+	authorizeBase string
+	apiBase       string
+	http          *http.Client
+}
+
+func newDiscordClient(cfg *config.Config) *discordClient {
+	return &discordClient{
+		clientID:      cfg.Dashboard.ClientID,
+		clientSecret:  cfg.Dashboard.ClientSecret,
+		redirectURL:   strings.TrimSuffix(cfg.Dashboard.URL, "/") + "/auth/callback",
+		guildID:       cfg.Discord.GuildID,
+		authorizeBase: discordAuthorizeURL,
+		apiBase:       discordAPIURL,
+		http:          &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// guildMember is the subset of Discord's guild member object Ned uses.
+type guildMember struct {
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Roles []string `json:"roles"`
+}
+
+func (d *discordClient) authorizeURL(state string) string {
+	q := url.Values{
+		"client_id":     {d.clientID},
+		"redirect_uri":  {d.redirectURL},
+		"response_type": {"code"},
+		"scope":         {oauthScopes},
+		"state":         {state},
+	}
+	return d.authorizeBase + "?" + q.Encode()
+}
+
+// member exchanges an authorization code for the user's membership in the
+// configured guild.
+func (d *discordClient) member(ctx context.Context, code string) (*guildMember, error) {
+	form := url.Values{
+		"client_id":     {d.clientID},
+		"client_secret": {d.clientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {d.redirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.apiBase+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := d.do(req, &token); err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, d.apiBase+"/users/@me/guilds/"+d.guildID+"/member", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var member guildMember
+	if err := d.do(req, &member); err != nil {
+		var se *statusError
+		if errors.As(err, &se) && se.status == http.StatusNotFound {
+			return nil, errNotMember
+		}
+		return nil, fmt.Errorf("fetching guild member: %w", err)
+	}
+	return &member, nil
+}
+
+// errNotMember is returned when the user is not in the configured guild.
+var errNotMember = errors.New("not a member of the guild")
+
+// statusError is a non-200 response from Discord.
+type statusError struct {
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("discord returned %d: %s", e.status, e.body)
+}
+
+func (d *discordClient) do(req *http.Request, v any) error {
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
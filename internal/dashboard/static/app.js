@@ -0,0 +1,274 @@
+"use strict";
+
+// Board categories in the order /ned status shows them.
+const CATEGORIES = [
+  ["game", "Game Servers"],
+  ["cs2", "CS2"],
+  ["match", "CS2 Matches"],
+  ["infra", "Infrastructure"],
+];
+
+const REFRESH_MS = 10000;
+
+const VERBS = { start: "Starting", stop: "Stopping", restart: "Restarting" };
+
+let csrf = "";
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, props = {}, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, props);
+  node.append(...children);
+  return node;
+}
+
+async function api(method, path, body) {
+  const opts = { method, headers: { "X-CSRF-Token": csrf } };
+  if (body !== undefined) {
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body);
+  }
+  const resp = await fetch(path, opts);
+  if (resp.status === 401) {
+    location.reload();
+    throw new Error("signed out");
+  }
+  const data = await resp.json();
+  if (!resp.ok) {
+    let msg = data.error || resp.statusText;
+    if (data.detail) msg += ": " + data.detail;
+    if (data.servers) msg += " (" + data.servers.join(", ") + ")";
+    throw new Error(msg);
+  }
+  return data;
+}
+
+// dryRun is set when Ned only logs what it would have run.
+let dryRun = false;
+
+let toastTimer;
+function toast(msg, isError) {
+  const t = $("toast");
+  t.textContent = (dryRun ? "[DRY RUN] " : "") + msg;
+  t.className = isError ? "error" : "";
+  t.hidden = false;
+  clearTimeout(toastTimer);
+  toastTimer = setTimeout(() => { t.hidden = true; }, 6000);
+}
+
+// run disables button while action is in flight and reports failures.
+async function run(button, action) {
+  button.disabled = true;
+  try {
+    await action();
+  } catch (err) {
+    toast(err.message, true);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+function formatDuration(ns) {
+  const mins = Math.floor(ns / 6e10);
+  return mins >= 60 ? `${Math.floor(mins / 60)}h${mins % 60}m` : `${mins}m`;
+}
+
+function lifecycleButton(entry, action, label) {
+  const button = el("button", { type: "button", textContent: label });
+  if (action !== "start") button.className = "danger";
+  button.onclick = () => {
+    if (action !== "start" && !confirm(`${label} ${entry.name}?`)) return;
+    run(button, async () => {
+      await api("POST", `/api/v1/servers/${encodeURIComponent(entry.key)}/${action}`);
+      toast(`${VERBS[action]} ${entry.name}...`);
+    });
+  };
+  return button;
+}
+
+function card(entry) {
+  const status = entry.status;
+  const node = el("div", { className: "card" }, el("h3", { textContent: entry.name }));
+
+  if (!status) {
+    node.append(el("div", { className: "meta", textContent: "Not queryable" }));
+  } else if (!status.online) {
+    node.classList.add("offline");
+    node.append(el("div", { className: "meta", textContent: "Offline" }));
+  } else {
+    node.classList.add("online");
+    node.append(
+      el("div", { className: "count", textContent: `${status.players} / ${status.max_players}` }),
+      el("div", { className: "meta", textContent: status.map + (status.bots ? ` · ${status.bots} bots` : "") }),
+    );
+  }
+
+  if (entry.category !== "match") {
+    node.append(el("div", { className: "actions" },
+      lifecycleButton(entry, "start", "Start"),
+      lifecycleButton(entry, "stop", "Stop"),
+      lifecycleButton(entry, "restart", "Restart"),
+    ));
+  }
+
+  if (status && status.online && status.players > 0 && entry.category !== "match") {
+    const list = el("ul", { className: "players" });
+    node.append(list);
+    api("GET", `/api/v1/players/${encodeURIComponent(entry.key)}`).then((detail) => {
+      for (const p of detail.players || []) {
+        list.append(el("li", {},
+          el("span", { textContent: p.name || "(connecting)" }),
+          el("span", { className: "score", textContent: `${p.score} · ${formatDuration(p.duration_ns)}` }),
+        ));
+      }
+    }).catch(() => {});
+  }
+  return node;
+}
+
+function renderBoard(entries) {
+  const byCategory = new Map();
+  for (const e of entries) {
+    if (!byCategory.has(e.category)) byCategory.set(e.category, []);
+    byCategory.get(e.category).push(e);
+  }
+
+  const labels = new Map(CATEGORIES);
+  const order = CATEGORIES.map(([key]) => key);
+  for (const key of [...byCategory.keys()].sort()) {
+    if (!labels.has(key)) order.push(key);
+  }
+
+  const board = $("board");
+  board.replaceChildren();
+  for (const key of order) {
+    const group = byCategory.get(key);
+    if (!group) continue;
+    board.append(el("section", { className: "category" },
+      el("h2", { textContent: labels.get(key) || key || "Other" }),
+      el("div", { className: "cards" }, ...group.map(card)),
+    ));
+  }
+
+  // Keep the map picker in step with the CS2 servers on the board.
+  const select = $("map-server");
+  const current = select.value;
+  select.replaceChildren(el("option", { value: "", textContent: "All CS2 servers" }));
+  for (const e of entries) {
+    if (e.category === "cs2" || e.category === "match") {
+      select.append(el("option", { value: e.key, textContent: e.name }));
+    }
+  }
+  select.value = current;
+  if (select.selectedIndex < 0) select.value = "";
+}
+
+async function refresh() {
+  try {
+    const data = await api("GET", "/api/v1/servers");
+    renderBoard(data.servers || []);
+  } catch (err) {
+    toast("Refreshing the board failed: " + err.message, true);
+  }
+}
+
+function log(text, className) {
+  const out = $("console");
+  out.append(el("div", { className: className || "", textContent: text }));
+  out.scrollTop = out.scrollHeight;
+}
+
+function logResults(results) {
+  for (const r of results) {
+    if (r.error) {
+      log(`[${r.server}] ${r.error}`, "err");
+    } else {
+      log(`[${r.server}] ${r.response || "(no response)"}`);
+    }
+  }
+}
+
+function setupRCON() {
+  api("GET", "/api/v1/rcon/targets").then((data) => {
+    $("rcon-target").replaceChildren(...data.targets.map((t) =>
+      el("option", { value: t.value, textContent: t.name })));
+  });
+
+  $("rcon").onsubmit = (ev) => {
+    ev.preventDefault();
+    const target = $("rcon-target").value;
+    const command = $("rcon-command").value.trim();
+    if (!command) return;
+    const button = ev.submitter;
+    run(button, async () => {
+      log(`${target}> ${command}`, "cmd");
+      try {
+        const data = await api("POST", "/api/v1/rcon", { target, command });
+        logResults(data.results);
+        $("rcon-command").value = "";
+      } catch (err) {
+        log(err.message, "err");
+      }
+    });
+  };
+}
+
+function setupMatches() {
+  $("match-start").onsubmit = (ev) => {
+    ev.preventDefault();
+    const count = parseInt($("match-count").value, 10);
+    run(ev.submitter, async () => {
+      await api("POST", "/api/v1/matches", { count });
+      toast(`Started ${count} match server(s).`);
+      refresh();
+    });
+  };
+
+  $("match-stop").onclick = (ev) => {
+    if (!confirm("Stop all match servers?")) return;
+    run(ev.target, async () => {
+      await api("DELETE", "/api/v1/matches");
+      toast("Stopped all match servers.");
+      refresh();
+    });
+  };
+
+  $("match-map").onsubmit = (ev) => {
+    ev.preventDefault();
+    const map = $("map-name").value.trim();
+    const server = $("map-server").value;
+    run(ev.submitter, async () => {
+      const data = await api("POST", "/api/v1/matches/map", { map, server });
+      log(`changelevel ${map}`, "cmd");
+      logResults(data.results);
+      toast(`Changing map to ${map}.`);
+    });
+  };
+}
+
+async function main() {
+  const resp = await fetch("/auth/me");
+  if (!resp.ok) {
+    $("signin").hidden = false;
+    return;
+  }
+  const me = await resp.json();
+  csrf = me.csrf;
+  dryRun = me.dry_run;
+
+  $("user-name").textContent = (dryRun ? "[DRY RUN] " : "") + me.name + (me.roles.length ? ` (${me.roles.join(", ")})` : "");
+  $("user").hidden = false;
+  $("logout").onclick = async () => {
+    await fetch("/auth/logout", { method: "POST", headers: { "X-CSRF-Token": csrf } });
+    location.reload();
+  };
+
+  $("app").hidden = false;
+  setupRCON();
+  setupMatches();
+  refresh();
+  setInterval(refresh, REFRESH_MS);
+}
+
+main();
@@ -0,0 +1,315 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netwarlan/ned/internal/logging"
+)
+
+// dockerAPI is the Engine API version requests are made against. 1.41
+// ships with Docker 20.10, so any supported engine accepts it.
+const dockerAPI = "/v1.41"
+
+// composeProjectLabel is set by docker compose on every container it creates.
+const composeProjectLabel = "com.docker.compose.project"
+
+// DockerExecutor implements Executor against the Docker Engine API instead
+// of shell scripts. It manages the containers of an existing compose
+// project: they must have been created once with docker compose, after
+// which Ned starts, stops and restarts them directly and reports their
+// health and exit codes. "up" and "restart" wait for every container to be
+// running, and healthy if it has a health check.
+type DockerExecutor struct {
+	client        *http.Client
+	stopTimeout   time.Duration // grace period before the engine kills a container
+	healthTimeout time.Duration
+	pollInterval  time.Duration
+}
+
+// NewDockerExecutor creates a DockerExecutor talking to the Engine over the
+// unix socket at socketPath.
+func NewDockerExecutor(socketPath string) *DockerExecutor {
+	dialer := &net.Dialer{}
+	return &DockerExecutor{
+		client: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}},
+		stopTimeout:   10 * time.Second,
+		healthTimeout: 2 * time.Minute,
+		pollInterval:  2 * time.Second,
+	}
+}
+
+// dockerContainer is the subset of the container list the executor uses.
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+}
+
+func (c dockerContainer) name() string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return c.ID[:min(12, len(c.ID))]
+}
+
+// dockerState is the State object of a container inspect.
+type dockerState struct {
+	Status   string `json:"Status"` // "created", "running", "exited", ...
+	ExitCode int    `json:"ExitCode"`
+	Health   *struct {
+		Status string `json:"Status"` // "starting", "healthy" or "unhealthy"
+	} `json:"Health"`
+}
+
+// Run applies command to the containers of a compose project.
+// project is the compose project name (the label docker compose sets).
+// command is "up", "down" or "restart"; env is not used.
+func (e *DockerExecutor) Run(ctx context.Context, project, command string, _ map[string]string) (*Result, error) {
+	var op string
+	switch command {
+	case "up", "start", "u":
+		op = "start"
+	case "down", "stop":
+		op = "stop"
+	case "restart":
+		op = "restart"
+	default:
+		return nil, fmt.Errorf("docker executor does not support %q", command)
+	}
+
+	start := time.Now()
+	result := &Result{}
+	defer func() {
+		result.Duration = time.Since(start)
+		logging.FromContext(ctx).Info("docker action finished",
+			"project", project,
+			"action", command,
+			"exit_code", result.ExitCode,
+			"duration", result.Duration,
+		)
+	}()
+
+	containers, err := e.containers(ctx, project)
+	if err != nil {
+		return result, err
+	}
+	if len(containers) == 0 {
+		return result, fmt.Errorf("compose project %q has no containers; create them with docker compose first", project)
+	}
+
+	var stdout, stderr strings.Builder
+	for _, c := range containers {
+		path := "/containers/" + c.ID + "/" + op
+		if op != "start" {
+			path += fmt.Sprintf("?t=%d", int(e.stopTimeout.Seconds()))
+		}
+		if err := e.do(ctx, http.MethodPost, path, nil); err != nil {
+			fmt.Fprintf(&stderr, "%s: %v\n", c.name(), err)
+			result.ExitCode = 1
+			continue
+		}
+		fmt.Fprintf(&stdout, "%s: %s\n", c.name(), op)
+	}
+
+	if result.ExitCode == 0 && op != "stop" {
+		result.ExitCode, err = e.awaitHealthy(ctx, containers, &stdout, &stderr)
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	return result, err
+}
+
+// awaitHealthy polls the containers until every one is running and healthy,
+// returning exit code 1 if any fails or turns unhealthy. A container that
+// fails reports its own exit code. One that exits with code 0, such as a
+// one-shot init container, has done its job.
+func (e *DockerExecutor) awaitHealthy(ctx context.Context, containers []dockerContainer, stdout, stderr io.Writer) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.healthTimeout)
+	defer cancel()
+
+	pending := containers
+	for {
+		var waiting []dockerContainer
+		for _, c := range pending {
+			var inspect struct{ State dockerState }
+			if err := e.do(ctx, http.MethodGet, "/containers/"+c.ID+"/json", &inspect); err != nil {
+				return 1, err
+			}
+			state := inspect.State
+			switch {
+			case state.Status == "exited" && state.ExitCode == 0:
+				fmt.Fprintf(stdout, "%s: completed\n", c.name())
+			case state.Status == "exited" || state.Status == "dead":
+				fmt.Fprintf(stderr, "%s: exited with code %d\n", c.name(), state.ExitCode)
+				return max(state.ExitCode, 1), nil
+			case state.Health != nil && state.Health.Status == "unhealthy":
+				fmt.Fprintf(stderr, "%s: unhealthy\n", c.name())
+				return 1, nil
+			case state.Status == "running" && (state.Health == nil || state.Health.Status == "healthy"):
+				if state.Health != nil {
+					fmt.Fprintf(stdout, "%s: healthy\n", c.name())
+				}
+			default:
+				waiting = append(waiting, c)
+			}
+		}
+		if len(waiting) == 0 {
+			return 0, nil
+		}
+		pending = waiting
+
+		select {
+		case <-ctx.Done():
+			names := make([]string, len(pending))
+			for i, c := range pending {
+				names[i] = c.name()
+			}
+			return 1, fmt.Errorf("timed out waiting for %s to become healthy", strings.Join(names, ", "))
+		case <-time.After(e.pollInterval):
+		}
+	}
+}
+
+// LogOptions select which log lines to fetch.
+type LogOptions struct {
+	Lines int           // the last N lines; 0 means all
+	Since time.Duration // only lines newer than this; 0 means any age
+}
+
+// LogFetcher fetches the recent output of a server's containers.
+type LogFetcher interface {
+	Logs(ctx context.Context, target string, opts LogOptions) (string, error)
+}
+
+// Logs returns the stdout and stderr of every container of a compose
+// project. When the project has several containers, each line is prefixed
+// with its container's name.
+func (e *DockerExecutor) Logs(ctx context.Context, project string, opts LogOptions) (string, error) {
+	containers, err := e.containers(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	if len(containers) == 0 {
+		return "", fmt.Errorf("compose project %q has no containers", project)
+	}
+
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {"all"}}
+	if opts.Lines > 0 {
+		query.Set("tail", strconv.Itoa(opts.Lines))
+	}
+	if opts.Since > 0 {
+		query.Set("since", strconv.FormatInt(time.Now().Add(-opts.Since).Unix(), 10))
+	}
+
+	var out strings.Builder
+	for _, c := range containers {
+		raw, err := e.get(ctx, "/containers/"+c.ID+"/logs?"+query.Encode())
+		if err != nil {
+			return out.String(), fmt.Errorf("%s: %w", c.name(), err)
+		}
+		text := string(demux(raw))
+		if len(containers) == 1 {
+			out.WriteString(text)
+			continue
+		}
+		for line := range strings.Lines(text) {
+			out.WriteString(c.name() + " | " + line)
+		}
+	}
+	return out.String(), nil
+}
+
+// demux strips the 8-byte frame headers the engine interleaves stdout and
+// stderr with for containers without a TTY. Output of TTY containers is
+// returned as is.
+func demux(raw []byte) []byte {
+	var out bytes.Buffer
+	for len(raw) >= 8 {
+		if raw[0] > 2 || raw[1] != 0 || raw[2] != 0 || raw[3] != 0 {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(raw[4:8]))
+		if 8+size > len(raw) {
+			break
+		}
+		out.Write(raw[8 : 8+size])
+		raw = raw[8+size:]
+	}
+	if out.Len() == 0 {
+		return raw
+	}
+	out.Write(raw)
+	return out.Bytes()
+}
+
+// containers lists every container of a compose project, stopped or not.
+func (e *DockerExecutor) containers(ctx context.Context, project string) ([]dockerContainer, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {composeProjectLabel + "=" + project}})
+	if err != nil {
+		return nil, err
+	}
+	var list []dockerContainer
+	path := "/containers/json?all=1&filters=" + url.QueryEscape(string(filters))
+	if err := e.do(ctx, http.MethodGet, path, &list); err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+	return list, nil
+}
+
+// get sends a GET request to the Engine and returns the raw response body.
+func (e *DockerExecutor) get(ctx context.Context, path string) ([]byte, error) {
+	var body bytes.Buffer
+	if err := e.do(ctx, http.MethodGet, path, &body); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// do sends a request to the Engine and decodes a JSON response into out if
+// it is non-nil, or copies the body if out is a *bytes.Buffer. 304 Not
+// Modified, which the engine returns for a container already in the
+// requested state, counts as success.
+func (e *DockerExecutor) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker"+dockerAPI+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker engine: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return fmt.Errorf("docker engine: %s: %s", resp.Status, apiErr.Message)
+	}
+	if out == nil || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if buf, ok := out.(*bytes.Buffer); ok {
+		_, err := buf.ReadFrom(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,272 @@
+package executor
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEngine serves the parts of the Docker Engine API DockerExecutor uses.
+type fakeEngine struct {
+	mu         sync.Mutex
+	containers map[string]*fakeContainer
+	requests   []string
+}
+
+type fakeContainer struct {
+	name    string
+	project string
+	status  string
+	health  string // "" when the container has no health check
+	exit    int
+	onStart func(c *fakeContainer) // replaces "running" after a start
+	logs    []string               // lines, served as multiplexed stdout
+	tty     bool                   // serve logs without frame headers
+}
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1.41")
+	if path == "/containers/json" {
+		var filters map[string][]string
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		list := []map[string]any{}
+		for id, c := range f.containers {
+			if filters["label"][0] == "com.docker.compose.project="+c.project {
+				list = append(list, map[string]any{"Id": id, "Names": []string{"/" + c.name}})
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/containers/"), "/")
+	c, ok := f.containers[parts[0]]
+	if !ok || len(parts) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "No such container: " + parts[0]})
+		return
+	}
+	switch parts[1] {
+	case "json":
+		state := map[string]any{"Status": c.status, "ExitCode": c.exit}
+		if c.health != "" {
+			state["Health"] = map[string]string{"Status": c.health}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"State": state})
+	case "start", "restart":
+		if parts[1] == "start" && c.status == "running" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		c.status = "running"
+		if c.onStart != nil {
+			c.onStart(c)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "stop":
+		c.status = "exited"
+		w.WriteHeader(http.StatusNoContent)
+	case "logs":
+		lines := c.logs
+		if n, err := strconv.Atoi(r.URL.Query().Get("tail")); err == nil && n < len(lines) {
+			lines = lines[len(lines)-n:]
+		}
+		for _, line := range lines {
+			if !c.tty {
+				header := make([]byte, 8)
+				header[0] = 1
+				binary.BigEndian.PutUint32(header[4:], uint32(len(line)+1))
+				w.Write(header)
+			}
+			w.Write([]byte(line + "\n"))
+		}
+	}
+}
+
+func newFakeEngine(t *testing.T, containers map[string]*fakeContainer) (*fakeEngine, *DockerExecutor) {
+	t.Helper()
+	// t.TempDir paths can exceed the unix socket path limit.
+	dir, err := os.MkdirTemp("", "ned-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := &fakeEngine{containers: containers}
+	srv := httptest.NewUnstartedServer(engine)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	exec := NewDockerExecutor(socket)
+	exec.pollInterval = time.Millisecond
+	exec.healthTimeout = time.Second
+	return engine, exec
+}
+
+func TestDockerExecutor_Up(t *testing.T) {
+	engine, exec := newFakeEngine(t, map[string]*fakeContainer{
+		"aaa": {name: "tf2-server-1", project: "tf2", status: "exited", onStart: func(c *fakeContainer) {
+			c.health = "starting"
+		}},
+		"bbb": {name: "tf2-redis-1", project: "tf2", status: "running"},
+		"ccc": {name: "rust-server-1", project: "rust", status: "exited"},
+	})
+
+	// The health check passes once the executor has polled a few times.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		engine.mu.Lock()
+		engine.containers["aaa"].health = "healthy"
+		engine.mu.Unlock()
+	}()
+
+	result, err := exec.Run(context.Background(), "tf2", "up", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("exit code = %d, want 0; stderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "tf2-server-1: healthy") {
+		t.Errorf("stdout = %q, want the health check result", result.Stdout)
+	}
+	if engine.containers["ccc"].status != "exited" {
+		t.Error("a container of another project was started")
+	}
+}
+
+func TestDockerExecutor_ExitCode(t *testing.T) {
+	_, exec := newFakeEngine(t, map[string]*fakeContainer{
+		"aaa": {name: "l4d2-server-1", project: "l4d2", status: "exited", onStart: func(c *fakeContainer) {
+			c.status, c.exit = "exited", 3
+		}},
+	})
+
+	result, err := exec.Run(context.Background(), "l4d2", "restart", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("exit code = %d, want the container's 3", result.ExitCode)
+	}
+	if !strings.Contains(result.Stderr, "l4d2-server-1: exited with code 3") {
+		t.Errorf("stderr = %q", result.Stderr)
+	}
+}
+
+func TestDockerExecutor_InitContainer(t *testing.T) {
+	_, exec := newFakeEngine(t, map[string]*fakeContainer{
+		"aaa": {name: "rust-server-1", project: "rust", status: "exited"},
+		"bbb": {name: "rust-init-1", project: "rust", status: "exited", onStart: func(c *fakeContainer) {
+			c.status, c.exit = "exited", 0
+		}},
+	})
+
+	result, err := exec.Run(context.Background(), "rust", "up", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "rust-init-1: completed") {
+		t.Errorf("exit code = %d, stdout = %q, stderr = %q, want the init container done", result.ExitCode, result.Stdout, result.Stderr)
+	}
+}
+
+func TestDockerExecutor_Unhealthy(t *testing.T) {
+	_, exec := newFakeEngine(t, map[string]*fakeContainer{
+		"aaa": {name: "gmod-server-1", project: "gmod", status: "exited", onStart: func(c *fakeContainer) {
+			c.health = "unhealthy"
+		}},
+	})
+
+	result, err := exec.Run(context.Background(), "gmod", "up", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 1 || !strings.Contains(result.Stderr, "gmod-server-1: unhealthy") {
+		t.Errorf("exit code = %d, stderr = %q, want an unhealthy failure", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestDockerExecutor_Down(t *testing.T) {
+	engine, exec := newFakeEngine(t, map[string]*fakeContainer{
+		"aaa": {name: "tf2-server-1", project: "tf2", status: "running"},
+	})
+
+	result, err := exec.Run(context.Background(), "tf2", "down", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || engine.containers["aaa"].status != "exited" {
+		t.Errorf("exit code = %d, status = %q", result.ExitCode, engine.containers["aaa"].status)
+	}
+	for _, req := range engine.requests {
+		if strings.HasSuffix(req, "/json") && strings.Contains(req, "/containers/aaa") {
+			t.Error("down waited for the container's health")
+		}
+	}
+}
+
+func TestDockerExecutor_Errors(t *testing.T) {
+	_, exec := newFakeEngine(t, map[string]*fakeContainer{})
+
+	if _, err := exec.Run(context.Background(), "missing", "up", nil); err == nil || !strings.Contains(err.Error(), "has no containers") {
+		t.Errorf("err = %v, want a no containers error", err)
+	}
+	if _, err := exec.Run(context.Background(), "tf2", "update", nil); err == nil {
+		t.Error("expected an error for an unsupported command")
+	}
+
+	unreachable := NewDockerExecutor(filepath.Join(t.TempDir(), "none.sock"))
+	if _, err := unreachable.Run(context.Background(), "tf2", "up", nil); err == nil || !strings.Contains(err.Error(), "docker engine") {
+		t.Errorf("err = %v, want a connection error", err)
+	}
+}
+
+func TestDockerExecutor_Logs(t *testing.T) {
+	engine, exec := newFakeEngine(t, map[string]*fakeContainer{
+		"aaa": {name: "tf2-server-1", project: "tf2", logs: []string{"one", "two", "three"}},
+		"bbb": {name: "rust-server-1", project: "rust", logs: []string{"a", "b"}, tty: true},
+		"ccc": {name: "rust-redis-1", project: "rust", logs: []string{"ready"}},
+	})
+
+	got, err := exec.Logs(context.Background(), "tf2", LogOptions{Lines: 2, Since: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "two\nthree\n" {
+		t.Errorf("logs = %q, want the last two lines without frame headers", got)
+	}
+	if req := engine.requests[len(engine.requests)-1]; !strings.HasSuffix(req, "/containers/aaa/logs") {
+		t.Errorf("last request = %q", req)
+	}
+
+	got, err = exec.Logs(context.Background(), "rust", LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"rust-server-1 | a\n", "rust-server-1 | b\n", "rust-redis-1 | ready\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("logs = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/netwarlan/ned/internal/logging"
+)
+
+// DryRunExecutor implements Executor by logging what would have run
+// instead of running it. Every command succeeds.
+type DryRunExecutor struct{}
+
+// NewDryRunExecutor creates a DryRunExecutor.
+func NewDryRunExecutor() *DryRunExecutor {
+	return &DryRunExecutor{}
+}
+
+// Run logs the script, command and env, and reports success.
+func (e *DryRunExecutor) Run(ctx context.Context, scriptPath, command string, env map[string]string) (*Result, error) {
+	logging.FromContext(ctx).Info("dry run: would run script", "script", scriptPath, "action", command, "env", formatEnv(env))
+	return &Result{Stdout: fmt.Sprintf("dry run: %s %s\n", scriptPath, command)}, nil
+}
+
+// formatEnv renders env as sorted KEY=value pairs.
+func formatEnv(env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		pairs = append(pairs, k+"="+env[k])
+	}
+	return strings.Join(pairs, " ")
+}
@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"time"
+
+	"github.com/netwarlan/ned/internal/logging"
 )
 
 // Result holds the output of a script execution.
@@ -25,22 +27,30 @@ type Executor interface {
 
 // ShellExecutor implements Executor by shelling out to bash.
 type ShellExecutor struct {
-	scriptsDir  string
-	environment string
-	timeout     time.Duration
+	scriptsDir    string
+	environment   string
+	timeout       time.Duration
+	updateTimeout time.Duration
 }
 
 // NewShellExecutor creates a new ShellExecutor.
 // scriptsDir is the absolute path to the game-deployment-scripts directory.
-// environment is "event" or "local".
+// environment is the active environment name, e.g. "event" or "local".
 func NewShellExecutor(scriptsDir, environment string) *ShellExecutor {
 	return &ShellExecutor{
-		scriptsDir:  scriptsDir,
-		environment: environment,
-		timeout:     120 * time.Second,
+		scriptsDir:    scriptsDir,
+		environment:   environment,
+		timeout:       120 * time.Second,
+		updateTimeout: 30 * time.Minute,
 	}
 }
 
+// SetUpdateTimeout sets how long "update" commands may run. Game updates
+// download gigabytes, so they get far longer than other commands.
+func (e *ShellExecutor) SetUpdateTimeout(d time.Duration) {
+	e.updateTimeout = d
+}
+
 // Run executes a service script with the given command.
 // scriptPath is relative to scriptsDir (e.g., "tf2/tf2.sh").
 // command is "up", "down", "restart", or "update".
@@ -53,8 +63,11 @@ func (e *ShellExecutor) Run(ctx context.Context, scriptPath, command string, env
 	// Use a shorter timeout for "up" commands since the shell scripts
 	// tail docker compose logs indefinitely after starting.
 	timeout := e.timeout
-	if command == "up" || command == "start" || command == "u" {
+	switch command {
+	case "up", "start", "u":
 		timeout = 30 * time.Second
+	case "update":
+		timeout = e.updateTimeout
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, timeout)
@@ -82,6 +95,14 @@ func (e *ShellExecutor) Run(ctx context.Context, scriptPath, command string, env
 		Stderr:   stderr.String(),
 		Duration: duration,
 	}
+	defer func() {
+		logging.FromContext(ctx).Info("script finished",
+			"script", scriptPath,
+			"action", command,
+			"exit_code", result.ExitCode,
+			"duration", duration,
+		)
+	}()
 
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -160,3 +160,16 @@ echo "ARGS=$@"
 		t.Errorf("stop should pass correct args: %s", result.Stdout)
 	}
 }
+
+func TestDryRunExecutor_Run(t *testing.T) {
+	result, err := NewDryRunExecutor().Run(context.Background(), "tf2/tf2.sh", "up", map[string]string{"B": "2", "A": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "dry run: tf2/tf2.sh up\n" {
+		t.Errorf("result = %+v", result)
+	}
+	if got := formatEnv(map[string]string{"B": "2", "A": "1"}); got != "A=1 B=2" {
+		t.Errorf("formatEnv = %q", got)
+	}
+}
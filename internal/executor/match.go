@@ -9,14 +9,14 @@ import (
 // MatchExecutor handles CS2 match server lifecycle.
 // It calls cs2.sh with: match up --count N / match down --count N
 type MatchExecutor struct {
-	executor      *ShellExecutor
-	scriptPath    string
-	maxInstances  int
+	executor     Executor
+	scriptPath   string
+	maxInstances int
 }
 
 // NewMatchExecutor creates a MatchExecutor.
 // scriptPath is relative to scriptsDir (e.g., "cs2/cs2.sh").
-func NewMatchExecutor(executor *ShellExecutor, scriptPath string, maxInstances int) *MatchExecutor {
+func NewMatchExecutor(executor Executor, scriptPath string, maxInstances int) *MatchExecutor {
 	return &MatchExecutor{
 		executor:     executor,
 		scriptPath:   scriptPath,
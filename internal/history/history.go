@@ -0,0 +1,184 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/fsutil"
+	"github.com/netwarlan/ned/internal/poller"
+)
+
+// Record is one observation of an online server.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Server  string    `json:"server"`
+	Map     string    `json:"map,omitempty"`
+	Players int       `json:"players"`
+	Bots    int       `json:"bots,omitempty"`
+}
+
+// Store keeps player count history in memory and appends every record to a
+// JSON lines file so it survives restarts.
+type Store struct {
+	retention time.Duration
+
+	mu      sync.RWMutex
+	file    *os.File
+	records []Record // ordered by Time
+}
+
+// Open loads the history at path, dropping records older than retention
+// (0 keeps everything), and opens the file for appending.
+func Open(path string, retention time.Duration) (*Store, error) {
+	s := &Store{retention: retention}
+
+	records, err := readRecords(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading history: %w", err)
+	}
+	kept := s.prune(records, time.Now())
+
+	// Rewrite the file when records were pruned so it does not grow forever.
+	if len(kept) < len(records) {
+		if err := writeRecords(path, kept); err != nil {
+			return nil, fmt.Errorf("compacting history: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening history: %w", err)
+	}
+	s.file = f
+	s.records = kept
+	return s, nil
+}
+
+func readRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A torn final write should not lose the whole history.
+			slog.Warn("skipping malformed history record", "path", path, "line", line, "err", err)
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+func writeRecords(path string, records []Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return fsutil.WriteFileAtomic(path, buf.Bytes())
+}
+
+// prune returns the records newer than the retention window.
+func (s *Store) prune(records []Record, now time.Time) []Record {
+	if s.retention <= 0 {
+		return records
+	}
+	cutoff := now.Add(-s.retention)
+	i := sort.Search(len(records), func(i int) bool { return !records[i].Time.Before(cutoff) })
+	return records[i:]
+}
+
+// Append stores records in memory and on disk.
+func (s *Store) Append(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	sort.SliceStable(s.records, func(i, j int) bool { return s.records[i].Time.Before(s.records[j].Time) })
+	s.records = s.prune(s.records, time.Now())
+	if _, err := s.file.Write(buf); err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	return nil
+}
+
+// Query returns the records for server (every server when empty) at or after
+// since, oldest first.
+func (s *Store) Query(server string, since time.Time) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start := sort.Search(len(s.records), func(i int) bool { return !s.records[i].Time.Before(since) })
+	var out []Record
+	for _, r := range s.records[start:] {
+		if server == "" || r.Server == server {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Close closes the history file.
+func (s *Store) Close() error {
+	return s.file.Close()
+}
+
+// Observe records every online server from a poll. It implements
+// poller.Observer.
+func (s *Store) Observe(_ context.Context, samples []poller.Sample) {
+	var records []Record
+	for _, sample := range samples {
+		if sample.Status == nil || !sample.Status.Online {
+			continue
+		}
+		records = append(records, Record{
+			Time:    sample.Time,
+			Server:  sample.Key,
+			Map:     sample.Status.Map,
+			Players: sample.Status.Players,
+			Bots:    sample.Status.Bots,
+		})
+	}
+	if err := s.Append(records...); err != nil {
+		slog.Error("recording player history", "err", err)
+	}
+}
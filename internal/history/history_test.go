@@ -0,0 +1,164 @@
+package history
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/poller"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+func TestStore_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now().Truncate(time.Second)
+
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Observe(context.Background(), []poller.Sample{
+		{Key: "tf2", Time: now, Status: &query.ServerStatus{Online: true, Map: "ctf_2fort", Players: 10, Bots: 2}},
+		{Key: "l4d2", Time: now, Status: &query.ServerStatus{Online: false}},
+	})
+	s.Close()
+
+	s, err = Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	got := s.Query("", time.Time{})
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1 (offline servers are not recorded)", len(got))
+	}
+	if got[0].Server != "tf2" || got[0].Players != 10 || got[0].Map != "ctf_2fort" || !got[0].Time.Equal(now) {
+		t.Errorf("record = %+v", got[0])
+	}
+}
+
+func TestStore_RetentionCompactsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now()
+
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Append(
+		Record{Time: now.Add(-48 * time.Hour), Server: "tf2", Players: 1},
+		Record{Time: now.Add(-time.Hour), Server: "tf2", Players: 2},
+	)
+	s.Close()
+
+	s, err = Open(path, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if got := s.Query("tf2", time.Time{}); len(got) != 1 || got[0].Players != 2 {
+		t.Errorf("records after retention = %+v", got)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 1 {
+		t.Errorf("file has %d lines after compaction, want 1", n)
+	}
+}
+
+func TestStore_SkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	os.WriteFile(path, []byte(`{"time":"2026-01-01T00:00:00Z","server":"tf2","players":3}`+"\n"+`{"time":`), 0644)
+
+	s, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.Query("", time.Time{}); len(got) != 1 {
+		t.Errorf("got %d records, want 1", len(got))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	interval := 30 * time.Minute
+	records := []Record{
+		{Time: start, Server: "cs2", Map: "de_dust2", Players: 10},
+		{Time: start.Add(30 * time.Minute), Server: "cs2", Map: "de_dust2", Players: 20},
+		{Time: start.Add(60 * time.Minute), Server: "cs2", Map: "de_inferno", Players: 6},
+		// Server was down for hours; the previous sample is capped at 2×interval.
+		{Time: start.Add(6 * time.Hour), Server: "cs2", Map: "de_inferno", Players: 4},
+	}
+
+	sum := Summarize("cs2", records, interval)
+	if sum.Peak != 20 || !sum.PeakTime.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("peak = %d at %v", sum.Peak, sum.PeakTime)
+	}
+	if sum.Average != 10 {
+		t.Errorf("average = %v, want 10", sum.Average)
+	}
+	// 10×0.5 + 20×0.5 + 6×1 + 4×0.5
+	if want := 23.0; math.Abs(sum.PlayerHours-want) > 1e-9 {
+		t.Errorf("player-hours = %v, want %v", sum.PlayerHours, want)
+	}
+	if len(sum.Maps) != 2 || sum.Maps[0].Map != "de_dust2" || sum.Maps[0].Duration != time.Hour {
+		t.Errorf("maps = %+v", sum.Maps)
+	}
+}
+
+func TestSummarizeAll_OrdersByPlayerHours(t *testing.T) {
+	now := time.Now()
+	sums := SummarizeAll([]Record{
+		{Time: now, Server: "quiet", Players: 1},
+		{Time: now, Server: "busy", Players: 30},
+	}, time.Minute)
+	if len(sums) != 2 || sums[0].Server != "busy" {
+		t.Errorf("order = %+v", sums)
+	}
+}
+
+func TestPeakConcurrency(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	interval := 30 * time.Second
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	records := []Record{
+		{Time: at(0), Server: "cs2", Players: 10},
+		{Time: at(time.Second), Server: "tf2", Players: 8},
+		// The busiest server alone peaks here, but the others are quieter.
+		{Time: at(30 * time.Second), Server: "cs2", Players: 16},
+		{Time: at(31 * time.Second), Server: "tf2", Players: 1},
+		// Every server is busy at once in this tick.
+		{Time: at(60 * time.Second), Server: "cs2", Players: 12},
+		{Time: at(60*time.Second + 200*time.Millisecond), Server: "tf2", Players: 7},
+		{Time: at(61 * time.Second), Server: "l4d2", Players: 4},
+	}
+	if peak, when := PeakConcurrency(records, interval); peak != 23 || !when.Equal(at(60*time.Second)) {
+		t.Errorf("peak = %d at %v, want 23 at %v", peak, when, at(60*time.Second))
+	}
+
+	if peak, when := PeakConcurrency(nil, interval); peak != 0 || !when.IsZero() {
+		t.Errorf("no records: peak = %d at %v", peak, when)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(4 * time.Hour)
+	records := []Record{
+		{Time: from, Players: 0},
+		{Time: from.Add(time.Hour), Players: 7},
+		{Time: from.Add(3 * time.Hour), Players: 14},
+	}
+	if got, want := Sparkline(records, from, to, 4), "▁▄ █"; got != want {
+		t.Errorf("Sparkline = %q, want %q", got, want)
+	}
+}
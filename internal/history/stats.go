@@ -0,0 +1,168 @@
+package history
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// MapShare is the time a map was played during a window.
+type MapShare struct {
+	Map         string
+	Duration    time.Duration
+	PlayerHours float64
+}
+
+// Summary describes one server's activity over a window.
+type Summary struct {
+	Server      string
+	Samples     int
+	Peak        int
+	PeakTime    time.Time
+	Average     float64 // mean players across samples
+	PlayerHours float64
+	Maps        []MapShare // most played first
+}
+
+// Summarize computes statistics for a single server's records, which must be
+// ordered by time. interval is the expected gap between samples; a sample
+// counts for at most twice that long, so time a server spent offline or
+// unpolled is not credited to its last reading.
+func Summarize(server string, records []Record, interval time.Duration) Summary {
+	sum := Summary{Server: server, Samples: len(records)}
+	if len(records) == 0 {
+		return sum
+	}
+
+	maxGap := 2 * interval
+	maps := make(map[string]*MapShare)
+	total := 0
+	for i, r := range records {
+		total += r.Players
+		if r.Players > sum.Peak || sum.PeakTime.IsZero() {
+			sum.Peak, sum.PeakTime = r.Players, r.Time
+		}
+
+		span := interval
+		if i+1 < len(records) {
+			span = records[i+1].Time.Sub(r.Time)
+		}
+		span = min(span, maxGap)
+		hours := float64(r.Players) * span.Hours()
+		sum.PlayerHours += hours
+
+		if r.Map == "" {
+			continue
+		}
+		m, ok := maps[r.Map]
+		if !ok {
+			m = &MapShare{Map: r.Map}
+			maps[r.Map] = m
+		}
+		m.Duration += span
+		m.PlayerHours += hours
+	}
+	sum.Average = float64(total) / float64(len(records))
+
+	for _, m := range maps {
+		sum.Maps = append(sum.Maps, *m)
+	}
+	sort.Slice(sum.Maps, func(i, j int) bool {
+		if sum.Maps[i].PlayerHours != sum.Maps[j].PlayerHours {
+			return sum.Maps[i].PlayerHours > sum.Maps[j].PlayerHours
+		}
+		return sum.Maps[i].Map < sum.Maps[j].Map
+	})
+	return sum
+}
+
+// SummarizeAll groups records by server and summarizes each, busiest
+// (by player-hours) first.
+func SummarizeAll(records []Record, interval time.Duration) []Summary {
+	byServer := make(map[string][]Record)
+	for _, r := range records {
+		byServer[r.Server] = append(byServer[r.Server], r)
+	}
+	out := make([]Summary, 0, len(byServer))
+	for server, rs := range byServer {
+		out = append(out, Summarize(server, rs, interval))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].PlayerHours != out[j].PlayerHours {
+			return out[i].PlayerHours > out[j].PlayerHours
+		}
+		return out[i].Server < out[j].Server
+	})
+	return out
+}
+
+// PeakConcurrency returns the most players online across all servers at
+// once, and when that was. Records, ordered by time, are grouped into poll
+// ticks: a tick starts at a record more than half an interval after the
+// start of the previous one, and counts each server's last reading in it.
+func PeakConcurrency(records []Record, interval time.Duration) (peak int, at time.Time) {
+	var start time.Time
+	tick := make(map[string]int)
+	flush := func() {
+		total := 0
+		for _, players := range tick {
+			total += players
+		}
+		if total > peak || at.IsZero() {
+			peak, at = total, start
+		}
+		clear(tick)
+	}
+	for _, r := range records {
+		if len(tick) > 0 && r.Time.Sub(start) > interval/2 {
+			flush()
+		}
+		if len(tick) == 0 {
+			start = r.Time
+		}
+		tick[r.Server] = r.Players
+	}
+	if len(tick) > 0 {
+		flush()
+	}
+	return peak, at
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders player counts between from and to as width block
+// characters. Each column shows the peak in its slice of time; columns with
+// no samples are blank.
+func Sparkline(records []Record, from, to time.Time, width int) string {
+	if width <= 0 || !to.After(from) {
+		return ""
+	}
+	cols := make([]int, width)
+	for i := range cols {
+		cols[i] = -1
+	}
+	span := to.Sub(from)
+	peak := 0
+	for _, r := range records {
+		if r.Time.Before(from) || r.Time.After(to) {
+			continue
+		}
+		i := int(int64(r.Time.Sub(from)) * int64(width) / int64(span))
+		i = min(i, width-1)
+		cols[i] = max(cols[i], r.Players)
+		peak = max(peak, r.Players)
+	}
+
+	var sb strings.Builder
+	for _, v := range cols {
+		switch {
+		case v < 0:
+			sb.WriteRune(' ')
+		case peak == 0:
+			sb.WriteRune(sparkBlocks[0])
+		default:
+			sb.WriteRune(sparkBlocks[v*(len(sparkBlocks)-1)/peak])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/netwarlan/ned/internal/config"
+)
+
+func TestNew_JSONWithContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.LoggingConfig{Format: "json", Level: "debug"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithLogger(context.Background(), logger.With("interaction_id", "123"))
+	ctx = With(ctx, "server", "tf2")
+	FromContext(ctx).Debug("script finished")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if entry["interaction_id"] != "123" || entry["server"] != "tf2" {
+		t.Errorf("missing correlation attributes: %v", entry)
+	}
+}
+
+func TestNew_LevelFilters(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.LoggingConfig{Level: "warn"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("info logged at warn level: %s", buf.String())
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	if _, err := New(config.LoggingConfig{Format: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := New(config.LoggingConfig{Level: "loud"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestFromContext_Default(t *testing.T) {
+	if FromContext(context.Background()) == nil {
+		t.Error("FromContext returned nil without a logger")
+	}
+}
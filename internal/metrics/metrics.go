@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/poller"
+	"github.com/netwarlan/ned/internal/rcon"
+)
+
+// scriptBuckets covers quick "down" runs through slow SteamCMD updates.
+var scriptBuckets = []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600}
+
+// Metrics is the set of metrics Ned exports.
+type Metrics struct {
+	Registry *Registry
+
+	ServerUp         *GaugeVec
+	ServerPlayers    *GaugeVec
+	ServerMaxPlayers *GaugeVec
+	ServerBots       *GaugeVec
+	QueryLatency     *GaugeVec
+	Commands         *CounterVec
+	ScriptDuration   *HistogramVec
+	ScriptRuns       *CounterVec
+	RCONRequests     *CounterVec
+	DiscordConnected *GaugeVec
+}
+
+// New creates and registers all Ned metrics.
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry:         r,
+		ServerUp:         r.NewGaugeVec("ned_server_up", "Whether the server answered its last A2S query (1) or not (0).", "server"),
+		ServerPlayers:    r.NewGaugeVec("ned_server_players", "Players connected at the last A2S query.", "server"),
+		ServerMaxPlayers: r.NewGaugeVec("ned_server_max_players", "Player slots reported at the last A2S query.", "server"),
+		ServerBots:       r.NewGaugeVec("ned_server_bots", "Bots reported at the last A2S query.", "server"),
+		QueryLatency:     r.NewGaugeVec("ned_server_query_latency_seconds", "A2S_INFO round trip time of the last query.", "server"),
+		Commands:         r.NewCounterVec("ned_commands_total", "/ned commands handled, by subcommand and outcome.", "subcommand", "outcome"),
+		ScriptDuration:   r.NewHistogramVec("ned_script_duration_seconds", "Service script run time.", scriptBuckets, "script", "action"),
+		ScriptRuns:       r.NewCounterVec("ned_script_runs_total", "Service script runs, by result.", "script", "action", "result"),
+		RCONRequests:     r.NewCounterVec("ned_rcon_requests_total", "RCON commands sent, by result.", "address", "result"),
+		DiscordConnected: r.NewGaugeVec("ned_discord_connected", "Whether the Discord gateway connection is up (1) or not (0)."),
+	}
+}
+
+// Observe records a poll of every queryable server. It implements
+// poller.Observer.
+func (m *Metrics) Observe(_ context.Context, samples []poller.Sample) {
+	for _, s := range samples {
+		if s.Status == nil || !s.Status.Online {
+			m.ServerUp.Set(0, s.Key)
+			m.ServerPlayers.Set(0, s.Key)
+			m.ServerBots.Set(0, s.Key)
+			m.ServerMaxPlayers.Delete(s.Key)
+			m.QueryLatency.Delete(s.Key)
+			continue
+		}
+		m.ServerUp.Set(1, s.Key)
+		m.ServerPlayers.Set(float64(s.Status.Players), s.Key)
+		m.ServerMaxPlayers.Set(float64(s.Status.MaxPlayers), s.Key)
+		m.ServerBots.Set(float64(s.Status.Bots), s.Key)
+		m.QueryLatency.Set(s.Status.Latency.Seconds(), s.Key)
+	}
+}
+
+// SetDiscordConnected records the gateway connection state.
+func (m *Metrics) SetDiscordConnected(connected bool) {
+	v := 0.0
+	if connected {
+		v = 1
+	}
+	m.DiscordConnected.Set(v)
+}
+
+// instrumentedExecutor records script durations and results.
+type instrumentedExecutor struct {
+	next executor.Executor
+	m    *Metrics
+}
+
+// InstrumentExecutor wraps exec so every run is measured.
+func (m *Metrics) InstrumentExecutor(exec executor.Executor) executor.Executor {
+	return &instrumentedExecutor{next: exec, m: m}
+}
+
+func (e *instrumentedExecutor) Run(ctx context.Context, scriptPath, command string, env map[string]string) (*executor.Result, error) {
+	start := time.Now()
+	result, err := e.next.Run(ctx, scriptPath, command, env)
+
+	duration := time.Since(start)
+	if result != nil && result.Duration > 0 {
+		duration = result.Duration
+	}
+	e.m.ScriptDuration.Observe(duration.Seconds(), scriptPath, command)
+
+	outcome := "ok"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case result != nil && result.ExitCode != 0:
+		outcome = "exit_nonzero"
+	}
+	e.m.ScriptRuns.Inc(scriptPath, command, outcome)
+	return result, err
+}
+
+// instrumentedRCON records RCON results per server address.
+type instrumentedRCON struct {
+	next rcon.Client
+	m    *Metrics
+}
+
+// InstrumentRCON wraps client so every command is counted.
+func (m *Metrics) InstrumentRCON(client rcon.Client) rcon.Client {
+	return &instrumentedRCON{next: client, m: m}
+}
+
+func (c *instrumentedRCON) Execute(ctx context.Context, address, password, command string) (string, error) {
+	resp, err := c.next.Execute(ctx, address, password, command)
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	c.m.RCONRequests.Inc(address, outcome)
+	return resp, err
+}
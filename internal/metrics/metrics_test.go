@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/poller"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A counter.", "kind")
+	g := r.NewGaugeVec("test_gauge", "A gauge.")
+	h := r.NewHistogramVec("test_seconds", "A histogram.", []float64{1, 5}, "op")
+
+	c.Inc("a")
+	c.Add(2, `we"ird`)
+	g.Set(3)
+	h.Observe(0.5, "x")
+	h.Observe(3, "x")
+	h.Observe(10, "x")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_total counter",
+		`test_total{kind="a"} 1`,
+		`test_total{kind="we\"ird"} 2`,
+		"# TYPE test_gauge gauge",
+		"test_gauge 3",
+		`test_seconds_bucket{op="x",le="1"} 1`,
+		`test_seconds_bucket{op="x",le="5"} 2`,
+		`test_seconds_bucket{op="x",le="+Inf"} 3`,
+		`test_seconds_sum{op="x"} 13.5`,
+		`test_seconds_count{op="x"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRegistry_WriteTextFormat(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Counts \\ things.\nTwo lines.", "path", "kind")
+	r.NewGaugeVec("test_empty", "Never set.", "server")
+	g := r.NewGaugeVec("test_gauge", "A gauge.", "server")
+
+	c.Inc(`C:\scripts\tf2.sh`, "a")
+	c.Inc("line\nbreak", `say "hi"`)
+	g.Set(1, "tf2")
+	g.Set(2, "rust")
+	g.Delete("rust")
+	g.Value("l4d2")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_total Counts \\ things.\nTwo lines.
+# TYPE test_total counter
+test_total{path="C:\\scripts\\tf2.sh",kind="a"} 1
+test_total{path="line\nbreak",kind="say \"hi\""} 1
+# HELP test_empty Never set.
+# TYPE test_empty gauge
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge{server="tf2"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetrics_Observe(t *testing.T) {
+	m := New()
+	m.Observe(context.Background(), []poller.Sample{
+		{Key: "tf2", Status: &query.ServerStatus{Online: true, Players: 12, MaxPlayers: 24, Latency: 20 * time.Millisecond}},
+		{Key: "l4d2", Status: &query.ServerStatus{Online: false}},
+	})
+
+	if got := m.ServerPlayers.Value("tf2"); got != 12 {
+		t.Errorf("tf2 players = %v, want 12", got)
+	}
+	if got := m.ServerUp.Value("tf2"); got != 1 {
+		t.Errorf("tf2 up = %v, want 1", got)
+	}
+	if got := m.ServerUp.Value("l4d2"); got != 0 {
+		t.Errorf("l4d2 up = %v, want 0", got)
+	}
+
+	// Once tf2 goes offline, the figures only an answer provides are gone.
+	m.Observe(context.Background(), []poller.Sample{{Key: "tf2", Status: &query.ServerStatus{Online: false}}})
+	var buf bytes.Buffer
+	m.Registry.WriteText(&buf)
+	for _, stale := range []string{`ned_server_max_players{server="tf2"}`, `ned_server_query_latency_seconds{server="tf2"}`} {
+		if strings.Contains(buf.String(), stale) {
+			t.Errorf("offline tf2 still exports %s:\n%s", stale, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), `ned_server_up{server="tf2"} 0`) {
+		t.Errorf("tf2 is not reported down:\n%s", buf.String())
+	}
+}
+
+type fakeExecutor struct {
+	result *executor.Result
+}
+
+func (f *fakeExecutor) Run(context.Context, string, string, map[string]string) (*executor.Result, error) {
+	return f.result, nil
+}
+
+func TestInstrumentExecutor(t *testing.T) {
+	m := New()
+	exec := m.InstrumentExecutor(&fakeExecutor{result: &executor.Result{ExitCode: 1, Duration: 2 * time.Second}})
+
+	if _, err := exec.Run(context.Background(), "tf2/tf2.sh", "up", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.ScriptRuns.Value("tf2/tf2.sh", "up", "exit_nonzero"); got != 1 {
+		t.Errorf("script runs = %v, want 1", got)
+	}
+
+	var buf bytes.Buffer
+	m.Registry.WriteText(&buf)
+	if !strings.Contains(buf.String(), `ned_script_duration_seconds_sum{script="tf2/tf2.sh",action="up"} 2`) {
+		t.Errorf("duration not recorded:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,319 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metric families and renders them in the Prometheus text
+// exposition format (version 0.0.4).
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteText writes every registered family to w.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// vec stores one value per label combination.
+type vec[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*T
+	keys   map[string][]string
+}
+
+func newVec[T any](name, help, typ string, labels []string) *vec[T] {
+	return &vec[T]{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		values: make(map[string]*T),
+		keys:   make(map[string][]string),
+	}
+}
+
+// get returns the value for labelValues, creating it with init if needed.
+// Callers must hold v.mu.
+func (v *vec[T]) get(labelValues []string, init func() *T) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	val, ok := v.values[key]
+	if !ok {
+		val = init()
+		v.values[key] = val
+		v.keys[key] = append([]string(nil), labelValues...)
+	}
+	return val
+}
+
+// lookup returns the value for labelValues without creating it. Callers
+// must hold v.mu.
+func (v *vec[T]) lookup(labelValues []string) (*T, bool) {
+	val, ok := v.values[strings.Join(labelValues, "\xff")]
+	return val, ok
+}
+
+func (v *vec[T]) delete(labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	delete(v.values, key)
+	delete(v.keys, key)
+}
+
+// sortedKeys returns the value keys in a stable order. Callers must hold v.mu.
+func (v *vec[T]) sortedKeys() []string {
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec[T]) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.typ)
+}
+
+// labelString renders {a="x",b="y"} plus any extra pairs (e.g. le).
+func (v *vec[T]) labelString(key string, extra ...string) string {
+	values := v.keys[key]
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	n := 0
+	write := func(name, value string) {
+		if n > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(value))
+		sb.WriteByte('"')
+		n++
+	}
+	for i, name := range v.labels {
+		write(name, values[i])
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		write(extra[i], extra[i+1])
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// escapeLabel escapes a label value: backslash, double quote and line feed.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// escapeHelp escapes HELP text, where only backslash and line feed are
+// special.
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// CounterVec is a monotonically increasing value per label combination.
+type CounterVec struct {
+	v *vec[float64]
+}
+
+// NewCounterVec registers a counter family.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: newVec[float64](name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Inc adds 1 to the counter for labelValues.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta (which must be non-negative) to the counter for labelValues.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	*c.v.get(labelValues, func() *float64 { return new(float64) }) += delta
+}
+
+// Value returns the current counter value for labelValues, or 0 if it has
+// none. Reading a value does not create its series.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	if val, ok := c.v.lookup(labelValues); ok {
+		return *val
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.header(w)
+	for _, key := range c.v.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.v.name, c.v.labelString(key), formatFloat(*c.v.values[key]))
+	}
+}
+
+// GaugeVec is a value that can go up and down per label combination.
+type GaugeVec struct {
+	v *vec[float64]
+}
+
+// NewGaugeVec registers a gauge family.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec[float64](name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge for labelValues.
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	*g.v.get(labelValues, func() *float64 { return new(float64) }) = value
+}
+
+// Value returns the current gauge value for labelValues, or 0 if it has
+// none. Reading a value does not create its series.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	if val, ok := g.v.lookup(labelValues); ok {
+		return *val
+	}
+	return 0
+}
+
+// Delete removes the series for labelValues.
+func (g *GaugeVec) Delete(labelValues ...string) {
+	g.v.delete(labelValues)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.header(w)
+	for _, key := range g.v.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.v.name, g.v.labelString(key), formatFloat(*g.v.values[key]))
+	}
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations into fixed buckets per label combination.
+type HistogramVec struct {
+	v       *vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bounds.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &HistogramVec{v: newVec[histogram](name, help, "histogram", labels), buckets: b}
+	r.register(h)
+	return h
+}
+
+// Observe records value for labelValues.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	hist := h.v.get(labelValues, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	})
+	for i, upper := range h.buckets {
+		if value <= upper {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.count++
+	hist.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	h.v.header(w)
+	for _, key := range h.v.sortedKeys() {
+		hist := h.v.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name, h.v.labelString(key, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name, h.v.labelString(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.v.name, h.v.labelString(key), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.v.name, h.v.labelString(key), hist.count)
+	}
+}
@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/netwarlan/ned/internal/config"
+)
+
+// rule is a compiled config.RCONRule.
+type rule struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+func (r *rule) permits(command string) bool {
+	allowed := false
+	for _, re := range r.allow {
+		if re.MatchString(command) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, re := range r.deny {
+		if re.MatchString(command) {
+			return false
+		}
+	}
+	return true
+}
+
+// RCONPolicy decides which RCON commands a set of Ned roles may send to a server.
+type RCONPolicy struct {
+	defaults map[string]*rule
+	servers  map[string]map[string]*rule // server glob → role → rule
+	globs    []string                    // sorted keys of servers
+}
+
+// DeniedError is returned by Check when a command is not permitted.
+type DeniedError struct {
+	Server  string
+	Command string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("`%s` is not permitted on %s for your roles", e.Command, e.Server)
+}
+
+// NewRCONPolicy compiles the configured rules.
+func NewRCONPolicy(cfg config.RCONPolicyConfig) (*RCONPolicy, error) {
+	p := &RCONPolicy{
+		defaults: make(map[string]*rule),
+		servers:  make(map[string]map[string]*rule),
+	}
+	for role, r := range cfg.Default {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rcon_policy.default.%s: %w", role, err)
+		}
+		p.defaults[role] = compiled
+	}
+	for glob, roles := range cfg.Servers {
+		p.servers[glob] = make(map[string]*rule)
+		p.globs = append(p.globs, glob)
+		for role, r := range roles {
+			compiled, err := compile(r)
+			if err != nil {
+				return nil, fmt.Errorf("rcon_policy.servers.%s.%s: %w", glob, role, err)
+			}
+			p.servers[glob][role] = compiled
+		}
+	}
+	sort.Strings(p.globs)
+	return p, nil
+}
+
+func compile(r config.RCONRule) (*rule, error) {
+	out := &rule{}
+	for _, pattern := range r.Allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		out.allow = append(out.allow, re)
+	}
+	for _, pattern := range r.Deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		out.deny = append(out.deny, re)
+	}
+	return out, nil
+}
+
+// Enabled reports whether any rules are configured. Without rules every
+// command is allowed, matching the behaviour before policies existed.
+func (p *RCONPolicy) Enabled() bool {
+	return len(p.defaults) > 0 || len(p.servers) > 0
+}
+
+// Check returns a *DeniedError unless at least one of roles may send command
+// to server. Source engines run ";"-separated statements individually, so
+// every statement must be permitted on its own.
+func (p *RCONPolicy) Check(server string, roles []string, command string) error {
+	if !p.Enabled() {
+		return nil
+	}
+	for _, stmt := range splitStatements(command) {
+		if !p.permits(server, roles, stmt) {
+			return &DeniedError{Server: server, Command: stmt}
+		}
+	}
+	return nil
+}
+
+func (p *RCONPolicy) permits(server string, roles []string, stmt string) bool {
+	for _, role := range roles {
+		r := p.ruleFor(server, role)
+		if r != nil && r.permits(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFor picks the first server glob (in sorted order) that matches server
+// and defines role, falling back to the default rule for role.
+func (p *RCONPolicy) ruleFor(server, role string) *rule {
+	for _, glob := range p.globs {
+		if ok, _ := path.Match(glob, server); !ok {
+			continue
+		}
+		if r, ok := p.servers[glob][role]; ok {
+			return r
+		}
+	}
+	return p.defaults[role]
+}
+
+// splitStatements splits an RCON command line into its individual statements.
+func splitStatements(command string) []string {
+	var stmts []string
+	for _, part := range strings.FieldsFunc(command, func(r rune) bool { return r == ';' || r == '\n' || r == '\r' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			stmts = append(stmts, part)
+		}
+	}
+	if len(stmts) == 0 {
+		stmts = []string{strings.TrimSpace(command)}
+	}
+	return stmts
+}
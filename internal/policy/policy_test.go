@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/netwarlan/ned/internal/config"
+)
+
+func testPolicy(t *testing.T) *RCONPolicy {
+	t.Helper()
+	p, err := NewRCONPolicy(config.RCONPolicyConfig{
+		Default: map[string]config.RCONRule{
+			"volunteer": {Allow: []string{`^say\s`, `^changelevel\s`, `^mp_`, `^status$`}},
+			"admin":     {Allow: []string{`.*`}},
+		},
+		Servers: map[string]map[string]config.RCONRule{
+			"match-pro-*": {
+				"volunteer": {Allow: []string{`^say\s`, `^status$`}},
+			},
+			"rust": {
+				"admin": {Allow: []string{`.*`}, Deny: []string{`^quit$`}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRCONPolicy_Check(t *testing.T) {
+	p := testPolicy(t)
+
+	tests := []struct {
+		server  string
+		roles   []string
+		command string
+		allowed bool
+	}{
+		{"cs2-casual", []string{"volunteer"}, "say Dinner is served", true},
+		{"cs2-casual", []string{"volunteer"}, "mp_restartgame 1", true},
+		{"cs2-casual", []string{"volunteer"}, "status", true},
+		{"cs2-casual", []string{"volunteer"}, "quit", false},
+		{"cs2-casual", []string{"volunteer"}, "rcon_password x", false},
+		{"cs2-casual", []string{"volunteer"}, "say hi; quit", false},
+		{"cs2-casual", []string{"volunteer", "admin"}, "quit", true},
+		{"cs2-casual", nil, "status", false},
+		{"match-pro-3", []string{"volunteer"}, "changelevel de_dust2", false},
+		{"match-pro-3", []string{"volunteer"}, "say gl hf", true},
+		{"rust", []string{"admin"}, "quit", false},
+		{"rust", []string{"admin"}, "save", true},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.server, tt.roles, tt.command)
+		if tt.allowed && err != nil {
+			t.Errorf("Check(%q, %v, %q) = %v, want allowed", tt.server, tt.roles, tt.command, err)
+		}
+		if !tt.allowed {
+			var denied *DeniedError
+			if !errors.As(err, &denied) {
+				t.Errorf("Check(%q, %v, %q) = %v, want DeniedError", tt.server, tt.roles, tt.command, err)
+			}
+		}
+	}
+}
+
+func TestRCONPolicy_EmptyAllowsAll(t *testing.T) {
+	p, err := NewRCONPolicy(config.RCONPolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check("cs2-casual", nil, "quit"); err != nil {
+		t.Errorf("empty policy denied command: %v", err)
+	}
+}
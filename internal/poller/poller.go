@@ -0,0 +1,120 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+// Sample is the result of querying one server during a poll.
+type Sample struct {
+	Key     string
+	Address string
+	Time    time.Time
+	Status  *query.ServerStatus // never nil; Online is false when unreachable
+
+	// Players is the connected player list of an online server. When
+	// PlayersErr is set the list is unknown rather than empty.
+	Players    []query.PlayerInfo
+	PlayersErr error
+}
+
+// Observer receives every completed poll.
+type Observer interface {
+	Observe(ctx context.Context, samples []Sample)
+}
+
+// Poller periodically queries every A2S-queryable server (including match
+// instances) and hands the results to its observers.
+type Poller struct {
+	cfg      *config.Config
+	querier  query.Querier
+	interval time.Duration
+
+	mu        sync.Mutex
+	observers []Observer
+}
+
+// New creates a Poller that queries every interval.
+func New(cfg *config.Config, querier query.Querier, interval time.Duration) *Poller {
+	return &Poller{cfg: cfg, querier: querier, interval: interval}
+}
+
+// Add registers an observer. It must be called before Run.
+func (p *Poller) Add(o Observer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.observers = append(p.observers, o)
+}
+
+// Run polls immediately and then every interval until ctx is cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.notify(ctx, p.Poll(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll queries every target once, in parallel.
+func (p *Poller) Poll(ctx context.Context) []Sample {
+	targets := p.cfg.AllQueryTargets()
+
+	var (
+		mu      sync.Mutex
+		samples = make([]Sample, 0, len(targets))
+		wg      sync.WaitGroup
+	)
+	for key, addr := range targets {
+		wg.Add(1)
+		go func(key, addr string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			sample := Sample{Key: key, Address: addr, Time: time.Now()}
+			status, err := p.querier.QueryStatus(ctx, addr)
+			if err != nil || status == nil {
+				status = &query.ServerStatus{Online: false}
+			}
+			sample.Status = status
+			if status.Online && status.Players > 0 {
+				sample.Players, sample.PlayersErr = p.querier.QueryPlayers(ctx, addr)
+			}
+			mu.Lock()
+			samples = append(samples, sample)
+			mu.Unlock()
+		}(key, addr)
+	}
+	wg.Wait()
+	return samples
+}
+
+func (p *Poller) notify(ctx context.Context, samples []Sample) {
+	if ctx.Err() != nil {
+		return
+	}
+	p.mu.Lock()
+	observers := append([]Observer(nil), p.observers...)
+	p.mu.Unlock()
+
+	for _, o := range observers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("poll observer panicked", "panic", r)
+				}
+			}()
+			o.Observe(ctx, samples)
+		}()
+	}
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is a Querier that shares results for ttl, so everyone asking for
+// the status board within a few seconds costs one round of queries.
+// Concurrent queries of the same address wait for a single one.
+type Cache struct {
+	querier Querier
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	address string
+	players bool
+}
+
+type cacheEntry struct {
+	done    chan struct{} // closed once the query finishes
+	at      time.Time
+	status  *ServerStatus
+	players []PlayerInfo
+	err     error
+}
+
+// NewCache wraps querier with a cache that keeps results for ttl.
+func NewCache(querier Querier, ttl time.Duration) *Cache {
+	return &Cache{querier: querier, ttl: ttl, now: time.Now, entries: map[cacheKey]*cacheEntry{}}
+}
+
+func (c *Cache) QueryStatus(ctx context.Context, address string) (*ServerStatus, error) {
+	e, err := c.get(ctx, cacheKey{address: address}, func(ctx context.Context, e *cacheEntry) {
+		e.status, e.err = c.querier.QueryStatus(ctx, address)
+	})
+	if err != nil {
+		return &ServerStatus{Online: false}, err
+	}
+	if e.status == nil {
+		return nil, e.err
+	}
+	status := *e.status
+	return &status, e.err
+}
+
+func (c *Cache) QueryPlayers(ctx context.Context, address string) ([]PlayerInfo, error) {
+	e, err := c.get(ctx, cacheKey{address: address, players: true}, func(ctx context.Context, e *cacheEntry) {
+		e.players, e.err = c.querier.QueryPlayers(ctx, address)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]PlayerInfo(nil), e.players...), e.err
+}
+
+// get returns the cached entry for key, running query to fill it in if
+// there is none or it has expired. It returns ctx's error if ctx ends while
+// waiting.
+func (c *Cache) get(ctx context.Context, key cacheKey, query func(context.Context, *cacheEntry)) (*cacheEntry, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		select {
+		case <-e.done:
+			if c.now().Sub(e.at) >= c.ttl {
+				ok = false
+			}
+		default: // in flight
+		}
+	}
+	if !ok {
+		e = &cacheEntry{done: make(chan struct{})}
+		c.entries[key] = e
+		// The query outlives a caller that gives up, so the others waiting
+		// on it still get an answer; the querier's own timeouts bound it.
+		go c.fill(context.WithoutCancel(ctx), e, query)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return e, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache) fill(ctx context.Context, e *cacheEntry, query func(context.Context, *cacheEntry)) {
+	query(ctx, e)
+	c.mu.Lock()
+	e.at = c.now()
+	close(e.done)
+	c.mu.Unlock()
+}
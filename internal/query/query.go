@@ -2,28 +2,88 @@ package query
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"syscall"
 	"time"
 
+	"github.com/netwarlan/ned/internal/logging"
 	"github.com/rumblefrog/go-a2s"
 )
 
 // ServerStatus represents the queried state of a game server.
 type ServerStatus struct {
-	Online     bool
-	Name       string
-	Map        string
-	Players    int
-	MaxPlayers int
-	Bots       int
-	Latency    time.Duration
+	Online     bool          `json:"online"`
+	Name       string        `json:"name,omitempty"`
+	Map        string        `json:"map,omitempty"`
+	Players    int           `json:"players"`
+	MaxPlayers int           `json:"max_players"`
+	Bots       int           `json:"bots"`
+	Latency    time.Duration `json:"latency_ns,omitempty"`
+	Failure    Failure       `json:"failure,omitempty"` // why the server is not online
+}
+
+// Failure is why a query got no usable answer.
+type Failure string
+
+const (
+	FailTimeout     Failure = "timeout"      // no reply: down, still starting, or unreachable
+	FailRefused     Failure = "refused"      // the host is up but nothing listens on the port
+	FailBadResponse Failure = "bad_response" // something answered, but not with valid A2S
+	FailError       Failure = "error"        // anything else, e.g. an unresolvable host
+)
+
+// Describe says how a server whose query failed this way is shown, e.g.
+// "Offline (refused)".
+func (f Failure) Describe() string {
+	switch f {
+	case FailTimeout:
+		return "Offline (no reply)"
+	case FailRefused:
+		return "Offline (refused)"
+	case FailBadResponse:
+		return "Offline (bad response)"
+	case FailError:
+		return "Offline (query failed)"
+	}
+	return "Offline"
+}
+
+// Error is a failed query.
+type Error struct {
+	Failure Failure
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Failure, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// classify works out why a query failed.
+func classify(err error) Failure {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FailTimeout
+	case errors.Is(err, a2s.ErrBadPacketHeader), errors.Is(err, a2s.ErrUnsupportedHeader),
+		errors.Is(err, a2s.ErrBadChallengeResponse), errors.Is(err, a2s.ErrBadPlayerReply):
+		return FailBadResponse
+	}
+	return FailError
 }
 
 // PlayerInfo represents a single connected player.
 type PlayerInfo struct {
-	Name     string
-	Score    int
-	Duration time.Duration
+	Name     string        `json:"name"`
+	Score    int           `json:"score"`
+	Duration time.Duration `json:"duration_ns"`
 }
 
 // Querier defines the interface for querying game server status.
@@ -32,30 +92,42 @@ type Querier interface {
 	QueryPlayers(ctx context.Context, address string) ([]PlayerInfo, error)
 }
 
-// A2SQuerier implements Querier using the A2S protocol.
+// A2SQuerier implements Querier using the A2S protocol. A query that gets
+// no reply, e.g. because a UDP packet was lost, is retried with backoff;
+// one that is refused or answered badly is not.
 type A2SQuerier struct {
-	timeout time.Duration
+	timeout  time.Duration // per attempt
+	attempts int
+	backoff  time.Duration // before the second attempt, doubling after
 }
 
-// NewA2SQuerier creates a new A2S querier with the specified timeout.
+// NewA2SQuerier creates a new A2S querier that waits up to timeout for each
+// of its three attempts.
 func NewA2SQuerier(timeout time.Duration) *A2SQuerier {
-	return &A2SQuerier{timeout: timeout}
+	return &A2SQuerier{timeout: timeout, attempts: 3, backoff: 100 * time.Millisecond}
 }
 
+// QueryStatus reports whether the server at address is online and what it
+// is running. A server that does not answer is reported offline, with the
+// reason in Failure, rather than as an error.
 func (q *A2SQuerier) QueryStatus(ctx context.Context, address string) (*ServerStatus, error) {
-	client, err := a2s.NewClient(address, a2s.TimeoutOption(q.timeout))
-	if err != nil {
-		return &ServerStatus{Online: false}, fmt.Errorf("creating A2S client: %w", err)
-	}
-	defer client.Close()
-
+	var info *a2s.ServerInfo
 	start := time.Now()
-	info, err := client.QueryInfo()
+	err := q.do(ctx, address, func(client *a2s.Client) (err error) {
+		start = time.Now()
+		info, err = client.QueryInfo()
+		return err
+	})
 	latency := time.Since(start)
 
 	if err != nil {
-		return &ServerStatus{Online: false}, nil
+		if ctx.Err() != nil {
+			return &ServerStatus{Online: false}, ctx.Err()
+		}
+		logging.FromContext(ctx).Debug("a2s query failed", "address", address, "duration", latency, "err", err)
+		return &ServerStatus{Online: false, Failure: classify(err)}, nil
 	}
+	logging.FromContext(ctx).Debug("a2s query", "address", address, "latency", latency, "players", info.Players)
 
 	return &ServerStatus{
 		Online:     true,
@@ -68,16 +140,19 @@ func (q *A2SQuerier) QueryStatus(ctx context.Context, address string) (*ServerSt
 	}, nil
 }
 
+// QueryPlayers lists the players on the server at address. A failed query
+// is an *Error, unless ctx ended first.
 func (q *A2SQuerier) QueryPlayers(ctx context.Context, address string) ([]PlayerInfo, error) {
-	client, err := a2s.NewClient(address, a2s.TimeoutOption(q.timeout))
+	var players *a2s.PlayerInfo
+	err := q.do(ctx, address, func(client *a2s.Client) (err error) {
+		players, err = client.QueryPlayer()
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("creating A2S client: %w", err)
-	}
-	defer client.Close()
-
-	players, err := client.QueryPlayer()
-	if err != nil {
-		return nil, fmt.Errorf("querying players: %w", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &Error{Failure: classify(err), Err: fmt.Errorf("querying players: %w", err)}
 	}
 
 	result := make([]PlayerInfo, 0, len(players.Players))
@@ -90,3 +165,58 @@ func (q *A2SQuerier) QueryPlayers(ctx context.Context, address string) ([]Player
 	}
 	return result, nil
 }
+
+// do runs query on a fresh client, retrying with backoff while it times
+// out, until it succeeds, fails some other way, runs out of attempts, or
+// ctx ends.
+func (q *A2SQuerier) do(ctx context.Context, address string, query func(*a2s.Client) error) error {
+	backoff := q.backoff
+	for attempt := 1; ; attempt++ {
+		err := q.attempt(ctx, address, query)
+		if err == nil || attempt >= q.attempts || classify(err) != FailTimeout || ctx.Err() != nil {
+			return err
+		}
+		logging.FromContext(ctx).Debug("a2s query timed out, retrying", "address", address, "attempt", attempt)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt runs query once. The client is closed if ctx ends first, which
+// aborts the query.
+func (q *A2SQuerier) attempt(ctx context.Context, address string, query func(*a2s.Client) error) error {
+	timeout := q.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if timeout <= 0 {
+		return context.DeadlineExceeded
+	}
+
+	client, err := a2s.NewClient(address, a2s.TimeoutOption(timeout))
+	if err != nil {
+		return fmt.Errorf("creating A2S client: %w", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		client.Close()
+	}()
+
+	if err := query(client); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
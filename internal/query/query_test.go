@@ -0,0 +1,146 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/simulator"
+)
+
+func startSim(t *testing.T) *simulator.Server {
+	t.Helper()
+	s, err := simulator.Start(simulator.Options{Name: "Sim", Map: "ctf_2fort", Challenge: true,
+		Players: []simulator.Player{{Name: "alice"}}}, "127.0.0.1:0", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestA2SQuerier_RetriesLostPackets(t *testing.T) {
+	s := startSim(t)
+	q := NewA2SQuerier(100 * time.Millisecond)
+
+	// Dropping the challenge reply and then the answer costs two attempts.
+	s.DropNext(2)
+	status, err := q.QueryStatus(context.Background(), s.QueryAddr())
+	if err != nil || !status.Online || status.Map != "ctf_2fort" {
+		t.Errorf("status = %+v, %v", status, err)
+	}
+
+	s.DropNext(1)
+	if players, err := q.QueryPlayers(context.Background(), s.QueryAddr()); err != nil || len(players) != 1 {
+		t.Errorf("players = %+v, %v", players, err)
+	}
+}
+
+func TestA2SQuerier_Failures(t *testing.T) {
+	s := startSim(t)
+	q := NewA2SQuerier(100 * time.Millisecond)
+
+	s.SetFault(simulator.BadResponse)
+	_, err := q.QueryPlayers(context.Background(), s.QueryAddr())
+	var qerr *Error
+	if !errors.As(err, &qerr) || qerr.Failure != FailBadResponse {
+		t.Errorf("bad response: err = %v", err)
+	}
+
+	s.Close()
+	if status, err := q.QueryStatus(context.Background(), s.QueryAddr()); err != nil || status.Failure != FailRefused {
+		t.Errorf("closed server: status = %+v, %v", status, err)
+	}
+	if status, _ := q.QueryStatus(context.Background(), "nonexistent.invalid:27015"); status.Failure != FailError {
+		t.Errorf("unresolvable host: status = %+v", status)
+	}
+}
+
+func TestA2SQuerier_RespectsContext(t *testing.T) {
+	s := startSim(t)
+	s.SetFault(simulator.Unresponsive)
+	q := NewA2SQuerier(5 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := q.QueryStatus(ctx, s.QueryAddr())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("query took %s despite the context", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := q.QueryPlayers(ctx, s.QueryAddr()); !errors.Is(err, context.Canceled) {
+		t.Errorf("players err = %v, want context.Canceled", err)
+	}
+}
+
+// countingQuerier counts queries and answers them after delay.
+type countingQuerier struct {
+	calls atomic.Int32
+	delay time.Duration
+}
+
+func (q *countingQuerier) QueryStatus(context.Context, string) (*ServerStatus, error) {
+	q.calls.Add(1)
+	time.Sleep(q.delay)
+	return &ServerStatus{Online: true, Players: int(q.calls.Load())}, nil
+}
+
+func (q *countingQuerier) QueryPlayers(context.Context, string) ([]PlayerInfo, error) {
+	q.calls.Add(1)
+	return []PlayerInfo{{Name: "alice"}}, nil
+}
+
+func TestCache(t *testing.T) {
+	inner := &countingQuerier{delay: 50 * time.Millisecond}
+	c := NewCache(inner, 5*time.Second)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Concurrent callers share one query.
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, err := c.QueryStatus(ctx, "a:1"); err != nil || !status.Online {
+				t.Errorf("status = %+v, %v", status, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("%d queries for concurrent callers, want 1", n)
+	}
+
+	// Until the TTL runs out, the result is reused, per address and kind.
+	c.QueryStatus(ctx, "a:1")
+	c.QueryPlayers(ctx, "a:1")
+	c.QueryStatus(ctx, "b:1")
+	if n := inner.calls.Load(); n != 3 {
+		t.Errorf("%d queries, want 3", n)
+	}
+
+	c.mu.Lock()
+	now = now.Add(5 * time.Second)
+	c.mu.Unlock()
+	if status, _ := c.QueryStatus(ctx, "a:1"); status.Players != 4 {
+		t.Errorf("expired entry was reused: %+v", status)
+	}
+
+	// A caller that gives up does not wait for the query.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.QueryStatus(cancelled, "c:1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,22 @@
+package rcon
+
+import (
+	"context"
+
+	"github.com/netwarlan/ned/internal/logging"
+)
+
+// DryRunClient implements Client by logging the commands it is asked to
+// send instead of connecting. Every command succeeds with an empty response.
+type DryRunClient struct{}
+
+// NewDryRunClient creates a DryRunClient.
+func NewDryRunClient() *DryRunClient {
+	return &DryRunClient{}
+}
+
+// Execute logs the target and command, and returns an empty response.
+func (c *DryRunClient) Execute(ctx context.Context, address, password, command string) (string, error) {
+	logging.FromContext(ctx).Info("dry run: would send rcon command", "address", address, "command", command)
+	return "", nil
+}
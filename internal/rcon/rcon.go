@@ -6,6 +6,7 @@ import (
 	"time"
 
 	gorcon "github.com/gorcon/rcon"
+	"github.com/netwarlan/ned/internal/logging"
 )
 
 // Client defines the interface for sending RCON commands.
@@ -27,16 +28,22 @@ func NewGorconClient(timeout time.Duration) *GorconClient {
 // Each call creates a fresh connection — RCON connections are cheap and game servers
 // have limited connection slots.
 func (c *GorconClient) Execute(ctx context.Context, address, password, command string) (string, error) {
+	logger := logging.FromContext(ctx).With("address", address)
+	start := time.Now()
+
 	conn, err := gorcon.Dial(address, password, gorcon.SetDeadline(c.timeout))
 	if err != nil {
+		logger.Warn("rcon connect failed", "duration", time.Since(start), "err", err)
 		return "", fmt.Errorf("connecting to %s: %w", address, err)
 	}
 	defer conn.Close()
 
 	response, err := conn.Execute(command)
 	if err != nil {
+		logger.Warn("rcon command failed", "command", command, "duration", time.Since(start), "err", err)
 		return "", fmt.Errorf("executing command on %s: %w", address, err)
 	}
 
+	logger.Debug("rcon command", "command", command, "duration", time.Since(start))
 	return response, nil
 }
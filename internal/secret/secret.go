@@ -0,0 +1,146 @@
+package secret
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/netwarlan/ned/internal/fsutil"
+)
+
+// Reference prefixes understood by Resolve.
+const (
+	prefixFile   = "file:"
+	prefixEnv    = "env:"
+	prefixSecret = "secret:"
+)
+
+// MinLen is the length of the shortest secret Redact hides. Shorter values
+// (e.g. "1") would redact unrelated text, so config validation rejects them.
+const MinLen = 4
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]struct{})
+)
+
+// IsReference reports whether value uses one of the secret reference prefixes.
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, prefixFile) ||
+		strings.HasPrefix(value, prefixEnv) ||
+		strings.HasPrefix(value, prefixSecret)
+}
+
+// Resolve returns the plaintext for a secret reference:
+//
+//	file:/run/secrets/x   contents of the file, trailing newline trimmed
+//	env:NAME              value of the environment variable NAME
+//	secret:name           entry from the encrypted secrets file
+//
+// Any other value is returned unchanged as a literal. Every resolved value
+// is registered for redaction.
+func Resolve(ref string, store *Store) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(ref, prefixFile):
+		path := strings.TrimPrefix(ref, prefixFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file %s: %w", path, err)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(ref, prefixEnv):
+		name := strings.TrimPrefix(ref, prefixEnv)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		value = v
+	case strings.HasPrefix(ref, prefixSecret):
+		name := strings.TrimPrefix(ref, prefixSecret)
+		if store == nil {
+			return "", fmt.Errorf("secret %q referenced but no secrets.file is configured", name)
+		}
+		v, err := store.Get(name)
+		if err != nil {
+			return "", err
+		}
+		value = v
+	default:
+		value = ref
+	}
+	Register(value)
+	return value, nil
+}
+
+// Register marks value as sensitive so Redact hides it.
+func Register(value string) {
+	if len(value) < MinLen {
+		return
+	}
+	registryMu.Lock()
+	registry[value] = struct{}{}
+	registryMu.Unlock()
+}
+
+// Redact replaces every registered secret in s with "[REDACTED]".
+func Redact(s string) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for value := range registry {
+		if strings.Contains(s, value) {
+			s = strings.ReplaceAll(s, value, "[REDACTED]")
+		}
+	}
+	return s
+}
+
+// redactingWriter redacts secrets from everything written through it.
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter wraps w so registered secrets never reach it, e.g. for
+// log.SetOutput.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Persist writes value back to the location named by ref. Only file: and
+// secret: references are writable; env: and literal values are rejected.
+func Persist(ref, value string, store *Store) error {
+	switch {
+	case strings.HasPrefix(ref, prefixFile):
+		path := strings.TrimPrefix(ref, prefixFile)
+		if err := fsutil.WriteFileAtomic(path, []byte(value+"\n")); err != nil {
+			return fmt.Errorf("writing secret file %s: %w", path, err)
+		}
+	case strings.HasPrefix(ref, prefixSecret):
+		if store == nil {
+			return fmt.Errorf("no secrets.file is configured")
+		}
+		if err := store.Set(strings.TrimPrefix(ref, prefixSecret), value); err != nil {
+			return err
+		}
+	case strings.HasPrefix(ref, prefixEnv):
+		return fmt.Errorf("%s cannot be updated at runtime; use a file: or secret: reference", ref)
+	default:
+		return fmt.Errorf("plaintext values cannot be updated at runtime; use a file: or secret: reference")
+	}
+	Register(value)
+	return nil
+}
+
+// Writable reports whether Persist can update ref.
+func Writable(ref string) bool {
+	return strings.HasPrefix(ref, prefixFile) || strings.HasPrefix(ref, prefixSecret)
+}
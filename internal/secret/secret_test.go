@@ -0,0 +1,153 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rcon")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NED_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"file:" + path, "from-file"},
+		{"env:NED_TEST_SECRET", "from-env"},
+		{"plain-literal", "plain-literal"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.ref, nil)
+		if err != nil {
+			t.Errorf("Resolve(%q) error: %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolve_Errors(t *testing.T) {
+	for _, ref := range []string{"env:NED_TEST_UNSET_SECRET", "file:/nonexistent/secret", "secret:missing"} {
+		if _, err := Resolve(ref, nil); err == nil {
+			t.Errorf("Resolve(%q) expected error", ref)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	Register("hunter22")
+	Register("abc") // too short to register
+
+	got := Redact("rcon_password is hunter22, abc")
+	if strings.Contains(got, "hunter22") {
+		t.Errorf("secret not redacted: %s", got)
+	}
+	if !strings.Contains(got, "abc") {
+		t.Errorf("short value should not be redacted: %s", got)
+	}
+
+	var buf bytes.Buffer
+	w := NewRedactingWriter(&buf)
+	if _, err := w.Write([]byte("dial failed with hunter22")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "hunter22") {
+		t.Errorf("writer leaked secret: %s", buf.String())
+	}
+}
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestStore_RoundTrip(t *testing.T) {
+	key := testKey(t)
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+
+	store, err := OpenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("cs2_rcon", "headshot"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "headshot") {
+		t.Fatalf("secrets file contains plaintext: %s", data)
+	}
+
+	reopened, err := OpenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Resolve("secret:cs2_rcon", reopened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "headshot" {
+		t.Errorf("secret = %q, want %q", got, "headshot")
+	}
+}
+
+func TestStore_WrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	store, err := OpenStore(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("token", "discord-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenStore(path, testKey(t)); err == nil {
+		t.Error("expected error opening store with wrong key")
+	}
+}
+
+func TestStore_SwappedEntriesRejected(t *testing.T) {
+	key := testKey(t)
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	store, err := OpenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("a", "value-a"); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := store.seal("a", "value-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("b: "+enc+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenStore(path, key); err == nil {
+		t.Error("expected error for value sealed under a different name")
+	}
+}
@@ -0,0 +1,199 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/netwarlan/ned/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyEnv is the environment variable that may hold the secrets key
+// (base64-encoded, 32 bytes) instead of a key file.
+const KeyEnv = "NED_SECRETS_KEY"
+
+const (
+	keySize   = 32
+	encPrefix = "ENC[v1,"
+	encSuffix = "]"
+)
+
+// Store is an encrypted secrets file in the style of sops: a YAML map of
+// name → "ENC[v1,<base64>]", where each value is sealed with AES-256-GCM
+// and bound to its name as associated data so entries cannot be swapped.
+type Store struct {
+	path string
+	aead cipher.AEAD
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// GenerateKey returns a new random key, base64-encoded for a key file or
+// the NED_SECRETS_KEY variable.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generating key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadKey reads the secrets key from keyFile, or from NED_SECRETS_KEY when
+// keyFile is empty.
+func LoadKey(keyFile string) ([]byte, error) {
+	encoded := os.Getenv(KeyEnv)
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading secrets key: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("no secrets key: set secrets.key_file or %s", KeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decoding secrets key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+// OpenStore decrypts the secrets file at path. A missing file is treated as
+// an empty store so Set can create it.
+func OpenStore(path string, key []byte) (*Store, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	s := &Store{path: path, aead: aead, values: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
+	}
+
+	var raw map[string]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	for name, enc := range raw {
+		value, err := s.open(name, enc)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", name, err)
+		}
+		s.values[name] = value
+		Register(value)
+	}
+	return s, nil
+}
+
+// Get returns the decrypted value of name.
+func (s *Store) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found in %s", name, s.path)
+	}
+	return value, nil
+}
+
+// Names returns the sorted names of all stored secrets.
+func (s *Store) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set stores value under name and rewrites the file atomically.
+func (s *Store) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, had := s.values[name]
+	s.values[name] = value
+	if err := s.save(); err != nil {
+		if had {
+			s.values[name] = prev
+		} else {
+			delete(s.values, name)
+		}
+		return err
+	}
+	Register(value)
+	return nil
+}
+
+func (s *Store) save() error {
+	raw := make(map[string]string, len(s.values))
+	for name, value := range s.values {
+		enc, err := s.seal(name, value)
+		if err != nil {
+			return err
+		}
+		raw[name] = enc
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("encoding secrets file: %w", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) seal(name, value string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed) + encSuffix, nil
+}
+
+func (s *Store) open(name, enc string) (string, error) {
+	if !strings.HasPrefix(enc, encPrefix) || !strings.HasSuffix(enc, encSuffix) {
+		return "", fmt.Errorf("value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(enc, encPrefix), encSuffix))
+	if err != nil {
+		return "", fmt.Errorf("decoding value: %w", err)
+	}
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return "", fmt.Errorf("value too short")
+	}
+	plain, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("decrypting value (wrong key?)")
+	}
+	return string(plain), nil
+}
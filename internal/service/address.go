@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+// probeTimeout bounds the TCP probe of a server that does not answer A2S.
+const probeTimeout = 2 * time.Second
+
+// checkConflicts refuses to start a server while another that must not run
+// alongside it (see config.StartConflicts) is online, or might be: under
+// MAC VLAN one of two servers sharing an IP silently loses its network. A
+// server whose state cannot be checked, e.g. one that only listens on UDP
+// and does not speak A2S, blocks the start as well.
+func (s *Service) checkConflicts(ctx context.Context, key string) error {
+	srv := s.cfg.Servers[key]
+	unknown := ""
+	for _, peer := range s.cfg.StartConflicts(key) {
+		online, known := s.probeOnline(ctx, peer)
+		switch {
+		case online:
+			logging.FromContext(ctx).Warn("refusing to start over an online server", "server", key, "peer", peer, "ip", srv.IP)
+			return newError(KindBusy, "%s, which is online; stop it first, or use force to start anyway", s.conflictWith(key, peer))
+		case !known && unknown == "":
+			unknown = peer
+		}
+	}
+	if unknown != "" {
+		logging.FromContext(ctx).Warn("refusing to start over a server in an unknown state", "server", key, "peer", unknown, "ip", srv.IP)
+		return newError(KindBusy, "%s, which Ned cannot check; make sure it is stopped, then use force to start anyway", s.conflictWith(key, unknown))
+	}
+	return nil
+}
+
+// conflictWith says why key cannot run alongside peer.
+func (s *Service) conflictWith(key, peer string) string {
+	srv := s.cfg.Servers[key]
+	if slices.Contains(s.cfg.AddressPeers(key), peer) {
+		return srv.DisplayName + " shares " + srv.IP + " with " + s.cfg.DisplayName(peer)
+	}
+	return srv.DisplayName + " conflicts with " + s.cfg.DisplayName(peer)
+}
+
+// probeOnline reports whether a server is running, and whether that could
+// be told at all. A server that speaks A2S is online if it answers and
+// offline if it times out or is refused. Otherwise its TCP RCON port is
+// tried, where a refused connection means offline, and then its game port,
+// which only proves it online: the port may be UDP.
+func (s *Service) probeOnline(ctx context.Context, key string) (online, known bool) {
+	srv := s.cfg.Servers[key]
+	if srv.Protocol == "source" && srv.QueryPort > 0 {
+		return knownState(s.queryStatus(ctx, net.JoinHostPort(srv.IP, strconv.Itoa(srv.QueryPort))))
+	}
+	if srv.RCONPort > 0 {
+		switch err := s.dial(ctx, srv.IP, srv.RCONPort); {
+		case err == nil:
+			return true, true
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return false, true
+		}
+	}
+	if srv.Port > 0 && s.dial(ctx, srv.IP, srv.Port) == nil {
+		return true, true
+	}
+	return false, false
+}
+
+// knownState reads an A2S status as probeOnline does: a server that
+// answers is online, one that times out or is refused is offline, and
+// anything else says nothing either way.
+func knownState(status *query.ServerStatus) (online, known bool) {
+	switch status.Failure {
+	case "", query.FailTimeout, query.FailRefused:
+		return status.Online, true
+	}
+	return false, false
+}
+
+// probeState is what probeOnline found out about a server.
+type probeState struct {
+	online, known bool
+}
+
+// probeAll probes every server at once with probeOnline.
+func (s *Service) probeAll(ctx context.Context) map[string]probeState {
+	var (
+		mu     sync.Mutex
+		states = make(map[string]probeState, len(s.cfg.Servers))
+		wg     sync.WaitGroup
+	)
+	for key := range s.cfg.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			online, known := s.probeOnline(logging.With(ctx, "server", key), key)
+			mu.Lock()
+			states[key] = probeState{online: online, known: known}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return states
+}
+
+// dial opens and closes a TCP connection to ip:port.
+func (s *Service) dial(ctx context.Context, ip string, port int) error {
+	d := net.Dialer{Timeout: probeTimeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxConcurrentLifecycle caps how many servers a bulk operation manages at
+// once, so an event's worth of servers does not start on one host at the
+// same moment.
+const maxConcurrentLifecycle = 4
+
+// CategoryInfra is the category that an ordered bulk operation starts
+// before, and stops after, every other server.
+const CategoryInfra = "infra"
+
+// BulkResult is the outcome of one server's action in a bulk operation.
+type BulkResult struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	ExitCode int    `json:"exit_code"`
+	Duration string `json:"duration,omitempty"`
+	Err      string `json:"error,omitempty"`
+}
+
+// Failed reports whether the action did not complete.
+func (r BulkResult) Failed() bool {
+	return r.Err != "" || r.ExitCode != 0
+}
+
+// BulkLifecycle runs a lifecycle action on every server target covers:
+// TargetAll or a category. Servers run at most maxConcurrentLifecycle at a
+// time, each under its own lock, so a server busy with another command is
+// reported rather than waited for. With ordered, infra servers are started
+// first and stopped last, and a server is started after the servers it
+// depends on (see config.StartOrder) and stopped before them, each wave
+// finishing before the next begins. Servers that must not run together
+// (see config.StartConflicts) are never started in the same wave; once one
+// of them has started, the others are skipped. Results are sorted by
+// server key.
+func (s *Service) BulkLifecycle(ctx context.Context, c Caller, target, action string, ordered, force bool) ([]BulkResult, error) {
+	switch action {
+	case ActionStart, ActionStop, ActionRestart:
+	default:
+		return nil, newError(KindInvalid, "Unknown action: %s", action)
+	}
+	keys, err := s.BulkTargetServers(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BulkResult
+	started := map[string]bool{}
+	for _, wave := range s.bulkWaves(keys, action, ordered) {
+		var run []string
+		for _, key := range wave {
+			if other := s.startedConflict(key, started); other != "" {
+				results = append(results, BulkResult{Key: key, Name: s.cfg.DisplayName(key), Action: action,
+					Err: fmt.Sprintf("skipped: %s cannot run alongside %s, which was started", s.cfg.DisplayName(key), s.cfg.DisplayName(other))})
+				continue
+			}
+			run = append(run, key)
+		}
+		for _, r := range s.runBulkWave(ctx, c, run, action, force) {
+			if action != ActionStop && !r.Failed() {
+				started[r.Key] = true
+			}
+			results = append(results, r)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+
+	var failed []string
+	for _, r := range results {
+		if r.Failed() {
+			failed = append(failed, r.Key)
+		}
+	}
+	outcome, detail := outcomeOf(failed, len(results))
+	s.record(c, "bulk "+action, target, detail, outcome)
+	return results, nil
+}
+
+// bulkWaves splits keys into the waves BulkLifecycle runs one after
+// another. Starts and restarts put servers that conflict in separate waves.
+func (s *Service) bulkWaves(keys []string, action string, ordered bool) [][]string {
+	groups := [][]string{keys}
+	if ordered {
+		var infra, rest []string
+		for _, key := range keys {
+			if s.cfg.Servers[key].Category == CategoryInfra {
+				infra = append(infra, key)
+			} else {
+				rest = append(rest, key)
+			}
+		}
+		groups = [][]string{infra, rest}
+	}
+
+	var waves [][]string
+	for _, group := range groups {
+		order := [][]string{group}
+		if ordered {
+			order = s.cfg.StartOrder(group)
+		}
+		for _, wave := range order {
+			if action == ActionStop {
+				waves = append(waves, wave)
+			} else {
+				waves = append(waves, s.separateConflicts(wave)...)
+			}
+		}
+	}
+	if ordered && action == ActionStop {
+		slices.Reverse(waves)
+	}
+	return slices.DeleteFunc(waves, func(wave []string) bool { return len(wave) == 0 })
+}
+
+// separateConflicts splits wave so that no two servers that must not run
+// together share a part, keeping each server in the earliest part it fits.
+func (s *Service) separateConflicts(wave []string) [][]string {
+	var parts [][]string
+	for _, key := range wave {
+		conflicts := s.cfg.StartConflicts(key)
+		i := slices.IndexFunc(parts, func(part []string) bool {
+			return !slices.ContainsFunc(part, func(other string) bool { return slices.Contains(conflicts, other) })
+		})
+		if i < 0 {
+			parts = append(parts, nil)
+			i = len(parts) - 1
+		}
+		parts[i] = append(parts[i], key)
+	}
+	return parts
+}
+
+// startedConflict returns a server in started that key must not run
+// alongside, or "".
+func (s *Service) startedConflict(key string, started map[string]bool) string {
+	for _, other := range s.cfg.StartConflicts(key) {
+		if started[other] {
+			return other
+		}
+	}
+	return ""
+}
+
+// BulkTargetServers returns the sorted keys of the servers target covers:
+// every server for TargetAll, or those in a category.
+func (s *Service) BulkTargetServers(target string) ([]string, error) {
+	var keys []string
+	for _, key := range slices.Sorted(maps.Keys(s.cfg.Servers)) {
+		if target == TargetAll || s.cfg.Servers[key].Category == target {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, newError(KindNotFound, "No servers in %s", target)
+	}
+	return keys, nil
+}
+
+// ServerCategories returns the board categories that contain at least one
+// configured server, in board order.
+func (s *Service) ServerCategories() []string {
+	var cats []string
+	for _, cat := range Categories {
+		for _, srv := range s.cfg.Servers {
+			if srv.Category == cat.Key {
+				cats = append(cats, cat.Key)
+				break
+			}
+		}
+	}
+	return cats
+}
+
+// runBulkWave runs action on keys in parallel, at most
+// maxConcurrentLifecycle at a time, and waits for every script to exit.
+func (s *Service) runBulkWave(ctx context.Context, c Caller, keys []string, action string, force bool) []BulkResult {
+	var (
+		mu      sync.Mutex
+		results []BulkResult
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentLifecycle)
+	)
+
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			r := BulkResult{Key: key, Name: s.cfg.DisplayName(key), Action: action}
+			res, err := s.RunLifecycle(ctx, c, key, action, force)
+			if res != nil {
+				r.ExitCode = res.ExitCode
+				r.Duration = res.Duration.Round(time.Second).String()
+			}
+			if err != nil {
+				r.Err = err.Error()
+				if cause := errors.Unwrap(err); cause != nil {
+					r.Err += ": " + cause.Error()
+				}
+			}
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}(key)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+// drainPoll is how often a draining server is queried for its players.
+const drainPoll = 10 * time.Second
+
+// countdownMarks are the remaining times announced while a server drains,
+// after the full grace period.
+var countdownMarks = []time.Duration{10 * time.Minute, 5 * time.Minute, 2 * time.Minute, time.Minute, 30 * time.Second, 10 * time.Second}
+
+// drain gives the players of a server up to its shutdown_grace to finish
+// before it is stopped. It counts down over RCON and returns early once the
+// server is empty or its map changes. Servers that cannot be queried, are
+// offline or have no players are not waited for. A forced stop of the server
+// ends the drain early (see cutDrain).
+func (s *Service) drain(ctx context.Context, key string, srv config.Server) {
+	grace := srv.ShutdownGrace
+	if grace <= 0 || srv.Protocol != "source" || srv.QueryPort <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.drains.Store(key, cancel)
+	defer s.drains.Delete(key)
+	ctx = logging.With(ctx, "server", key)
+	logger := logging.FromContext(ctx)
+	addr := net.JoinHostPort(srv.IP, strconv.Itoa(srv.QueryPort))
+
+	status := s.queryStatus(ctx, addr)
+	if !status.Online || status.Players == 0 {
+		return
+	}
+	logger.Info("draining before stop", "players", status.Players, "grace", grace)
+	startMap := status.Map
+
+	marks := []time.Duration{grace}
+	for _, m := range countdownMarks {
+		if m < grace {
+			marks = append(marks, m)
+		}
+	}
+
+	deadline := time.Now().Add(grace)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			logger.Info("grace period over, stopping", "players", status.Players)
+			return
+		}
+		if len(marks) > 0 && remaining <= marks[0] {
+			s.announce(ctx, key, srv, fmt.Sprintf("say Server shutting down in %s", spokenDuration(marks[0])))
+			for len(marks) > 0 && remaining <= marks[0] {
+				marks = marks[1:]
+			}
+		}
+
+		wait := min(drainPoll, remaining)
+		if len(marks) > 0 {
+			wait = min(wait, remaining-marks[0])
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		status = s.queryStatus(ctx, addr)
+		switch {
+		case !status.Online || status.Players == 0:
+			logger.Info("server emptied, stopping")
+			return
+		case status.Map != startMap:
+			logger.Info("map ended, stopping", "map", status.Map)
+			return
+		}
+	}
+}
+
+// cutDrain ends the drain of key in progress, if any, so that the stop
+// waiting on it goes ahead at once. It reports whether there was one.
+func (s *Service) cutDrain(key string) bool {
+	cancel, ok := s.drains.LoadAndDelete(key)
+	if ok {
+		cancel.(context.CancelFunc)()
+	}
+	return ok
+}
+
+// queryStatus queries a server once. A query that fails outright, e.g.
+// because ctx ran out, reports it offline with FailError: nothing is known
+// about it, unlike a server that did not answer.
+func (s *Service) queryStatus(ctx context.Context, addr string) *query.ServerStatus {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	status, err := s.querier.QueryStatus(ctx, addr)
+	if err != nil || status == nil {
+		return &query.ServerStatus{Online: false, Failure: query.FailError}
+	}
+	return status
+}
+
+// announce sends an RCON command to a server, if it has RCON. Failures are
+// logged: a missed warning must not keep the server from stopping.
+func (s *Service) announce(ctx context.Context, key string, srv config.Server, command string) {
+	password := s.cfg.RCONPassword(key)
+	if srv.RCONPort == 0 || password == "" {
+		return
+	}
+	addr := net.JoinHostPort(srv.IP, strconv.Itoa(srv.RCONPort))
+	if _, err := s.rcon.Execute(ctx, addr, password, command); err != nil {
+		logging.FromContext(ctx).Warn("announcing to players failed", "err", err)
+	}
+}
+
+// spokenDuration formats d for players, e.g. "5 minutes" or "30 seconds".
+func spokenDuration(d time.Duration) string {
+	unit, n := "second", int(d.Round(time.Second)/time.Second)
+	if d >= time.Minute && d%time.Minute == 0 {
+		unit, n = "minute", int(d/time.Minute)
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/logging"
+)
+
+// Log line limits for Logs.
+const (
+	DefaultLogLines = 100
+	MaxLogLines     = 1000
+
+	// logScanLines is how far back a grep searches.
+	logScanLines = 5000
+)
+
+// LogQuery selects the log lines Logs returns.
+type LogQuery struct {
+	Lines int           // the last N matching lines; 0 means DefaultLogLines
+	Since time.Duration // only lines newer than this; 0 means any age
+	Grep  string        // regular expression lines must match; empty matches all
+}
+
+// Logs returns the recent output of a server: its container logs for Docker
+// servers, or the output of its script's logs verb. Lines matching Grep are
+// searched for among the last few thousand.
+func (s *Service) Logs(ctx context.Context, key string, q LogQuery) (string, error) {
+	srv, ok := s.cfg.Servers[key]
+	if !ok {
+		return "", newError(KindNotFound, "Unknown server: %s", key)
+	}
+	if q.Lines <= 0 {
+		q.Lines = DefaultLogLines
+	}
+	if q.Lines > MaxLogLines {
+		return "", newError(KindInvalid, "At most %d lines can be fetched", MaxLogLines)
+	}
+	var grep *regexp.Regexp
+	if q.Grep != "" {
+		re, err := regexp.Compile(q.Grep)
+		if err != nil {
+			return "", &Error{Kind: KindInvalid, Msg: "Invalid grep pattern", Err: err}
+		}
+		grep = re
+	}
+
+	opts := executor.LogOptions{Lines: q.Lines, Since: q.Since}
+	if grep != nil {
+		opts.Lines = logScanLines
+	}
+
+	ctx = logging.With(ctx, "server", key)
+	text, err := s.fetchLogs(ctx, srv, opts)
+	if err != nil {
+		logging.FromContext(ctx).Warn("fetching logs failed", "err", err)
+		return "", err
+	}
+	return tailLines(text, grep, q.Lines), nil
+}
+
+func (s *Service) fetchLogs(ctx context.Context, srv config.Server, opts executor.LogOptions) (string, error) {
+	if srv.Executor == config.ExecutorDocker {
+		if s.logs == nil {
+			return "", newError(KindUnavailable, "Container logs are not available")
+		}
+		text, err := s.logs.Logs(ctx, srv.ComposeProject, opts)
+		if err != nil {
+			return "", &Error{Kind: KindUnavailable, Msg: fmt.Sprintf("Failed to read the logs of %s", srv.DisplayName), Err: err}
+		}
+		return text, nil
+	}
+
+	if srv.LogsVerb == "" {
+		return "", newError(KindUnavailable, "%s has no logs_verb configured", srv.DisplayName)
+	}
+	env := map[string]string{"NED_LOG_LINES": strconv.Itoa(opts.Lines)}
+	if opts.Since > 0 {
+		env["NED_LOG_SINCE"] = opts.Since.String()
+	}
+	result, err := s.exec.Run(ctx, srv.Script, srv.LogsVerb, env)
+	if err != nil {
+		return "", &Error{Kind: KindUnavailable, Msg: fmt.Sprintf("Failed to read the logs of %s", srv.DisplayName), Err: err}
+	}
+	if result.ExitCode != 0 {
+		e := &Error{Kind: KindUnavailable, Msg: fmt.Sprintf("%s %s exited with code %d", srv.Script, srv.LogsVerb, result.ExitCode)}
+		if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+			e.Err = errors.New(stderr)
+		}
+		return "", e
+	}
+	return result.Stdout, nil
+}
+
+// tailLines returns the last n lines of text that match grep, or of all
+// lines when grep is nil.
+func tailLines(text string, grep *regexp.Regexp, n int) string {
+	var lines []string
+	for line := range strings.Lines(text) {
+		if grep == nil || grep.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/netwarlan/ned/internal/audit"
+)
+
+// matchOp serializes match start/stop, failing fast when one is running.
+func (s *Service) matchOp() (unlock func(), err error) {
+	if !s.matchMu.TryLock() {
+		return nil, newError(KindBusy, "A match operation is already in progress")
+	}
+	return s.matchMu.Unlock, nil
+}
+
+// StartMatches spins up count CS2 match instances and waits for the script.
+func (s *Service) StartMatches(ctx context.Context, c Caller, count int) (string, error) {
+	maxCount := s.cfg.CS2Matches.Pro.MaxInstances
+	if count <= 0 || count > maxCount {
+		return "", newError(KindInvalid, "count must be 1-%d, got %d", maxCount, count)
+	}
+	unlock, err := s.matchOp()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	result, err := s.match.Start(ctx, count)
+	if err != nil {
+		s.record(c, "match start", strconv.Itoa(count), err.Error(), audit.OutcomeError)
+		return "", &Error{Kind: KindUnavailable, Msg: "Failed to start match servers", Err: err}
+	}
+	s.record(c, "match start", strconv.Itoa(count), "", audit.OutcomeOK)
+	return result.Stdout, nil
+}
+
+// StopMatches tears down every CS2 match instance and waits for the script.
+func (s *Service) StopMatches(ctx context.Context, c Caller) (string, error) {
+	unlock, err := s.matchOp()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	result, err := s.match.Stop(ctx)
+	if err != nil {
+		s.record(c, "match stop", "", err.Error(), audit.OutcomeError)
+		return "", &Error{Kind: KindUnavailable, Msg: "Failed to stop match servers", Err: err}
+	}
+	s.record(c, "match stop", "", "", audit.OutcomeOK)
+	return result.Stdout, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// ProfilePlan is what applying a startup profile would change, in the
+// order it would be done: every stop, then every start.
+type ProfilePlan struct {
+	Profile string     `json:"profile"`
+	Stop    [][]string `json:"stop"`    // waves; dependents stop before what they depend on
+	Start   [][]string `json:"start"`   // waves; dependencies start first
+	Running []string   `json:"running"` // in the profile and already online
+	Unknown []string   `json:"unknown"` // could not be told running or stopped
+}
+
+// Empty reports whether the profile is already applied.
+func (p *ProfilePlan) Empty() bool {
+	return len(p.Stop) == 0 && len(p.Start) == 0
+}
+
+// PlanProfile works out how to get from the servers running now to a
+// startup profile. Servers in the profile that are not known to be online
+// are started, along with what they depend on. Servers outside it are
+// stopped if they are online, or if they conflict with one in it and are
+// not known to be offline. Other servers are left alone. Every server is
+// probed like a start's conflict check, and those whose state cannot be
+// told, e.g. UDP-only servers, are listed in Unknown.
+func (s *Service) PlanProfile(ctx context.Context, name string) (*ProfilePlan, error) {
+	want, ok := s.cfg.ProfileServers(name)
+	if !ok {
+		return nil, newError(KindNotFound, "Unknown profile: %s", name)
+	}
+	states := s.probeAll(ctx)
+
+	plan := &ProfilePlan{Profile: name}
+	var start, stop []string
+	for _, key := range want {
+		if states[key].online {
+			plan.Running = append(plan.Running, key)
+		} else {
+			start = append(start, key)
+		}
+	}
+	for key, state := range states {
+		if !state.known {
+			plan.Unknown = append(plan.Unknown, key)
+		}
+		if slices.Contains(want, key) {
+			continue
+		}
+		switch {
+		case state.online:
+			stop = append(stop, key)
+		case !state.known && slices.ContainsFunc(want, func(w string) bool { return s.cfg.Conflicts(key, w) }):
+			stop = append(stop, key)
+		}
+	}
+	sort.Strings(plan.Unknown)
+
+	plan.Start = s.cfg.StartOrder(start)
+	plan.Stop = s.cfg.StartOrder(stop)
+	slices.Reverse(plan.Stop)
+	return plan, nil
+}
+
+// ApplyProfile carries out a plan from PlanProfile, one wave at a time and
+// at most maxConcurrentLifecycle servers at once. A server is skipped when
+// something it depends on fails to start, or something it conflicts with
+// fails to stop. Unless force is set, stopping a server with players waits
+// out its shutdown_grace. Results are in plan order.
+func (s *Service) ApplyProfile(ctx context.Context, c Caller, plan *ProfilePlan, force bool) []BulkResult {
+	var results []BulkResult
+	failed := map[string]bool{}
+	run := func(wave []string, action string) {
+		var keys []string
+		for _, key := range wave {
+			if reason := s.blocked(key, action, failed); reason != "" {
+				failed[key] = true
+				results = append(results, BulkResult{Key: key, Name: s.cfg.DisplayName(key), Action: action, Err: reason})
+				continue
+			}
+			keys = append(keys, key)
+		}
+		done := s.runBulkWave(ctx, c, keys, action, force)
+		sort.Slice(done, func(i, j int) bool { return done[i].Key < done[j].Key })
+		for _, r := range done {
+			if r.Failed() {
+				failed[r.Key] = true
+			}
+		}
+		results = append(results, done...)
+	}
+
+	for _, wave := range plan.Stop {
+		run(wave, ActionStop)
+	}
+	for _, wave := range plan.Start {
+		run(wave, ActionStart)
+	}
+
+	outcome, detail := outcomeOf(slices.Sorted(maps.Keys(failed)), len(results))
+	s.record(c, "profile apply", plan.Profile, detail, outcome)
+	return results
+}
+
+// blocked explains why key cannot start after the failures so far: a
+// server it depends on did not start, or one it conflicts with did not
+// stop. It returns "" when key may go ahead; stops are never blocked.
+func (s *Service) blocked(key, action string, failed map[string]bool) string {
+	if action != ActionStart {
+		return ""
+	}
+	for _, other := range slices.Sorted(maps.Keys(failed)) {
+		switch {
+		case slices.Contains(s.cfg.Servers[key].DependsOn, other):
+			return fmt.Sprintf("skipped, %s did not start", s.cfg.DisplayName(other))
+		case s.cfg.Conflicts(key, other):
+			return fmt.Sprintf("skipped, %s did not stop", s.cfg.DisplayName(other))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/rcon"
+)
+
+// maxConcurrentRCON caps how many RCON connections a single broadcast opens at once.
+const maxConcurrentRCON = 8
+
+// Group targets accepted by SendRCON in addition to server keys and categories.
+const (
+	TargetAll        = "all"
+	TargetAllCS2     = "all-cs2"
+	TargetAllMatches = "all-matches"
+)
+
+// RCONResult is the outcome of one RCON command against one server.
+type RCONResult struct {
+	Server   string
+	Response string
+	Err      error
+}
+
+// SendRCON runs command on every server target covers (a server key,
+// category or group), after checking the RCON policy for each. Results are
+// sorted by server key.
+func (s *Service) SendRCON(ctx context.Context, c Caller, target, command string) ([]RCONResult, error) {
+	targets, err := s.ResolveRCONTargets(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeRCON(c, targets, command, "rcon"); err != nil {
+		return nil, err
+	}
+	results := broadcastRCON(ctx, s.rcon, targets, command)
+	s.recordBroadcast(c, "rcon", target, command, results)
+	return results, nil
+}
+
+// ChangeMap changes the map on one CS2 server, or every CS2 server
+// (including match instances) when serverKey is empty.
+func (s *Service) ChangeMap(ctx context.Context, c Caller, mapName, serverKey string) ([]RCONResult, error) {
+	if mapName == "" {
+		return nil, newError(KindInvalid, "A map name is required")
+	}
+	targets := s.cfg.AllCS2RCONTargets()
+	if serverKey != "" {
+		target, ok := targets[serverKey]
+		if !ok {
+			return nil, newError(KindNotFound, "Unknown CS2 server: %s", serverKey)
+		}
+		targets = map[string]config.RCONTarget{serverKey: target}
+	}
+
+	command := "changelevel " + mapName
+	if err := s.authorizeRCON(c, targets, command, "match map"); err != nil {
+		return nil, err
+	}
+	results := broadcastRCON(ctx, s.rcon, targets, command)
+	s.recordBroadcast(c, "match map", serverKey, command, results)
+	return results, nil
+}
+
+// recordBroadcast audits a command sent to several servers: ok, partial or
+// error depending on how many of them failed, which are listed after the
+// command.
+func (s *Service) recordBroadcast(c Caller, action, target, command string, results []RCONResult) {
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Server)
+		}
+	}
+	outcome, detail := outcomeOf(failed, len(results))
+	if detail != "" {
+		command += "; " + detail
+	}
+	s.record(c, action, target, command, outcome)
+}
+
+// ResolveRCONTargets expands a server key, category, or group name into the
+// set of RCON targets it covers.
+func (s *Service) ResolveRCONTargets(target string) (map[string]config.RCONTarget, error) {
+	switch target {
+	case TargetAll:
+		targets := s.cfg.AllCS2RCONTargets()
+		for key := range s.cfg.RCONCapableServers() {
+			address, password, _ := s.resolveServer(key)
+			targets[key] = config.RCONTarget{Address: address, Password: password}
+		}
+		return targets, nil
+	case TargetAllCS2:
+		return s.cfg.AllCS2RCONTargets(), nil
+	case TargetAllMatches:
+		targets := s.cfg.AllCS2RCONTargets()
+		for key := range targets {
+			if !strings.HasPrefix(key, "match-") {
+				delete(targets, key)
+			}
+		}
+		if len(targets) == 0 {
+			return nil, newError(KindNotFound, "no match servers are configured")
+		}
+		return targets, nil
+	}
+
+	if _, ok := s.cfg.Servers[target]; !ok {
+		targets := make(map[string]config.RCONTarget)
+		for key, srv := range s.cfg.RCONCapableServers() {
+			if srv.Category == target {
+				address, password, _ := s.resolveServer(key)
+				targets[key] = config.RCONTarget{Address: address, Password: password}
+			}
+		}
+		if len(targets) > 0 {
+			return targets, nil
+		}
+	}
+
+	address, password, err := s.resolveServer(target)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]config.RCONTarget{target: {Address: address, Password: password}}, nil
+}
+
+// RCONCategories returns the sorted categories that contain at least one
+// RCON-capable server.
+func (s *Service) RCONCategories() []string {
+	seen := make(map[string]bool)
+	for _, srv := range s.cfg.RCONCapableServers() {
+		if srv.Category != "" {
+			seen[srv.Category] = true
+		}
+	}
+	cats := make([]string, 0, len(seen))
+	for cat := range seen {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// RCONChoice is a target accepted by SendRCON, as offered to users.
+type RCONChoice struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+}
+
+// RCONTargets lists the targets accepted by SendRCON: groups and categories
+// first, then individual servers sorted by display name.
+func (s *Service) RCONTargets() []RCONChoice {
+	var servers []RCONChoice
+	for key, srv := range s.cfg.RCONCapableServers() {
+		servers = append(servers, RCONChoice{Value: key, Name: srv.DisplayName})
+	}
+	for i := 1; i <= s.cfg.CS2Matches.Pro.MaxInstances; i++ {
+		key := fmt.Sprintf("match-pro-%d", i)
+		servers = append(servers, RCONChoice{Value: key, Name: s.cfg.DisplayName(key)})
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+
+	choices := []RCONChoice{
+		{Value: TargetAll, Name: "All RCON servers"},
+		{Value: TargetAllCS2, Name: "All CS2 servers"},
+		{Value: TargetAllMatches, Name: "All match servers"},
+	}
+	for _, cat := range s.RCONCategories() {
+		choices = append(choices, RCONChoice{Value: cat, Name: "Category: " + cat})
+	}
+	return append(choices, servers...)
+}
+
+func (s *Service) resolveServer(key string) (address, password string, err error) {
+	if srv, ok := s.cfg.Servers[key]; ok {
+		password := s.cfg.RCONPassword(key)
+		if srv.RCONPort == 0 || password == "" {
+			return "", "", newError(KindInvalid, "server %s does not have RCON configured", key)
+		}
+		return net.JoinHostPort(srv.IP, strconv.Itoa(srv.RCONPort)), password, nil
+	}
+
+	targets := s.cfg.AllCS2RCONTargets()
+	if target, ok := targets[key]; ok {
+		return target.Address, target.Password, nil
+	}
+
+	return "", "", newError(KindNotFound, "unknown server: %s", key)
+}
+
+// authorizeRCON checks command against the RCON policy for every target and
+// records each denial. It returns a *DeniedError listing the denied targets.
+func (s *Service) authorizeRCON(c Caller, targets map[string]config.RCONTarget, command, action string) error {
+	var denied []string
+	for key := range targets {
+		if err := s.policy.Check(key, c.Roles, command); err != nil {
+			denied = append(denied, key)
+			s.record(c, action, key, command, audit.OutcomeDenied)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	sort.Strings(denied)
+	return &DeniedError{Servers: denied, Command: command}
+}
+
+// broadcastRCON runs command on every target in parallel, at most
+// maxConcurrentRCON at a time. Results are sorted by server key.
+func broadcastRCON(ctx context.Context, client rcon.Client, targets map[string]config.RCONTarget, command string) []RCONResult {
+	var (
+		mu      sync.Mutex
+		results []RCONResult
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentRCON)
+	)
+
+	for key, target := range targets {
+		wg.Add(1)
+		go func(key string, target config.RCONTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(logging.With(ctx, "server", key), 10*time.Second)
+			defer cancel()
+			resp, err := client.Execute(ctx, target.Address, target.Password, command)
+			mu.Lock()
+			results = append(results, RCONResult{Server: key, Response: resp, Err: err})
+			mu.Unlock()
+		}(key, target)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Server < results[j].Server })
+	return results
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/secret"
+)
+
+const (
+	rotatePasswordLen = 24
+	rotateVerifyCmd   = "echo ned-rotate-verify"
+)
+
+// rotateVerifyBackoff are the waits before each attempt to reconnect with a
+// new password: a server may take a moment to drop the old one.
+var rotateVerifyBackoff = []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}
+
+// RotationState is where a server's RCON password ended up after a rotation.
+type RotationState string
+
+const (
+	Rotated      RotationState = "rotated"
+	StillOld     RotationState = "old"     // rolled back, or never changed
+	StuckOnNew   RotationState = "new"     // rollback failed; Ned keeps using the new password
+	StateUnknown RotationState = "unknown" // unreachable after the failure
+)
+
+// RotationGroup is a set of servers whose passwords come from the same
+// secret reference. The reference holds one value, so the group is rotated
+// (and rolled back) as a unit.
+type RotationGroup struct {
+	Servers []string                 // sorted server keys
+	Offline []string                 // sorted match instances left out because they are offline
+	Failure string                   // empty when the rotation succeeded
+	States  map[string]RotationState // per server key
+}
+
+// RotateRCON generates, applies, verifies and persists a new RCON password
+// for every server target covers. Each password reference is handled as
+// one group; a failed group is rolled back without affecting the others.
+// CS2 match instances that are offline are left out, so that a group of
+// matches is not rolled back just because some were never started.
+func (s *Service) RotateRCON(ctx context.Context, c Caller, target string) ([]RotationGroup, error) {
+	targets, err := s.ResolveRCONTargets(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeRCON(c, targets, "rcon_password", "rcon rotate"); err != nil {
+		return nil, err
+	}
+
+	groups, err := s.rotationGroups(targets)
+	if err != nil {
+		return nil, &Error{Kind: KindInvalid, Msg: "Cannot rotate RCON passwords", Err: err}
+	}
+
+	offline := s.offlineMatches(ctx, targets)
+	var failed, skipped []string
+	for i := range groups {
+		g := &groups[i]
+		g.Servers = slices.DeleteFunc(g.Servers, func(key string) bool {
+			if offline[key] {
+				g.Offline = append(g.Offline, key)
+			}
+			return offline[key]
+		})
+		skipped = append(skipped, g.Offline...)
+		if len(g.Servers) == 0 {
+			continue
+		}
+		s.rotateGroup(ctx, g, targets)
+		if g.Failure != "" {
+			failed = append(failed, g.Servers...)
+		}
+	}
+	outcome, detail := outcomeOf(failed, len(targets)-len(skipped))
+	if len(skipped) > 0 {
+		detail = strings.TrimPrefix(detail+"; skipped offline: "+strings.Join(skipped, ", "), "; ")
+	}
+	s.record(c, "rcon rotate", target, detail, outcome)
+	return groups, nil
+}
+
+// rotationGroups groups targets by password reference. Every reference must
+// be writable, and every server sharing a reference must be part of the
+// rotation, otherwise the persisted value would lock the others out.
+func (s *Service) rotationGroups(targets map[string]config.RCONTarget) ([]RotationGroup, error) {
+	byRef := make(map[string][]string)
+	for key := range targets {
+		ref := s.cfg.RCONPasswordRef(key)
+		if !secret.Writable(ref) {
+			return nil, fmt.Errorf("%s: rcon_password is not a file: or secret: reference, so a new password could not be saved", s.cfg.DisplayName(key))
+		}
+		byRef[ref] = append(byRef[ref], key)
+	}
+
+	all, _ := s.ResolveRCONTargets(TargetAll)
+	for key := range all {
+		if _, ok := targets[key]; ok {
+			continue
+		}
+		if keys, ok := byRef[s.cfg.RCONPasswordRef(key)]; ok {
+			return nil, fmt.Errorf("%s shares its password with %s; rotate them together",
+				s.cfg.DisplayName(keys[0]), s.cfg.DisplayName(key))
+		}
+	}
+
+	groups := make([]RotationGroup, 0, len(byRef))
+	for _, keys := range byRef {
+		sort.Strings(keys)
+		groups = append(groups, RotationGroup{Servers: keys, States: make(map[string]RotationState, len(keys))})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Servers[0] < groups[j].Servers[0] })
+	return groups, nil
+}
+
+// offlineMatches queries the CS2 match instances among targets and returns
+// those known to be offline. Instances that cannot be queried are rotated
+// like any other server.
+func (s *Service) offlineMatches(ctx context.Context, targets map[string]config.RCONTarget) map[string]bool {
+	addrs := s.cfg.AllQueryTargets()
+	var (
+		mu      sync.Mutex
+		offline = make(map[string]bool)
+		wg      sync.WaitGroup
+	)
+	for key := range targets {
+		addr, ok := addrs[key]
+		if !ok || !strings.HasPrefix(key, "match-") {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if online, known := knownState(s.queryStatus(ctx, addr)); known && !online {
+				mu.Lock()
+				offline[key] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return offline
+}
+
+// rotateGroup applies a new password to every server in g, verifies it by
+// reconnecting, and persists it. On any failure it rolls the group back and
+// records where each server ended up.
+func (s *Service) rotateGroup(ctx context.Context, g *RotationGroup, targets map[string]config.RCONTarget) {
+	newPassword, err := generatePassword(rotatePasswordLen)
+	if err != nil {
+		g.Failure = err.Error()
+		for _, key := range g.Servers {
+			g.States[key] = StillOld
+		}
+		return
+	}
+	secret.Register(newPassword)
+
+	oldTargets := make(map[string]config.RCONTarget, len(g.Servers))
+	newTargets := make(map[string]config.RCONTarget, len(g.Servers))
+	for _, key := range g.Servers {
+		oldTargets[key] = targets[key]
+		newTargets[key] = config.RCONTarget{Address: targets[key].Address, Password: newPassword}
+	}
+
+	failure := ""
+	for _, r := range broadcastRCON(ctx, s.rcon, oldTargets, "rcon_password "+newPassword) {
+		if r.Err != nil && failure == "" {
+			failure = fmt.Sprintf("applying on %s: %v", s.cfg.DisplayName(r.Server), r.Err)
+		}
+	}
+	if failure == "" {
+		for _, r := range s.verifyRotation(ctx, newTargets) {
+			if r.Err != nil && failure == "" {
+				failure = fmt.Sprintf("verifying on %s: %v", s.cfg.DisplayName(r.Server), r.Err)
+			}
+		}
+	}
+	if failure == "" && s.dryRun {
+		for _, key := range g.Servers {
+			g.States[key] = Rotated
+		}
+		logging.FromContext(ctx).Info("dry run: would persist rotated RCON password", "servers", g.Servers)
+		return
+	}
+	if failure == "" {
+		if err := s.cfg.PersistRCONPassword(g.Servers[0], newPassword); err != nil {
+			failure = err.Error()
+		}
+	}
+
+	if failure == "" {
+		for _, key := range g.Servers {
+			s.cfg.SetRCONPassword(key, newPassword)
+			g.States[key] = Rotated
+		}
+		// Offline instances must come up with the saved password, which
+		// Ned uses for them from now on.
+		for _, key := range g.Offline {
+			s.cfg.SetRCONPassword(key, newPassword)
+		}
+		logging.FromContext(ctx).Info("rotated RCON password", "servers", g.Servers)
+		return
+	}
+
+	logging.FromContext(ctx).Warn("RCON password rotation failed, rolling back", "servers", g.Servers, "reason", failure)
+	g.Failure = failure
+	s.rollback(ctx, g, oldTargets, newTargets)
+}
+
+// verifyRotation reconnects to targets with their new password, retrying
+// the servers that fail with rotateVerifyBackoff until they succeed, the
+// attempts run out or ctx ends. Results are sorted by server.
+func (s *Service) verifyRotation(ctx context.Context, targets map[string]config.RCONTarget) []RCONResult {
+	pending := maps.Clone(targets)
+	var results []RCONResult
+	for i, wait := range rotateVerifyBackoff {
+		select {
+		case <-ctx.Done():
+			for key := range pending {
+				results = append(results, RCONResult{Server: key, Err: ctx.Err()})
+			}
+			pending = nil
+		case <-time.After(wait):
+		}
+		if len(pending) == 0 {
+			break
+		}
+		last := i == len(rotateVerifyBackoff)-1
+		for _, r := range broadcastRCON(ctx, s.rcon, pending, rotateVerifyCmd) {
+			if r.Err == nil || last {
+				results = append(results, r)
+				delete(pending, r.Server)
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Server < results[j].Server })
+	return results
+}
+
+// rollback restores the old password wherever the new one took effect and
+// records where each server ended up.
+func (s *Service) rollback(ctx context.Context, g *RotationGroup, oldTargets, newTargets map[string]config.RCONTarget) {
+	for _, key := range g.Servers {
+		// Servers that never accepted the new password simply fail auth here.
+		oldCmd := "rcon_password " + oldTargets[key].Password
+		broadcastRCON(ctx, s.rcon, map[string]config.RCONTarget{key: newTargets[key]}, oldCmd)
+	}
+
+	oldOK := make(map[string]bool)
+	for _, r := range broadcastRCON(ctx, s.rcon, oldTargets, rotateVerifyCmd) {
+		oldOK[r.Server] = r.Err == nil
+	}
+	newOK := make(map[string]bool)
+	for _, r := range broadcastRCON(ctx, s.rcon, newTargets, rotateVerifyCmd) {
+		newOK[r.Server] = r.Err == nil
+	}
+
+	for _, key := range g.Servers {
+		switch {
+		case oldOK[key]:
+			g.States[key] = StillOld
+		case newOK[key]:
+			// Keep Ned able to reach it until someone fixes it by hand.
+			s.cfg.SetRCONPassword(key, newTargets[key].Password)
+			g.States[key] = StuckOnNew
+		default:
+			g.States[key] = StateUnknown
+		}
+	}
+}
+
+// GroupNames joins the display names of keys.
+func (s *Service) GroupNames(keys []string) string {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, s.cfg.DisplayName(key))
+	}
+	return strings.Join(names, ", ")
+}
+
+// generatePassword returns a random alphanumeric password, each character
+// drawn uniformly from the alphabet. Source engines parse RCON passwords as
+// console arguments, so symbols are avoided.
+func generatePassword(n int) (string, error) {
+	const alphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	size := big.NewInt(int64(len(alphabet)))
+	buf := make([]byte, n)
+	for i := range buf {
+		j, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("generating password: %w", err)
+		}
+		buf[i] = alphabet[j.Int64()]
+	}
+	return string(buf), nil
+}
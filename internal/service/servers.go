@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/logging"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+// Lifecycle actions passed to service scripts.
+const (
+	ActionStart   = "up"
+	ActionStop    = "down"
+	ActionRestart = "restart"
+)
+
+// CategoryMatch is the board category of CS2 match instances.
+const CategoryMatch = "match"
+
+// Category is a section of the status board.
+type Category struct {
+	Key   string
+	Label string
+}
+
+// Categories lists the status board sections in display order.
+var Categories = []Category{
+	{"game", "Game Servers"},
+	{"cs2", "CS2"},
+	{CategoryMatch, "CS2 Matches"},
+	{"infra", "Infrastructure"},
+}
+
+// ServerEntry is one row of the status board.
+type ServerEntry struct {
+	Key      string              `json:"key"`
+	Name     string              `json:"name"`
+	Category string              `json:"category"`
+	Status   *query.ServerStatus `json:"status"` // nil when the server is not queryable
+}
+
+// ServerDetail is the live state of a single server.
+type ServerDetail struct {
+	Key       string              `json:"key"`
+	Name      string              `json:"name"`
+	Address   string              `json:"address,omitempty"` // game connect address, when configured
+	Queryable bool                `json:"queryable"`
+	Status    *query.ServerStatus `json:"status,omitempty"`
+	Players   []query.PlayerInfo  `json:"players,omitempty"`
+}
+
+// Lifecycle runs a service script action ("up", "down" or "restart") for a
+// configured server. It returns as soon as the script has started: game
+// scripts tail logs after starting, so they may never finish. The server is
+// locked until the script exits. Unless force is set, stopping a server
+// with players first waits out its shutdown_grace (see drain), and a server
+// is not started while another sharing its address or in its conflicts_with
+// is online or cannot be checked (see checkConflicts). A forced stop of a
+// server that is being drained ends the drain, so the pending stop runs at
+// once.
+func (s *Service) Lifecycle(ctx context.Context, c Caller, key, action string, force bool) (config.Server, error) {
+	if action == ActionStop && force && s.cutDrain(key) {
+		s.recordCutDrain(ctx, c, key)
+		return s.cfg.Servers[key], nil
+	}
+	srv, unlock, err := s.lockLifecycle(key, action)
+	if err != nil {
+		return config.Server{}, err
+	}
+	if action == ActionStart && !force {
+		if err := s.checkConflicts(ctx, key); err != nil {
+			unlock()
+			return config.Server{}, err
+		}
+	}
+
+	// The script outlives the request that started it.
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer unlock()
+		if action == ActionStop && !force {
+			s.drain(ctx, key, srv)
+		}
+		s.runLifecycle(ctx, c, key, srv, action)
+	}()
+	return srv, nil
+}
+
+// RunLifecycle is Lifecycle for callers that can wait: it returns once the
+// script exits. Scripts that tail logs after "up" are cut off by the
+// executor's timeout and still count as a success. A forced stop that ends
+// a drain waits for the pending stop instead of running its own, and
+// returns an empty result.
+func (s *Service) RunLifecycle(ctx context.Context, c Caller, key, action string, force bool) (*executor.Result, error) {
+	if action == ActionStop && force && s.cutDrain(key) {
+		s.recordCutDrain(ctx, c, key)
+		mu := s.serverLock(key)
+		mu.Lock()
+		mu.Unlock()
+		return &executor.Result{}, nil
+	}
+	srv, unlock, err := s.lockLifecycle(key, action)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	switch {
+	case force:
+	case action == ActionStart:
+		if err := s.checkConflicts(ctx, key); err != nil {
+			return nil, err
+		}
+	case action == ActionStop:
+		s.drain(ctx, key, srv)
+	}
+	return s.runLifecycle(ctx, c, key, srv, action)
+}
+
+// recordCutDrain logs and audits a forced stop that ended a drain.
+func (s *Service) recordCutDrain(ctx context.Context, c Caller, key string) {
+	logging.FromContext(ctx).Info("forced stop ended the drain", "server", key)
+	s.record(c, ActionStop, key, "forced: ended the shutdown grace of a pending stop", audit.OutcomeOK)
+}
+
+// lockLifecycle validates a lifecycle request and takes the server's lock.
+func (s *Service) lockLifecycle(key, action string) (config.Server, func(), error) {
+	switch action {
+	case ActionStart, ActionStop, ActionRestart:
+	default:
+		return config.Server{}, nil, newError(KindInvalid, "Unknown action: %s", action)
+	}
+	return s.lockServer(key)
+}
+
+// lockServer takes a server's lock, failing if another command holds it.
+func (s *Service) lockServer(key string) (config.Server, func(), error) {
+	srv, ok := s.cfg.Servers[key]
+	if !ok {
+		return config.Server{}, nil, newError(KindNotFound, "Unknown server: %s", key)
+	}
+
+	mu := s.serverLock(key)
+	if !mu.TryLock() {
+		return config.Server{}, nil, newError(KindBusy, "%s is already being managed by another command", srv.DisplayName)
+	}
+	return srv, mu.Unlock, nil
+}
+
+// runLifecycle runs the script, or the Docker action for servers with the
+// docker executor, and audits how it exited.
+func (s *Service) runLifecycle(ctx context.Context, c Caller, key string, srv config.Server, action string) (*executor.Result, error) {
+	ctx = logging.With(ctx, "server", key, "action", action)
+	logger := logging.FromContext(ctx)
+	exec, target := s.exec, srv.Script
+	if srv.Executor == config.ExecutorDocker {
+		exec, target = s.docker, srv.ComposeProject
+	}
+	if exec == nil {
+		return nil, newError(KindUnavailable, "%s uses the %s executor, which is not available", srv.DisplayName, srv.Executor)
+	}
+	result, err := exec.Run(ctx, target, action, nil)
+	switch {
+	case err != nil:
+		logger.Error("lifecycle script failed", "err", err)
+		s.record(c, action, key, err.Error(), audit.OutcomeError)
+		return result, &Error{Kind: KindUnavailable, Msg: fmt.Sprintf("Failed to %s %s", action, srv.DisplayName), Err: err}
+	case result.ExitCode != 0:
+		logger.Warn("lifecycle script exited non-zero", "exit_code", result.ExitCode, "duration", result.Duration)
+		s.record(c, action, key, fmt.Sprintf("exit code %d", result.ExitCode), audit.OutcomeError)
+	default:
+		logger.Info("lifecycle script finished", "duration", result.Duration)
+		s.record(c, action, key, "", audit.OutcomeOK)
+	}
+	return result, nil
+}
+
+// queryAll queries every A2S target in parallel.
+func (s *Service) queryAll(ctx context.Context) map[string]*query.ServerStatus {
+	targets := s.cfg.AllQueryTargets()
+
+	var (
+		mu      sync.Mutex
+		results = make(map[string]*query.ServerStatus, len(targets))
+		wg      sync.WaitGroup
+	)
+	for key, addr := range targets {
+		wg.Add(1)
+		go func(key, addr string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(logging.With(ctx, "server", key), 5*time.Second)
+			defer cancel()
+			status, _ := s.querier.QueryStatus(ctx, addr)
+			if status == nil {
+				status = &query.ServerStatus{Online: false}
+			}
+			mu.Lock()
+			results[key] = status
+			mu.Unlock()
+		}(key, addr)
+	}
+	wg.Wait()
+	return results
+}
+
+// Board queries every server and returns the status board sorted by key.
+// Servers that do not speak A2S are included with a nil Status.
+func (s *Service) Board(ctx context.Context) []ServerEntry {
+	statuses := s.queryAll(ctx)
+
+	var entries []ServerEntry
+	for key, status := range statuses {
+		entries = append(entries, ServerEntry{Key: key, Name: s.cfg.DisplayName(key), Category: s.category(key), Status: status})
+	}
+	for key, srv := range s.cfg.Servers {
+		if srv.Protocol != "source" {
+			entries = append(entries, ServerEntry{Key: key, Name: srv.DisplayName, Category: srv.Category})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Online returns the queryable servers that answered, sorted by key.
+func (s *Service) Online(ctx context.Context) []ServerEntry {
+	var entries []ServerEntry
+	for key, status := range s.queryAll(ctx) {
+		if status.Online {
+			entries = append(entries, ServerEntry{Key: key, Name: s.cfg.DisplayName(key), Category: s.category(key), Status: status})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+func (s *Service) category(key string) string {
+	if strings.HasPrefix(key, "match-") {
+		return CategoryMatch
+	}
+	return s.cfg.Servers[key].Category
+}
+
+// Server returns the live state of a configured server. Servers that do not
+// speak A2S are returned with Queryable false and no status.
+func (s *Service) Server(ctx context.Context, key string) (*ServerDetail, error) {
+	srv, ok := s.cfg.Servers[key]
+	if !ok {
+		return nil, newError(KindNotFound, "Unknown server: %s", key)
+	}
+
+	detail := &ServerDetail{Key: key, Name: srv.DisplayName}
+	if srv.Port > 0 {
+		detail.Address = net.JoinHostPort(srv.IP, strconv.Itoa(srv.Port))
+	}
+	if srv.Protocol != "source" || srv.QueryPort <= 0 {
+		return detail, nil
+	}
+
+	detail.Queryable = true
+	s.queryDetail(ctx, detail, net.JoinHostPort(srv.IP, strconv.Itoa(srv.QueryPort)))
+	return detail, nil
+}
+
+// Players returns the live state and player list of any queryable server,
+// including match instances. An offline server is an error.
+func (s *Service) Players(ctx context.Context, key string) (*ServerDetail, error) {
+	addr, ok := s.cfg.AllQueryTargets()[key]
+	if !ok {
+		return nil, newError(KindNotFound, "Server %s is not queryable", key)
+	}
+	detail := &ServerDetail{Key: key, Name: s.cfg.DisplayName(key), Queryable: true}
+	if err := s.queryDetail(ctx, detail, addr); err != nil || !detail.Status.Online {
+		return nil, &Error{Kind: KindUnavailable, Msg: detail.Name + " is offline or unreachable", Err: err}
+	}
+	return detail, nil
+}
+
+// queryDetail fills in status and players. The player list is best effort.
+func (s *Service) queryDetail(ctx context.Context, detail *ServerDetail, addr string) error {
+	ctx, cancel := context.WithTimeout(logging.With(ctx, "server", detail.Key), 5*time.Second)
+	defer cancel()
+
+	status, err := s.querier.QueryStatus(ctx, addr)
+	if status == nil {
+		status = &query.ServerStatus{Online: false}
+	}
+	if err != nil || !status.Online {
+		detail.Status = &query.ServerStatus{Online: false, Failure: status.Failure}
+		return err
+	}
+	detail.Status = status
+	detail.Players, _ = s.querier.QueryPlayers(ctx, addr)
+	return nil
+}
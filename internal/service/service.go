@@ -0,0 +1,221 @@
+// Package service implements Ned's operations independently of how they are
+// requested. The Discord command handlers and the HTTP API both call it, so
+// locking, policy checks and auditing behave the same on every transport.
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/policy"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/rcon"
+)
+
+// Caller identifies who asked for an operation. Roles are Ned role names
+// (config.roles keys), already resolved by the transport.
+type Caller struct {
+	Name  string
+	ID    string
+	Roles []string
+}
+
+// Kind classifies service errors so transports can map them to responses.
+type Kind int
+
+const (
+	KindInvalid Kind = iota + 1
+	KindNotFound
+	KindBusy
+	KindUnavailable
+)
+
+// Error is a service error with a user-facing message and, optionally, the
+// underlying cause.
+type Error struct {
+	Kind Kind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Msg }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is makes errors.Is(err, ErrNotFound) and friends match any message.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Msg == "" && t.Kind == e.Kind
+}
+
+// Sentinels for errors.Is.
+var (
+	ErrInvalid     = &Error{Kind: KindInvalid}
+	ErrNotFound    = &Error{Kind: KindNotFound}
+	ErrBusy        = &Error{Kind: KindBusy}
+	ErrUnavailable = &Error{Kind: KindUnavailable}
+)
+
+func newError(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// DeniedError reports that the RCON policy refused a command on some
+// targets. Nothing is sent when it is returned.
+type DeniedError struct {
+	Servers []string // sorted server keys
+	Command string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%q is not permitted for your roles on: %s", e.Command, strings.Join(e.Servers, ", "))
+}
+
+// Deps are the collaborators a Service needs. Match defaults to a match
+// executor over Executor. Docker runs servers whose executor is "docker",
+// and Logs reads their container logs.
+type Deps struct {
+	Executor executor.Executor
+	Docker   executor.Executor
+	Logs     executor.LogFetcher
+	Match    *executor.MatchExecutor
+	Querier  query.Querier
+	RCON     rcon.Client
+	Policy   *policy.RCONPolicy
+	Audit    audit.Logger
+
+	// DryRun marks Executor, Docker and RCON as recorders (see UseDryRun),
+	// so rotated RCON passwords are not persisted either.
+	DryRun bool
+}
+
+// UseDryRun replaces the collaborators that change servers, their scripts,
+// containers and RCON, with ones that log what would have run. Queries,
+// container logs and the audit log stay live; audit entries are marked
+// DryRun.
+func (d *Deps) UseDryRun() {
+	d.Executor = executor.NewDryRunExecutor()
+	d.Docker = executor.NewDryRunExecutor()
+	d.RCON = rcon.NewDryRunClient()
+	d.Match = nil
+	d.DryRun = true
+}
+
+// queryCacheTTL is how long A2S results are shared between callers, e.g.
+// everyone opening the status board at once.
+const queryCacheTTL = 5 * time.Second
+
+// DefaultDeps builds the production collaborators for cfg: shell scripts,
+// the Docker Engine, gorcon, A2S queries, the configured RCON policy and audit log.
+func DefaultDeps(cfg *config.Config) (Deps, error) {
+	rconPolicy, err := policy.NewRCONPolicy(cfg.RCONPolicy)
+	if err != nil {
+		return Deps{}, err
+	}
+
+	var auditLog audit.Logger = audit.LogLogger{}
+	if cfg.Audit.Path != "" {
+		fileLog, err := audit.NewFileLogger(cfg.Audit.Path)
+		if err != nil {
+			return Deps{}, err
+		}
+		auditLog = fileLog
+	}
+
+	shell := executor.NewShellExecutor(cfg.ResolvedScriptsDir, cfg.Environment)
+	shell.SetUpdateTimeout(cfg.Updates.Timeout)
+	docker := executor.NewDockerExecutor(cfg.Docker.Socket)
+	return Deps{
+		Executor: shell,
+		Docker:   docker,
+		Logs:     docker,
+		Querier:  query.NewCache(query.NewA2SQuerier(1500*time.Millisecond), queryCacheTTL),
+		RCON:     rcon.NewGorconClient(10 * time.Second),
+		Policy:   rconPolicy,
+		Audit:    auditLog,
+	}, nil
+}
+
+// Service performs Ned's operations.
+type Service struct {
+	cfg     *config.Config
+	exec    executor.Executor
+	docker  executor.Executor
+	logs    executor.LogFetcher
+	match   *executor.MatchExecutor
+	querier query.Querier
+	rcon    rcon.Client
+	policy  *policy.RCONPolicy
+	audit   audit.Logger
+	dryRun  bool
+
+	locks   sync.Map   // per-server mutexes
+	drains  sync.Map   // per-server context.CancelFunc of a drain in progress
+	matchMu sync.Mutex // serializes match start/stop operations
+}
+
+// New creates a Service.
+func New(cfg *config.Config, deps Deps) *Service {
+	if deps.Match == nil {
+		deps.Match = executor.NewMatchExecutor(deps.Executor, cfg.CS2Matches.Script, cfg.CS2Matches.Pro.MaxInstances)
+	}
+	return &Service{
+		cfg:     cfg,
+		exec:    deps.Executor,
+		docker:  deps.Docker,
+		logs:    deps.Logs,
+		match:   deps.Match,
+		querier: deps.Querier,
+		rcon:    deps.RCON,
+		policy:  deps.Policy,
+		audit:   deps.Audit,
+		dryRun:  deps.DryRun,
+	}
+}
+
+// Config returns the configuration the service was built with.
+func (s *Service) Config() *config.Config {
+	return s.cfg
+}
+
+// DryRun reports whether scripts and RCON commands are only recorded.
+func (s *Service) DryRun() bool {
+	return s.dryRun
+}
+
+func (s *Service) serverLock(key string) *sync.Mutex {
+	val, _ := s.locks.LoadOrStore(key, &sync.Mutex{})
+	return val.(*sync.Mutex)
+}
+
+func (s *Service) record(c Caller, action, target, detail, outcome string) {
+	s.audit.Record(audit.Entry{
+		User:    c.Name,
+		UserID:  c.ID,
+		Action:  action,
+		Target:  target,
+		Detail:  detail,
+		Outcome: outcome,
+		DryRun:  s.dryRun,
+	})
+}
+
+// outcomeOf sums up an action on total targets of which the failed keys did
+// not succeed, as the audit outcome and detail to record.
+func outcomeOf(failed []string, total int) (outcome, detail string) {
+	switch {
+	case len(failed) == 0:
+		return audit.OutcomeOK, ""
+	case len(failed) < total:
+		outcome = audit.OutcomePartial
+	default:
+		outcome = audit.OutcomeError
+	}
+	sort.Strings(failed)
+	return outcome, "failed: " + strings.Join(failed, ", ")
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/netwarlan/ned/internal/audit"
+	"github.com/netwarlan/ned/internal/config"
+	"github.com/netwarlan/ned/internal/logging"
+)
+
+// ActionUpdate is the service script command that updates a game server,
+// e.g. through SteamCMD.
+const ActionUpdate = "update"
+
+// Progress receives a short description of each step of a long operation.
+type Progress func(server, step string)
+
+// UpdateResult reports how a server's update went.
+type UpdateResult struct {
+	Key        string `json:"key"`
+	Name       string `json:"name"`
+	Skipped    string `json:"skipped,omitempty"` // why a batch update left the server alone
+	WasRunning bool   `json:"was_running"`
+	Unknown    bool   `json:"status_unknown,omitempty"` // the server could not be queried
+	Restarted  bool   `json:"restarted"`
+	ExitCode   int    `json:"exit_code"`
+	Duration   string `json:"duration,omitempty"`
+	Output     string `json:"output,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
+// Failed reports whether the update did not complete.
+func (r UpdateResult) Failed() bool {
+	return r.Err != "" || r.ExitCode != 0
+}
+
+// Update runs a server's update script. A running server is stopped first,
+// after warning its players over RCON and giving them updates.warn_delay to
+// finish up, and started again afterwards. Servers that cannot be queried
+// may be running, so they are stopped and started again too.
+func (s *Service) Update(ctx context.Context, c Caller, key string, progress Progress) (UpdateResult, error) {
+	return s.update(ctx, c, key, false, progress)
+}
+
+// UpdateIdle updates, one after another, every script server that is
+// offline or has no players. Servers that cannot be queried or are busy
+// are skipped.
+func (s *Service) UpdateIdle(ctx context.Context, c Caller, progress Progress) []UpdateResult {
+	var results []UpdateResult
+	for _, key := range slices.Sorted(maps.Keys(s.cfg.Servers)) {
+		srv := s.cfg.Servers[key]
+		if srv.Executor == config.ExecutorDocker {
+			continue
+		}
+		result, err := s.update(ctx, c, key, true, progress)
+		if err != nil {
+			result = UpdateResult{Key: key, Name: srv.DisplayName, Skipped: err.Error()}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// update updates one server. With idleOnly, servers with players or an
+// unknown state are skipped.
+func (s *Service) update(ctx context.Context, c Caller, key string, idleOnly bool, progress Progress) (UpdateResult, error) {
+	srv, unlock, err := s.lockServer(key)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	defer unlock()
+	if srv.Executor == config.ExecutorDocker {
+		return UpdateResult{}, newError(KindInvalid, "%s runs in Docker; update its image instead", srv.DisplayName)
+	}
+
+	ctx = logging.With(ctx, "server", key, "action", ActionUpdate)
+	logger := logging.FromContext(ctx)
+	result := UpdateResult{Key: key, Name: srv.DisplayName}
+	step := func(format string, args ...any) {
+		if progress != nil {
+			progress(key, fmt.Sprintf(format, args...))
+		}
+	}
+
+	detail, _ := s.Server(ctx, key)
+	players := 0
+	if detail != nil && detail.Queryable {
+		result.WasRunning = detail.Status.Online
+		players = detail.Status.Players
+	} else {
+		result.Unknown = true
+	}
+	if idleOnly {
+		switch {
+		case result.Unknown:
+			result.Skipped = "status unknown"
+			return result, nil
+		case players > 0:
+			result.Skipped = fmt.Sprintf("%d player(s) online", players)
+			return result, nil
+		}
+	}
+
+	if players > 0 {
+		s.warnPlayers(ctx, key, srv, players, step)
+	}
+	running := result.WasRunning || result.Unknown
+	if running {
+		step("stopping")
+		if err := s.runStep(ctx, c, key, srv, ActionStop); err != nil {
+			result.Err = err.Error()
+			return result, nil
+		}
+	}
+
+	step("updating, this can take a while")
+	start := time.Now()
+	res, err := s.exec.Run(ctx, srv.Script, ActionUpdate, nil)
+	result.Duration = time.Since(start).Round(time.Second).String()
+	switch {
+	case err != nil:
+		result.Err = err.Error()
+		logger.Error("update script failed", "err", err)
+		s.record(c, ActionUpdate, key, err.Error(), audit.OutcomeError)
+	case res.ExitCode != 0:
+		result.ExitCode = res.ExitCode
+		result.Output = res.Stdout + res.Stderr
+		logger.Warn("update script exited non-zero", "exit_code", res.ExitCode)
+		s.record(c, ActionUpdate, key, fmt.Sprintf("exit code %d", res.ExitCode), audit.OutcomeError)
+	default:
+		result.Output = res.Stdout
+		logger.Info("update script finished", "duration", result.Duration)
+		s.record(c, ActionUpdate, key, "", audit.OutcomeOK)
+	}
+
+	// Bring a server that was running back even if the update failed, so a
+	// failed download does not leave players without it.
+	if running {
+		step("starting")
+		if err := s.runStep(ctx, c, key, srv, ActionStart); err != nil {
+			if result.Err == "" {
+				result.Err = err.Error()
+			}
+			return result, nil
+		}
+		result.Restarted = true
+	}
+	return result, nil
+}
+
+// runStep runs a lifecycle action as part of an update, treating a non-zero
+// exit as a failure.
+func (s *Service) runStep(ctx context.Context, c Caller, key string, srv config.Server, action string) error {
+	res, err := s.runLifecycle(ctx, c, key, srv, action)
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("%s exited with code %d", action, res.ExitCode)
+	}
+	return nil
+}
+
+// warnPlayers announces the update over RCON and waits updates.warn_delay.
+// Servers without RCON are stopped without warning.
+func (s *Service) warnPlayers(ctx context.Context, key string, srv config.Server, players int, step func(string, ...any)) {
+	if srv.RCONPort == 0 || s.cfg.RCONPassword(key) == "" {
+		return
+	}
+	delay := s.cfg.Updates.WarnDelay
+	s.announce(ctx, key, srv, fmt.Sprintf("say Server going down for an update in %s", spokenDuration(delay)))
+	step("warned %d player(s), stopping in %s", players, delay)
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
@@ -0,0 +1,193 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netwarlan/ned/internal/fsutil"
+	"github.com/netwarlan/ned/internal/poller"
+)
+
+// startTolerance is how far a player's derived connect time may drift
+// between polls and still count as the same session. A2S durations are
+// whole seconds and polls take time, so exact matches are rare.
+const startTolerance = 90 * time.Second
+
+// Session is one continuous stretch of a player on a server, identified by
+// player name and first-seen (connect) time.
+type Session struct {
+	Player   string    `json:"player"`
+	Server   string    `json:"server"`
+	Start    time.Time `json:"start"`
+	LastSeen time.Time `json:"last_seen"`
+	Score    int       `json:"score"`
+	Active   bool      `json:"active"` // still connected at the last poll
+}
+
+// Duration is how long the session lasted (or has lasted so far).
+func (s Session) Duration() time.Duration {
+	return s.LastSeen.Sub(s.Start)
+}
+
+// Tracker builds player sessions from server polls. When created with a
+// path it saves its state after every poll so sessions survive restarts.
+type Tracker struct {
+	path string
+
+	mu       sync.RWMutex
+	sessions []*Session
+}
+
+// Open creates a Tracker, loading previously saved sessions from path.
+// An empty path keeps sessions in memory only.
+func Open(path string) (*Tracker, error) {
+	t := &Tracker{path: path}
+	if path == "" {
+		return t, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading sessions: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.sessions); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Observe updates sessions from a poll. It implements poller.Observer.
+func (t *Tracker) Observe(_ context.Context, samples []poller.Sample) {
+	t.mu.Lock()
+	for _, sample := range samples {
+		t.observe(sample)
+	}
+	snapshot, err := json.Marshal(t.sessions)
+	t.mu.Unlock()
+
+	if err != nil {
+		slog.Error("encoding sessions", "err", err)
+		return
+	}
+	if t.path != "" {
+		if err := fsutil.WriteFileAtomic(t.path, snapshot); err != nil {
+			slog.Error("saving sessions", "path", t.path, "err", err)
+		}
+	}
+}
+
+// observe applies one server's sample. Callers must hold t.mu.
+func (t *Tracker) observe(sample poller.Sample) {
+	var open []*Session
+	for _, s := range t.sessions {
+		if s.Active && s.Server == sample.Key {
+			open = append(open, s)
+		}
+	}
+
+	if sample.Status == nil || !sample.Status.Online {
+		for _, s := range open {
+			s.Active = false
+		}
+		return
+	}
+	if sample.PlayersErr != nil {
+		// Unknown player list: leave sessions as they are until a poll succeeds.
+		return
+	}
+
+	matched := make(map[*Session]bool)
+	for _, p := range sample.Players {
+		if p.Name == "" {
+			// Players still connecting have no name yet.
+			continue
+		}
+		start := sample.Time.Add(-p.Duration)
+
+		var session *Session
+		for _, s := range open {
+			if !matched[s] && s.Player == p.Name && absDuration(s.Start.Sub(start)) <= startTolerance {
+				session = s
+				break
+			}
+		}
+		if session == nil {
+			session = &Session{Player: p.Name, Server: sample.Key, Start: start, Active: true}
+			t.sessions = append(t.sessions, session)
+		}
+		matched[session] = true
+		session.LastSeen = sample.Time
+		session.Score = p.Score
+	}
+
+	for _, s := range open {
+		if !matched[s] {
+			s.Active = false
+		}
+	}
+}
+
+// Match returns the player names matching query. A case-insensitive exact
+// match wins; otherwise every name containing query is returned, sorted.
+func (t *Tracker) Match(query string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var exact, partial []string
+	for _, s := range t.sessions {
+		if seen[s.Player] {
+			continue
+		}
+		seen[s.Player] = true
+		name := strings.ToLower(s.Player)
+		switch {
+		case name == q:
+			exact = append(exact, s.Player)
+		case strings.Contains(name, q):
+			partial = append(partial, s.Player)
+		}
+	}
+	if len(exact) > 0 {
+		sort.Strings(exact)
+		return exact
+	}
+	sort.Strings(partial)
+	return partial
+}
+
+// Sessions returns every session of player, most recent first.
+func (t *Tracker) Sessions(player string) []Session {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var out []Session
+	for _, s := range t.sessions {
+		if s.Player == player {
+			out = append(out, *s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,138 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/poller"
+	"github.com/netwarlan/ned/internal/query"
+)
+
+func sample(server string, at time.Time, players ...query.PlayerInfo) poller.Sample {
+	return poller.Sample{
+		Key:     server,
+		Time:    at,
+		Status:  &query.ServerStatus{Online: true, Players: len(players)},
+		Players: players,
+	}
+}
+
+func TestTracker_ContinuesAndEndsSessions(t *testing.T) {
+	tr, _ := Open("")
+	ctx := context.Background()
+	t0 := time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+
+	tr.Observe(ctx, []poller.Sample{sample("tf2", t0, query.PlayerInfo{Name: "alice", Duration: 5 * time.Minute})})
+	tr.Observe(ctx, []poller.Sample{sample("tf2", t0.Add(30*time.Second), query.PlayerInfo{Name: "alice", Duration: 5*time.Minute + 31*time.Second, Score: 4})})
+
+	got := tr.Sessions("alice")
+	if len(got) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(got))
+	}
+	if !got[0].Active || got[0].Score != 4 || !got[0].Start.Equal(t0.Add(-5*time.Minute)) {
+		t.Errorf("session = %+v", got[0])
+	}
+
+	// alice moves to cs2; the tf2 session ends.
+	t1 := t0.Add(time.Minute)
+	tr.Observe(ctx, []poller.Sample{
+		sample("tf2", t1),
+		sample("cs2", t1, query.PlayerInfo{Name: "alice", Duration: 10 * time.Second}),
+	})
+
+	got = tr.Sessions("alice")
+	if len(got) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(got))
+	}
+	if got[0].Server != "cs2" || !got[0].Active {
+		t.Errorf("latest session = %+v, want active on cs2", got[0])
+	}
+	if got[1].Server != "tf2" || got[1].Active {
+		t.Errorf("earlier session = %+v, want ended on tf2", got[1])
+	}
+}
+
+func TestTracker_ReconnectStartsNewSession(t *testing.T) {
+	tr, _ := Open("")
+	ctx := context.Background()
+	t0 := time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+
+	tr.Observe(ctx, []poller.Sample{sample("tf2", t0, query.PlayerInfo{Name: "bob", Duration: time.Hour})})
+	tr.Observe(ctx, []poller.Sample{sample("tf2", t0.Add(time.Minute), query.PlayerInfo{Name: "bob", Duration: 20 * time.Second})})
+
+	if got := tr.Sessions("bob"); len(got) != 2 || got[1].Active {
+		t.Errorf("sessions = %+v, want a new session after reconnect", got)
+	}
+}
+
+func TestTracker_KeepsSessionsWhenPlayerQueryFails(t *testing.T) {
+	tr, _ := Open("")
+	ctx := context.Background()
+	t0 := time.Now()
+
+	tr.Observe(ctx, []poller.Sample{sample("tf2", t0, query.PlayerInfo{Name: "carol", Duration: time.Minute})})
+	failed := sample("tf2", t0.Add(30*time.Second))
+	failed.Status.Players = 1
+	failed.PlayersErr = errors.New("timeout")
+	tr.Observe(ctx, []poller.Sample{failed})
+
+	if got := tr.Sessions("carol"); len(got) != 1 || !got[0].Active {
+		t.Errorf("sessions = %+v, want still active", got)
+	}
+
+	tr.Observe(ctx, []poller.Sample{{Key: "tf2", Time: t0.Add(time.Minute), Status: &query.ServerStatus{Online: false}}})
+	if got := tr.Sessions("carol"); got[0].Active {
+		t.Error("session still active after server went offline")
+	}
+}
+
+func TestTracker_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	t0 := time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+
+	tr, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Observe(context.Background(), []poller.Sample{sample("tf2", t0, query.PlayerInfo{Name: "dave", Duration: time.Minute})})
+
+	tr, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The restarted tracker continues the saved session.
+	tr.Observe(context.Background(), []poller.Sample{sample("tf2", t0.Add(time.Minute), query.PlayerInfo{Name: "dave", Duration: 2 * time.Minute})})
+	if got := tr.Sessions("dave"); len(got) != 1 || !got[0].Active {
+		t.Errorf("sessions = %+v", got)
+	}
+}
+
+func TestTracker_Match(t *testing.T) {
+	tr, _ := Open("")
+	tr.Observe(context.Background(), []poller.Sample{sample("tf2", time.Now(),
+		query.PlayerInfo{Name: "Frag"},
+		query.PlayerInfo{Name: "FragMaster"},
+		query.PlayerInfo{Name: "xXfragXx"},
+		query.PlayerInfo{Name: ""},
+	)})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"frag", []string{"Frag"}},
+		{"FRAGM", []string{"FragMaster"}},
+		{"rag", []string{"Frag", "FragMaster", "xXfragXx"}},
+		{"nobody", nil},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := tr.Match(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Match(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// A2S packet headers, see https://developer.valvesoftware.com/wiki/Server_queries.
+const (
+	a2sInfoRequest    = 'T'
+	a2sInfoResponse   = 'I'
+	a2sPlayerRequest  = 'U'
+	a2sPlayerResponse = 'D'
+	a2sChallenge      = 'A'
+)
+
+var (
+	a2sPrefix  = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	infoPrefix = []byte("\xFF\xFF\xFF\xFFTSource Engine Query\x00")
+)
+
+// serveA2S answers A2S requests until the UDP socket is closed.
+func (s *Server) serveA2S() {
+	defer s.wg.Done()
+	buf := make([]byte, 1400)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if reply := s.answerA2S(buf[:n]); reply != nil {
+			s.udp.WriteTo(reply, addr)
+		}
+	}
+}
+
+// answerA2S builds the reply to one request, or nil to leave it
+// unanswered.
+func (s *Server) answerA2S(req []byte) []byte {
+	s.mu.Lock()
+	fault := s.fault
+	drop := s.drop > 0
+	if drop {
+		s.drop--
+	}
+	s.mu.Unlock()
+
+	switch {
+	case drop, fault == Unresponsive:
+		return nil
+	case fault == BadResponse:
+		return append(append([]byte{}, a2sPrefix...), 'Z', 0x00)
+	case len(req) < 5 || !bytes.Equal(req[:4], a2sPrefix):
+		return nil
+	}
+
+	opts := s.snapshot()
+	switch req[4] {
+	case a2sInfoRequest:
+		if !bytes.HasPrefix(req, infoPrefix) {
+			return nil
+		}
+		if opts.Challenge && !s.validChallenge(req[len(infoPrefix):]) {
+			return s.challengeReply()
+		}
+		return infoReply(opts)
+	case a2sPlayerRequest:
+		if !s.validChallenge(req[5:]) {
+			return s.challengeReply()
+		}
+		return playerReply(opts)
+	}
+	return nil
+}
+
+// validChallenge reports whether b starts with the server's challenge.
+func (s *Server) validChallenge(b []byte) bool {
+	return len(b) >= 4 && binary.LittleEndian.Uint32(b) == s.challenge
+}
+
+func (s *Server) challengeReply() []byte {
+	b := append(append([]byte{}, a2sPrefix...), a2sChallenge)
+	return binary.LittleEndian.AppendUint32(b, s.challenge)
+}
+
+func infoReply(opts Options) []byte {
+	var b bytes.Buffer
+	b.Write(a2sPrefix)
+	b.WriteByte(a2sInfoResponse)
+	b.WriteByte(17) // protocol version
+	writeString(&b, opts.Name)
+	writeString(&b, opts.Map)
+	writeString(&b, "sim")       // folder
+	writeString(&b, "Simulator") // game
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	b.WriteByte(clampUint8(len(opts.Players)))
+	b.WriteByte(clampUint8(opts.MaxPlayers))
+	b.WriteByte(clampUint8(opts.Bots))
+	b.WriteByte('d') // dedicated
+	b.WriteByte('l') // linux
+	b.WriteByte(0)   // no password
+	b.WriteByte(0)   // no VAC
+	writeString(&b, "1.0.0.0")
+	return b.Bytes()
+}
+
+func playerReply(opts Options) []byte {
+	var b bytes.Buffer
+	b.Write(a2sPrefix)
+	b.WriteByte(a2sPlayerResponse)
+	b.WriteByte(clampUint8(len(opts.Players)))
+	for i, p := range opts.Players {
+		b.WriteByte(clampUint8(i))
+		writeString(&b, p.Name)
+		binary.Write(&b, binary.LittleEndian, int32(p.Score))
+		binary.Write(&b, binary.LittleEndian, float32(p.Duration.Seconds()))
+	}
+	return b.Bytes()
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteString(s)
+	b.WriteByte(0)
+}
+
+func clampUint8(n int) byte {
+	return byte(min(max(n, 0), math.MaxUint8))
+}
@@ -0,0 +1,157 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Source RCON packet types, see https://developer.valvesoftware.com/wiki/Source_RCON_Protocol.
+const (
+	rconResponseValue = 0
+	rconExecCommand   = 2
+	rconAuthResponse  = 2
+	rconAuth          = 3
+
+	rconMaxPacket = 4096
+)
+
+// serveRCON accepts RCON connections until the listener is closed.
+func (s *Server) serveRCON() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		refuse := s.fault == RefuseRCON
+		s.mu.Unlock()
+		if refuse {
+			conn.Close()
+			continue
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn runs one RCON session: authentication, then commands until
+// the client disconnects or sends something that is not RCON.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Unblock the read below when the server closes.
+		select {
+		case <-s.closed:
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	authed := false
+	for {
+		id, typ, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch {
+		case typ == rconAuth:
+			s.mu.Lock()
+			password := s.opts.RCONPassword
+			s.mu.Unlock()
+			authed = password != "" && body == password
+			if !authed {
+				id = -1
+			}
+			// Source servers send an empty response before the auth result.
+			writePacket(conn, id, rconResponseValue, "")
+			writePacket(conn, id, rconAuthResponse, "")
+		case typ == rconExecCommand && authed:
+			writePacket(conn, id, rconResponseValue, s.run(body))
+		default:
+			return
+		}
+	}
+}
+
+// run executes an RCON command and returns its output.
+func (s *Server) run(cmd string) string {
+	name, args := splitCommand(cmd)
+
+	s.mu.Lock()
+	s.commands = append(s.commands, cmd)
+	fn := s.handlers[name]
+	s.mu.Unlock()
+	if fn != nil {
+		return fn(args)
+	}
+
+	switch name {
+	case "changelevel", "map":
+		if args == "" {
+			return fmt.Sprintf("Usage: %s <mapname>", name)
+		}
+		s.SetMap(args)
+		return ""
+	case "status":
+		return statusText(s.snapshot())
+	case "echo":
+		return args
+	case "say":
+		return ""
+	case "rcon_password":
+		s.mu.Lock()
+		s.opts.RCONPassword = args
+		s.mu.Unlock()
+		return ""
+	}
+	return fmt.Sprintf("Unknown command %q", name)
+}
+
+// statusText imitates the output of the status command.
+func statusText(opts Options) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "hostname: %s\n", opts.Name)
+	fmt.Fprintf(&b, "map     : %s\n", opts.Map)
+	fmt.Fprintf(&b, "players : %d humans, %d bots (%d max)\n", len(opts.Players), opts.Bots, opts.MaxPlayers)
+	b.WriteString("# userid name score connected\n")
+	for i, p := range opts.Players {
+		fmt.Fprintf(&b, "# %d %q %d %s\n", i+2, p.Name, p.Score, p.Duration)
+	}
+	return b.String()
+}
+
+func readPacket(r io.Reader) (id, typ int32, body string, err error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, 0, "", err
+	}
+	if size < 10 || size > rconMaxPacket {
+		return 0, 0, "", fmt.Errorf("packet size %d out of range", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, 0, "", err
+	}
+	id = int32(binary.LittleEndian.Uint32(buf[0:]))
+	typ = int32(binary.LittleEndian.Uint32(buf[4:]))
+	return id, typ, strings.TrimRight(string(buf[8:]), "\x00"), nil
+}
+
+func writePacket(w io.Writer, id, typ int32, body string) error {
+	buf := make([]byte, 0, 14+len(body))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(10+len(body)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(id))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(typ))
+	buf = append(buf, body...)
+	buf = append(buf, 0, 0)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,38 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ScriptLog is the file, at the root of a tree written by WriteScripts,
+// that the fake scripts append each invocation to.
+const ScriptLog = "scripts.log"
+
+// fakeScript logs its invocation and succeeds. %q is the log's path.
+const fakeScript = `#!/bin/bash
+# Fake game-deployment script written by the Ned simulator.
+echo "%s $* NETWAR_ENV=$NETWAR_ENV" >> %q
+echo "$(basename "$0") $*: ok"
+`
+
+// WriteScripts writes a fake game-deployment-scripts tree to dir, with a
+// script at each of the relative paths in scripts. Every run of one is
+// appended to dir/ScriptLog as "<script> <args> NETWAR_ENV=<env>".
+func WriteScripts(dir string, scripts []string) error {
+	logPath, err := filepath.Abs(filepath.Join(dir, ScriptLog))
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		path := filepath.Join(dir, script)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(fakeScript, script, logPath)), 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Package simulator runs fake Source game servers for end-to-end tests and
+// rehearsals. A simulated server answers A2S_INFO and A2S_PLAYER queries on
+// UDP and speaks Source RCON on TCP, with scriptable maps and players and
+// injectable faults.
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMap is the map a server starts on when Options.Map is empty.
+const DefaultMap = "sim_lobby"
+
+// Player is one simulated player.
+type Player struct {
+	Name     string
+	Score    int
+	Duration time.Duration
+}
+
+// Options describe a simulated server's initial state.
+type Options struct {
+	Name         string
+	Map          string
+	MaxPlayers   int
+	Players      []Player
+	Bots         int
+	RCONPassword string // RCON is refused while empty, as on a real server
+
+	// Challenge makes A2S_INFO demand a challenge number first, as Source
+	// servers have since 2020. A2S_PLAYER always does.
+	Challenge bool
+}
+
+// Fault is a failure a simulated server can be told to exhibit.
+type Fault int
+
+const (
+	NoFault      Fault = iota
+	Unresponsive       // A2S requests go unanswered, so queries time out
+	BadResponse        // A2S requests are answered with malformed packets
+	RefuseRCON         // RCON connections are closed as soon as they open
+)
+
+// CommandFunc answers an RCON command; args is everything after its name.
+type CommandFunc func(args string) string
+
+// Server is a running simulated game server.
+type Server struct {
+	udp    net.PacketConn
+	tcp    net.Listener
+	wg     sync.WaitGroup
+	closed chan struct{}
+	close  sync.Once
+
+	mu        sync.Mutex
+	opts      Options
+	challenge uint32
+	fault     Fault
+	drop      int // A2S requests still to drop
+	commands  []string
+	handlers  map[string]CommandFunc
+}
+
+// Start runs a simulated server answering A2S on the UDP address queryAddr
+// and RCON on the TCP address rconAddr, which may be the same host:port.
+// Port 0 picks a free port; see QueryAddr and RCONAddr.
+func Start(opts Options, queryAddr, rconAddr string) (*Server, error) {
+	if opts.Map == "" {
+		opts.Map = DefaultMap
+	}
+	if opts.MaxPlayers == 0 {
+		opts.MaxPlayers = 24
+	}
+	s := &Server{opts: opts, challenge: newChallenge(), handlers: map[string]CommandFunc{}, closed: make(chan struct{})}
+
+	var err error
+	if s.udp, err = net.ListenPacket("udp", queryAddr); err != nil {
+		return nil, err
+	}
+	if s.tcp, err = net.Listen("tcp", rconAddr); err != nil {
+		s.udp.Close()
+		return nil, err
+	}
+
+	s.wg.Add(2)
+	go s.serveA2S()
+	go s.serveRCON()
+	return s, nil
+}
+
+// QueryAddr returns the UDP address A2S queries are answered on.
+func (s *Server) QueryAddr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// RCONAddr returns the TCP address RCON is served on.
+func (s *Server) RCONAddr() string {
+	return s.tcp.Addr().String()
+}
+
+// Close stops the server. Queries sent to it are then refused. Closing a
+// closed server does nothing.
+func (s *Server) Close() error {
+	var err error
+	s.close.Do(func() {
+		close(s.closed)
+		err = errors.Join(s.udp.Close(), s.tcp.Close())
+		s.wg.Wait()
+	})
+	return err
+}
+
+// Map returns the current map.
+func (s *Server) Map() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts.Map
+}
+
+// SetMap changes the current map, as changelevel does.
+func (s *Server) SetMap(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.Map = name
+}
+
+// SetPlayers replaces the connected players.
+func (s *Server) SetPlayers(players ...Player) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.Players = players
+}
+
+// SetFault makes the server exhibit f until it is set back to NoFault.
+func (s *Server) SetFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = f
+}
+
+// DropNext leaves the next n A2S requests unanswered, like lost packets.
+func (s *Server) DropNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop = n
+}
+
+// Handle answers the RCON command name with fn, replacing the built-in
+// handling of name if there is one.
+func (s *Server) Handle(name string, fn CommandFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = fn
+}
+
+// Commands returns the RCON commands the server has run, oldest first.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// snapshot returns a copy of the server's state for building a reply.
+func (s *Server) snapshot() Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	opts := s.opts
+	opts.Players = append([]Player(nil), s.opts.Players...)
+	return opts
+}
+
+// newChallenge returns a random challenge number. 0xFFFFFFFF asks for a
+// challenge, so it is never one.
+func newChallenge() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	c := binary.LittleEndian.Uint32(b[:])
+	if c == 0xFFFFFFFF {
+		c--
+	}
+	return c
+}
+
+// splitCommand splits an RCON command into its name and arguments.
+func splitCommand(cmd string) (name, args string) {
+	name, args, _ = strings.Cut(strings.TrimSpace(cmd), " ")
+	return name, strings.TrimSpace(args)
+}
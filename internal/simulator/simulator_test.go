@@ -0,0 +1,133 @@
+package simulator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netwarlan/ned/internal/executor"
+	"github.com/netwarlan/ned/internal/query"
+	"github.com/netwarlan/ned/internal/rcon"
+)
+
+func startServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	s, err := Start(opts, "127.0.0.1:0", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestA2S(t *testing.T) {
+	for _, challenge := range []bool{false, true} {
+		s := startServer(t, Options{
+			Name:       "Sim TF2",
+			Map:        "ctf_2fort",
+			MaxPlayers: 32,
+			Bots:       2,
+			Players:    []Player{{Name: "alice", Score: 7, Duration: 90 * time.Second}, {Name: "bob"}},
+			Challenge:  challenge,
+		})
+		q := query.NewA2SQuerier(time.Second)
+
+		status, err := q.QueryStatus(context.Background(), s.QueryAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Online || status.Name != "Sim TF2" || status.Map != "ctf_2fort" || status.Players != 2 || status.MaxPlayers != 32 || status.Bots != 2 {
+			t.Errorf("challenge=%v: status = %+v", challenge, status)
+		}
+
+		players, err := q.QueryPlayers(context.Background(), s.QueryAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(players) != 2 || players[0] != (query.PlayerInfo{Name: "alice", Score: 7, Duration: 90 * time.Second}) || players[1].Name != "bob" {
+			t.Errorf("challenge=%v: players = %+v", challenge, players)
+		}
+	}
+}
+
+func TestA2S_Faults(t *testing.T) {
+	s := startServer(t, Options{Name: "Sim"})
+	q := query.NewA2SQuerier(100 * time.Millisecond)
+
+	for fault, want := range map[Fault]query.Failure{Unresponsive: query.FailTimeout, BadResponse: query.FailBadResponse} {
+		s.SetFault(fault)
+		if status, _ := q.QueryStatus(context.Background(), s.QueryAddr()); status.Online || status.Failure != want {
+			t.Errorf("fault %d: status = %+v, want %s", fault, status, want)
+		}
+	}
+
+	// The querier tries three times.
+	s.SetFault(NoFault)
+	s.DropNext(3)
+	if status, _ := q.QueryStatus(context.Background(), s.QueryAddr()); status.Online {
+		t.Error("dropped queries: server is online")
+	}
+	if status, _ := q.QueryStatus(context.Background(), s.QueryAddr()); !status.Online {
+		t.Error("query after the dropped ones: server is offline")
+	}
+}
+
+func TestRCON(t *testing.T) {
+	s := startServer(t, Options{Name: "Sim CS2", RCONPassword: "secret"})
+	client := rcon.NewGorconClient(time.Second)
+	ctx := context.Background()
+
+	if _, err := client.Execute(ctx, s.RCONAddr(), "wrong", "status"); err == nil {
+		t.Error("wrong password was accepted")
+	}
+
+	if _, err := client.Execute(ctx, s.RCONAddr(), "secret", "changelevel de_inferno"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Map() != "de_inferno" {
+		t.Errorf("map = %q after changelevel", s.Map())
+	}
+	out, err := client.Execute(ctx, s.RCONAddr(), "secret", "status")
+	if err != nil || !strings.Contains(out, "map     : de_inferno") {
+		t.Errorf("status = %q, %v", out, err)
+	}
+
+	s.Handle("mp_restartgame", func(args string) string { return "restarting in " + args })
+	if out, _ := client.Execute(ctx, s.RCONAddr(), "secret", "mp_restartgame 3"); out != "restarting in 3" {
+		t.Errorf("custom command = %q", out)
+	}
+	if out, _ := client.Execute(ctx, s.RCONAddr(), "secret", "bogus"); out != `Unknown command "bogus"` {
+		t.Errorf("unknown command = %q", out)
+	}
+	if got := s.Commands(); len(got) != 4 || got[0] != "changelevel de_inferno" {
+		t.Errorf("commands = %q", got)
+	}
+
+	s.SetFault(RefuseRCON)
+	if _, err := client.Execute(ctx, s.RCONAddr(), "secret", "status"); err == nil {
+		t.Error("refused connection succeeded")
+	}
+}
+
+func TestWriteScripts(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteScripts(dir, []string{"tf2/tf2.sh", "cs2/cs2.sh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := executor.NewShellExecutor(dir, "sim")
+	res, err := exec.Run(context.Background(), "tf2/tf2.sh", "down", nil)
+	if err != nil || res.ExitCode != 0 || !strings.Contains(res.Stdout, "tf2.sh down: ok") {
+		t.Fatalf("run = %+v, %v", res, err)
+	}
+	log, err := os.ReadFile(filepath.Join(dir, ScriptLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(log) != "tf2/tf2.sh down NETWAR_ENV=sim\n" {
+		t.Errorf("log = %q", log)
+	}
+}